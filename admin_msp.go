@@ -0,0 +1,54 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/pkg/errors"
+)
+
+// AdminMSPsKey is the state key of the MSP IDs of the administrators
+const AdminMSPsKey = "CONFIG_ADMIN_MSPS"
+
+// ParseAdminMSPs parses JSON array of the MSP IDs. Empty array disables the administrators.
+func ParseAdminMSPs(data string) ([]string, error) {
+	msps := []string{}
+	if err := json.Unmarshal([]byte(data), &msps); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the admin MSP IDs")
+	}
+	for _, mspID := range msps {
+		if "" == mspID {
+			return nil, errors.New("invalid admin MSP ID. expecting non-empty")
+		}
+	}
+	return msps, nil
+}
+
+// GetAdminMSPs retrieves the MSP IDs of the administrators from the ledger, none if not configured.
+func GetAdminMSPs(stub shim.ChaincodeStubInterface) ([]string, error) {
+	data, err := stub.GetState(AdminMSPsKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the admin MSP IDs state")
+	}
+	msps := []string{}
+	if data != nil {
+		if err = json.Unmarshal(data, &msps); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal the admin MSP IDs")
+		}
+	}
+	return msps, nil
+}
+
+// PutAdminMSPs writes the MSP IDs of the administrators into the ledger
+func PutAdminMSPs(stub shim.ChaincodeStubInterface, msps []string) error {
+	data, err := json.Marshal(msps)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the admin MSP IDs")
+	}
+	if err = stub.PutState(AdminMSPsKey, data); err != nil {
+		return errors.Wrap(err, "failed to put the admin MSP IDs state")
+	}
+	return nil
+}
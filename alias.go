@@ -0,0 +1,75 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
+)
+
+// length of the alias (characters)
+const (
+	AliasMinLength = 3
+	AliasMaxLength = 32 // shorter than KID, so an alias can't look like a KID
+)
+
+// lowercase letters and digits, separated by single '.', '_' or '-', starting with a letter
+var aliasRegexp = regexp.MustCompile(`^[a-z][a-z0-9]*([._-][a-z0-9]+)*$`)
+
+// reserved aliases, which may be mistaken for the operator
+var reservedAliases = map[string]bool{
+	"admin":         true,
+	"administrator": true,
+	"anonymous":     true,
+	"guardian":      true,
+	"help":          true,
+	"kiesnet":       true,
+	"kiesnet-id":    true,
+	"null":          true,
+	"official":      true,
+	"payprotocol":   true,
+	"recovery":      true,
+	"root":          true,
+	"support":       true,
+	"system":        true,
+	"undefined":     true,
+}
+
+// Alias is the unique human-readable handle of the KID
+type Alias struct {
+	DOCTYPEID   string       `json:"@alias"` // normalized alias
+	KID         string       `json:"kid"`
+	CreatedTime *txtime.Time `json:"created_time,omitempty"` // claimed or transferred
+}
+
+// NewAlias _
+func NewAlias(alias, kid string) *Alias {
+	return &Alias{
+		DOCTYPEID: alias,
+		KID:       kid,
+	}
+}
+
+// NormalizeAlias folds the case of the alias, and validates it
+func NormalizeAlias(alias string) (string, error) {
+	alias = strings.ToLower(strings.TrimSpace(alias))
+	if len(alias) < AliasMinLength || len(alias) > AliasMaxLength {
+		return "", errors.Errorf("invalid alias. expecting %d ~ %d characters", AliasMinLength, AliasMaxLength)
+	}
+	if !aliasRegexp.MatchString(alias) {
+		return "", errors.New("invalid alias. expecting letters and digits separated by '.', '_' or '-', starting with a letter")
+	}
+	if reservedAliases[alias] {
+		return "", errors.Errorf("invalid alias. reserved word [%s]", alias)
+	}
+	return alias, nil
+}
+
+// MarshalPayload _
+func (a *Alias) MarshalPayload() ([]byte, error) {
+	return json.Marshal(a)
+}
@@ -3,17 +3,42 @@
 package main
 
 import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 
 	"github.com/key-inside/kiesnet-ccpkg/txtime"
 )
 
+// days of the certificates expiring query
+const (
+	ExpiringDefaultDays = 30
+	ExpiringMaxDays     = 365
+)
+
 // Certificate _
 type Certificate struct {
-	DOCTYPEID   string       `json:"@certificate"`
-	SN          string       `json:"sn"`
-	CreatedTime *txtime.Time `json:"created_time,omitempty"`
-	RevokedTime *txtime.Time `json:"revoked_time,omitempty"`
+	DOCTYPEID        string            `json:"@certificate"`
+	SN               string            `json:"sn"`
+	Label            string            `json:"label,omitempty"`    // nickname of the device
+	Metadata         map[string]string `json:"metadata,omitempty"` // device metadata (e.g. os, app_version)
+	SubjectCN        string            `json:"subject_cn,omitempty"`
+	Issuer           string            `json:"issuer,omitempty"`
+	AuthorityKeyID   string            `json:"authority_key_id,omitempty"` // hex
+	NotBefore        *txtime.Time      `json:"not_before,omitempty"`
+	NotAfter         *txtime.Time      `json:"not_after,omitempty"`
+	PublicKeyAlgo    string            `json:"public_key_algorithm,omitempty"`
+	Curve            string            `json:"curve,omitempty"`       // ECDSA only
+	Fingerprint      string            `json:"fingerprint,omitempty"` // hex, SHA-256 of DER
+	PublicKey        string            `json:"public_key,omitempty"`  // base64, PKIX DER
+	CreatedTime      *txtime.Time      `json:"created_time,omitempty"`
+	RevokedTime      *txtime.Time      `json:"revoked_time,omitempty"`
+	RevocationReason string            `json:"revocation_reason,omitempty"` // CRL only
+	ReactivatedTime  *txtime.Time      `json:"reactivated_time,omitempty"`
+	ReactivatedCount int               `json:"reactivated_count,omitempty"`
 }
 
 // NewCertificate _
@@ -24,14 +49,60 @@ func NewCertificate(kid, sn string) *Certificate {
 	}
 }
 
-// Validate _
-func (cert *Certificate) Validate() error {
+// SetDetails records the details of the X.509 certificate.
+// The certificates registered before the details have none.
+func (cert *Certificate) SetDetails(x *x509.Certificate) {
+	cert.SubjectCN = x.Subject.CommonName
+	cert.Issuer = x.Issuer.String()
+	cert.AuthorityKeyID = hex.EncodeToString(x.AuthorityKeyId)
+	cert.NotBefore = txtime.New(x.NotBefore.UTC())
+	cert.NotAfter = txtime.New(x.NotAfter.UTC())
+	cert.PublicKeyAlgo = x.PublicKeyAlgorithm.String()
+	cert.Curve = ""
+	if pub, ok := x.PublicKey.(*ecdsa.PublicKey); ok {
+		cert.Curve = pub.Curve.Params().Name
+	}
+	fp := sha256.Sum256(x.Raw)
+	cert.Fingerprint = hex.EncodeToString(fp[:])
+	cert.PublicKey = ""
+	if der, err := x509.MarshalPKIXPublicKey(x.PublicKey); err == nil {
+		cert.PublicKey = base64.StdEncoding.EncodeToString(der)
+	}
+}
+
+// HasDetails _
+func (cert *Certificate) HasDetails() bool {
+	return cert.Fingerprint != ""
+}
+
+// Validate validates the certificate at the time.
+// The certificates without the details have no validity window.
+func (cert *Certificate) Validate(ts *txtime.Time) error {
 	if cert.RevokedTime != nil {
-		return RevokedCertificateError{}
+		return RevokedCertificateError{ResponsibleErrorImpl{KID: cert.DOCTYPEID, SN: cert.SN}}
+	}
+	if cert.IsExpired(ts) {
+		return ExpiredCertificateError{ResponsibleErrorImpl{KID: cert.DOCTYPEID, SN: cert.SN}}
+	}
+	if cert.NotBefore != nil && cert.NotBefore.Cmp(ts) > 0 {
+		return NotYetValidCertificateError{ResponsibleErrorImpl{KID: cert.DOCTYPEID, SN: cert.SN}}
 	}
 	return nil
 }
 
+// IsExpired returns whether the X.509 validity has ended at the time
+func (cert *Certificate) IsExpired(ts *txtime.Time) bool {
+	return cert.NotAfter != nil && cert.NotAfter.Cmp(ts) < 0
+}
+
+// Status returns the status of the certificate index
+func (cert *Certificate) Status() string {
+	if cert.RevokedTime != nil {
+		return CertificateRevoked
+	}
+	return CertificateActive
+}
+
 // MarshalPayload _
 func (cert *Certificate) MarshalPayload() ([]byte, error) {
 	return json.Marshal(cert)
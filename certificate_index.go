@@ -0,0 +1,75 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
+)
+
+// CertificateIndex is the object type of the certificate index composite keys { kid, status, sn }.
+// The index works on both LevelDB and CouchDB.
+const CertificateIndex = "cert~status~sn"
+
+// CertificateSNIndex is the object type of the serial number index composite keys { sn, kid }.
+// The same SN can be registered by the certificates of different issuers.
+const CertificateSNIndex = "sn~kid"
+
+// certificate statuses of the index
+const (
+	CertificateActive  = "active"
+	CertificateRevoked = "revoked"
+)
+
+// CertificateIndexValue is the value of the index keys.
+// It isn't a JSON document, so the rich queries don't match the index.
+var CertificateIndexValue = []byte{0x00}
+
+// CertificateIndexCompleteKey is the state key marking the index of all certificates, set by the backfill.
+// Until then, the certificates created before the index are missing from it.
+const CertificateIndexCompleteKey = "CONFIG_CERTIFICATE_INDEX_COMPLETE"
+
+// InitCertificateIndex marks the index complete if no certificate is registered yet (new deployment).
+// The upgrade keeps it incomplete until the backfill (admin_reindex).
+func InitCertificateIndex(stub shim.ChaincodeStubInterface) error {
+	data, err := stub.GetState(CertificateIndexCompleteKey)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the certificate index state")
+	}
+	if data != nil {
+		return nil
+	}
+	iter, err := stub.GetStateByRange("CERT_", "CERT`") // '`' is next to '_'
+	if err != nil {
+		return errors.Wrap(err, "failed to get the certificate states")
+	}
+	defer iter.Close()
+	if iter.HasNext() {
+		return nil
+	}
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the timestamp")
+	}
+	if err = stub.PutState(CertificateIndexCompleteKey, []byte(ts.String())); err != nil {
+		return errors.Wrap(err, "failed to put the certificate index state")
+	}
+	return nil
+}
+
+// ReindexMaxSize is the max number of certificates indexed in a transaction
+const ReindexMaxSize = 1000
+
+// ReindexResult is the result of the certificate index backfill
+type ReindexResult struct {
+	Indexed  int    `json:"indexed"`
+	Bookmark string `json:"bookmark"` // next start key, empty if all indexed
+}
+
+// MarshalPayload _
+func (rr *ReindexResult) MarshalPayload() ([]byte, error) {
+	return json.Marshal(rr)
+}
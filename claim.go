@@ -0,0 +1,135 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
+)
+
+// ClaimIssuerAttribute is the certificate attribute of the claim issuer's name
+const ClaimIssuerAttribute = "kiesnet-id.claim_issuer"
+
+// ClaimObjectType is the object type of the claim composite keys { kid, type, issuer }
+const ClaimObjectType = "claim~kid~type~issuer"
+
+// ClaimValueMaxLength is the max characters of the claim value
+const ClaimValueMaxLength = 128
+
+// claim types and issuer names, e.g. "adult", "country", "kyc.level"
+var claimNameRegexp = regexp.MustCompile(`^[a-z][a-z0-9_.-]{0,31}$`)
+
+// ClaimIssuer is the issuer of the claims, registered by the administrator.
+// The issuer's certificate has the MSP ID and the attribute 'kiesnet-id.claim_issuer' of the name.
+type ClaimIssuer struct {
+	DOCTYPEID   string       `json:"@claim_issuer"` // name
+	MSPID       string       `json:"msp_id"`
+	UpdatedTime *txtime.Time `json:"updated_time,omitempty"`
+}
+
+// NewClaimIssuer _
+func NewClaimIssuer(name, mspID string) *ClaimIssuer {
+	return &ClaimIssuer{
+		DOCTYPEID: name,
+		MSPID:     mspID,
+	}
+}
+
+// MarshalPayload _
+func (ci *ClaimIssuer) MarshalPayload() ([]byte, error) {
+	return json.Marshal(ci)
+}
+
+// Claim is the fact about the KID attested by the issuer
+type Claim struct {
+	DOCTYPEID   string       `json:"@claim"` // KID
+	Type        string       `json:"type"`
+	Value       string       `json:"value,omitempty"` // empty for the boolean facts (e.g. "adult")
+	Issuer      string       `json:"issuer"`
+	IssuerMSP   string       `json:"issuer_msp"`             // MSP ID of the issuer registration
+	IssuerSN    string       `json:"issuer_sn"`              // serial number of the issuing certificate
+	ExpiryTime  *txtime.Time `json:"expiry_time,omitempty"`  // nil: never expire
+	CreatedTime *txtime.Time `json:"created_time,omitempty"` // txtime
+	UpdatedTime *txtime.Time `json:"updated_time,omitempty"` // txtime
+	RevokedTime *txtime.Time `json:"revoked_time,omitempty"` // txtime
+}
+
+// NewClaim _
+func NewClaim(kid, typ, issuer string) *Claim {
+	return &Claim{
+		DOCTYPEID: kid,
+		Type:      typ,
+		Issuer:    issuer,
+	}
+}
+
+// IsValid returns whether the claim is not revoked nor expired at the time
+func (c *Claim) IsValid(ts *txtime.Time) bool {
+	return nil == c.RevokedTime && (nil == c.ExpiryTime || c.ExpiryTime.Cmp(ts) > 0)
+}
+
+// IsIssuedBy returns whether the claim is issued by the current registration of the issuer.
+// The issuer name re-registered under another MSP doesn't inherit the claims.
+func (c *Claim) IsIssuedBy(ci *ClaimIssuer) bool {
+	return ci != nil && ci.DOCTYPEID == c.Issuer && ci.MSPID == c.IssuerMSP
+}
+
+// MarshalPayload _
+func (c *Claim) MarshalPayload() ([]byte, error) {
+	return json.Marshal(c)
+}
+
+// ClaimRecord is the record of the claims list
+type ClaimRecord struct {
+	*Claim
+	IsValid bool `json:"is_valid"`
+}
+
+// ClaimList is the claims of the KID
+type ClaimList struct {
+	Records []*ClaimRecord `json:"records"`
+}
+
+// MarshalPayload _
+func (cl *ClaimList) MarshalPayload() ([]byte, error) {
+	return json.Marshal(cl)
+}
+
+// ClaimCheck is the result of 'has_claim'
+type ClaimCheck struct {
+	KID      string   `json:"kid"`
+	Type     string   `json:"type"`
+	HasClaim bool     `json:"has_claim"`
+	Claims   []*Claim `json:"claims"` // valid claims matched
+}
+
+// MarshalPayload _
+func (cc *ClaimCheck) MarshalPayload() ([]byte, error) {
+	return json.Marshal(cc)
+}
+
+// ValidateClaimName validates the claim type or the issuer name
+func ValidateClaimName(kind, name string) error {
+	if !claimNameRegexp.MatchString(name) {
+		return errors.Errorf("invalid %s. expecting 1 ~ 32 lowercase letters, digits or _.- starting with a letter", kind)
+	}
+	return nil
+}
+
+// ValidateClaimValue _
+func ValidateClaimValue(value string) error {
+	if utf8.RuneCountInString(value) > ClaimValueMaxLength {
+		return errors.Errorf("invalid claim value. expecting up to %d characters", ClaimValueMaxLength)
+	}
+	for _, r := range value {
+		if !unicode.IsPrint(r) {
+			return errors.New("invalid claim value. expecting printable characters")
+		}
+	}
+	return nil
+}
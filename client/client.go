@@ -0,0 +1,350 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+// Package client builds the requests of the kiesnet-id chaincode,
+// and decodes the responses and the errors.
+package client
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+)
+
+// ChaincodeName is the default name of the kiesnet-id chaincode
+const ChaincodeName = "kiesnet-id"
+
+// transient keys
+const (
+	TransientPIN         = "kiesnet-id/pin"
+	TransientNewPIN      = "kiesnet-id/new_pin"
+	TransientForce       = "kiesnet-id/force"
+	TransientLinkCode    = "kiesnet-id/link_code"
+	TransientErrorFormat = "kiesnet-id/error_format"
+)
+
+// ErrorFormatJSON is the value of TransientErrorFormat for the JSON error
+const ErrorFormatJSON = "json"
+
+// AnyActive is the SN of VerifySig to verify with any active certificate of the KID
+const AnyActive = "any"
+
+// Request is a call of the kiesnet-id chaincode
+type Request struct {
+	Fn        string
+	Params    []string
+	Transient map[string][]byte
+}
+
+// NewRequest _
+func NewRequest(fn string, params ...string) *Request {
+	return &Request{Fn: fn, Params: params}
+}
+
+// Args returns the chaincode arguments, the function name and the parameters
+func (r *Request) Args() [][]byte {
+	args := make([][]byte, 0, len(r.Params)+1)
+	args = append(args, []byte(r.Fn))
+	for _, p := range r.Params {
+		args = append(args, []byte(p))
+	}
+	return args
+}
+
+// WithTransient sets the transient
+func (r *Request) WithTransient(key string, value []byte) *Request {
+	if nil == r.Transient {
+		r.Transient = map[string][]byte{}
+	}
+	r.Transient[key] = value
+	return r
+}
+
+// WithPIN sets the PIN of the old-style identity
+func (r *Request) WithPIN(pin string) *Request {
+	return r.WithTransient(TransientPIN, []byte(pin))
+}
+
+// WithNewPIN sets the new PIN of 'pin'
+func (r *Request) WithNewPIN(pin string) *Request {
+	return r.WithTransient(TransientNewPIN, []byte(pin))
+}
+
+// WithForce forces the revocation
+func (r *Request) WithForce() *Request {
+	return r.WithTransient(TransientForce, []byte("true"))
+}
+
+// WithLinkCode sets the link code of 'link_begin' and 'register'
+func (r *Request) WithLinkCode(code string) *Request {
+	return r.WithTransient(TransientLinkCode, []byte(code))
+}
+
+// WithJSONError requests the JSON error message, which has the error context
+func (r *Request) WithJSONError() *Request {
+	return r.WithTransient(TransientErrorFormat, []byte(ErrorFormatJSON))
+}
+
+// request builders
+
+// Get requests the invoker's identity (Identity)
+func Get() *Request {
+	return NewRequest("get")
+}
+
+// GetKID requests the invoker's KID (Identity without the SN).
+// If 'migrate' is true, the old-style KID is migrated.
+func GetKID(migrate bool) *Request {
+	migr := ""
+	if migrate {
+		migr = "true"
+	}
+	return NewRequest("kid", migr, "json")
+}
+
+// Register requests the registration of the invoker's certificate (Identity)
+func Register() *Request {
+	return NewRequest("register")
+}
+
+// List requests a page of the certificates (CertificateList).
+// The options can be nil.
+func List(bookmark string, opts *ListOptions) *Request {
+	if nil == opts {
+		return NewRequest("list", bookmark)
+	}
+	data, _ := json.Marshal(opts)
+	return NewRequest("list", bookmark, string(data))
+}
+
+// SetClaim requests the claim about the KID as the issuer (Claim).
+// The expiry is RFC3339 time, empty means never expire.
+func SetClaim(kid, typ, value, expiry string) *Request {
+	return NewRequest("claim_set", kid, typ, value, expiry)
+}
+
+// RevokeClaim requests the revocation of the claim as the issuer (Claim)
+func RevokeClaim(kid, typ string) *Request {
+	return NewRequest("claim_revoke", kid, typ)
+}
+
+// GetClaims requests the claims of the invoker's KID (ClaimList)
+func GetClaims() *Request {
+	return NewRequest("claims")
+}
+
+// HasClaim requests the valid claims of the type, with the value and by the issuer if not empty (ClaimCheck)
+func HasClaim(kid, typ, value, issuer string) *Request {
+	return NewRequest("has_claim", kid, typ, value, issuer)
+}
+
+// ClaimAlias requests the alias of the invoker's KID (Alias)
+func ClaimAlias(alias string) *Request {
+	return NewRequest("alias_claim", alias)
+}
+
+// ReleaseAlias requests the release of the invoker's alias
+func ReleaseAlias(alias string) *Request {
+	return NewRequest("alias_release", alias)
+}
+
+// TransferAlias requests the transfer of the invoker's alias to the KID (Alias)
+func TransferAlias(alias, kid string) *Request {
+	return NewRequest("alias_transfer", alias, kid)
+}
+
+// Resolve requests the KID of the alias (Alias)
+func Resolve(alias string) *Request {
+	return NewRequest("resolve", alias)
+}
+
+// ResolveDID requests the DID Document of the DID or the KID (DIDDocument)
+func ResolveDID(id string) *Request {
+	return NewRequest("did", id)
+}
+
+// SetDIDService requests the service endpoint of the invoker's DID Document, adds or replaces it by the ID (DIDServices)
+func SetDIDService(id, typ, endpoint string) *Request {
+	return NewRequest("did_service", id, typ, endpoint)
+}
+
+// RemoveDIDService requests the removal of the service endpoint from the invoker's DID Document (DIDServices)
+func RemoveDIDService(id string) *Request {
+	return NewRequest("did_service", id)
+}
+
+// Expiring requests the active certificates expiring within the days, 0 means default (CertificateList)
+func Expiring(days int) *Request {
+	if days <= 0 {
+		return NewRequest("expiring")
+	}
+	return NewRequest("expiring", strconv.Itoa(days))
+}
+
+// GetHistory requests a page of the KID history, or the certificate history if 'sn' is not empty (HistoryList)
+func GetHistory(sn, bookmark string) *Request {
+	return NewRequest("history", sn, bookmark)
+}
+
+// Lock requests the lock with the invoker's certificate (KID).
+// The expiry is the duration seconds or RFC3339 time, empty means never expire.
+func Lock(expiry string) *Request {
+	return NewRequest("lock", expiry)
+}
+
+// Unlock requests the unlock (KID)
+func Unlock() *Request {
+	return NewRequest("unlock")
+}
+
+// PIN requests the update of the PIN, with WithPIN and WithNewPIN (Identity)
+func PIN() *Request {
+	return NewRequest("pin")
+}
+
+// Revoke requests the revocation of the certificate (Certificate)
+func Revoke(sn string) *Request {
+	return NewRequest("revoke", sn)
+}
+
+// Reactivate requests the reactivation of the certificate (Certificate)
+func Reactivate(sn string) *Request {
+	return NewRequest("reactivate", sn)
+}
+
+// Label requests the update of the label and the metadata of the certificate, empty SN means the invoker's (Certificate).
+// The nil metadata keeps the current metadata, the empty metadata removes it.
+func Label(sn, label string, metadata map[string]string) *Request {
+	if nil == metadata {
+		return NewRequest("label", sn, label)
+	}
+	data, _ := json.Marshal(metadata)
+	return NewRequest("label", sn, label, string(data))
+}
+
+// LinkBegin requests the link of a new device, with WithLinkCode (Link).
+// The fingerprint is hex SHA-256 of the new device's certificate DER. The TTL is seconds, 0 means default.
+func LinkBegin(fingerprint string, ttl int) *Request {
+	if ttl <= 0 {
+		return NewRequest("link_begin", fingerprint)
+	}
+	return NewRequest("link_begin", fingerprint, strconv.Itoa(ttl))
+}
+
+// SetGuardians requests the update of the guardians (GuardianSet).
+// The delay is the waiting period seconds, 0 means default.
+func SetGuardians(threshold, delay int, guardians ...string) *Request {
+	d := ""
+	if delay > 0 {
+		d = strconv.Itoa(delay)
+	}
+	return NewRequest("guardian_set", append([]string{strconv.Itoa(threshold), d}, guardians...)...)
+}
+
+// RemoveGuardians requests the removal of the guardians
+func RemoveGuardians() *Request {
+	return NewRequest("guardian_set", "0")
+}
+
+// GetGuardians requests the guardians of the invoker's KID (GuardianSet)
+func GetGuardians() *Request {
+	return NewRequest("guardians")
+}
+
+// GetRecovery requests the recovery of the KID (Recovery)
+func GetRecovery(kid string) *Request {
+	return NewRequest("recovery", kid)
+}
+
+// RecoveryRequest requests the recovery of the KID with the invoker's certificate (Recovery)
+func RecoveryRequest(kid string, revoke bool) *Request {
+	if revoke {
+		return NewRequest("recovery_request", kid, "true")
+	}
+	return NewRequest("recovery_request", kid)
+}
+
+// RecoveryApprove approves the recovery as a guardian (Recovery)
+func RecoveryApprove(kid string) *Request {
+	return NewRequest("recovery_approve", kid)
+}
+
+// RecoveryCancel cancels the recovery of the invoker's KID (Recovery)
+func RecoveryCancel() *Request {
+	return NewRequest("recovery_cancel")
+}
+
+// RecoveryReject rejects the recovery not approved yet as a guardian (Recovery)
+func RecoveryReject(kid string) *Request {
+	return NewRequest("recovery_reject", kid)
+}
+
+// RecoveryComplete completes the recovery with the recovering certificate (Identity)
+func RecoveryComplete(kid string) *Request {
+	return NewRequest("recovery_complete", kid)
+}
+
+// Verify requests the invoker's identity status (verifier.Result)
+func Verify() *Request {
+	return NewRequest("verify")
+}
+
+// VerifySig requests the verification of the signature of the digest by the certificate of the SN,
+// or any active certificate of the KID (AnyActive). The ID is the KID or the DID (SignatureVerification).
+// The digest is SHA-256, SHA-384 or SHA-512, and the signature is ASN.1 DER for ECDSA, PKCS#1 v1.5 or PSS for RSA.
+func VerifySig(id, sn string, digest, sig []byte) *Request {
+	return NewRequest("verify_sig", id, sn, hex.EncodeToString(digest), base64.StdEncoding.EncodeToString(sig))
+}
+
+// Ver requests the version string
+func Ver() *Request {
+	return NewRequest("ver")
+}
+
+// AdminClaimIssuer registers the claim issuer of the MSP ID, empty MSP ID removes it (ClaimIssuer)
+func AdminClaimIssuer(name, mspID string) *Request {
+	return NewRequest("admin_claim_issuer", name, mspID)
+}
+
+// AdminImportCRL requests the revocation of the certificates in the PEM or base64 DER CRL (CRLImportResult)
+func AdminImportCRL(crl string) *Request {
+	return NewRequest("admin_import_crl", crl)
+}
+
+// AdminKIDs requests a page of the old-style KIDs (PrivateKIDList)
+func AdminKIDs(bookmark string) *Request {
+	return NewRequest("admin_kids", bookmark)
+}
+
+// AdminKIDsCount requests the number of the old-style KIDs (MigrationCount)
+func AdminKIDsCount() *Request {
+	return NewRequest("admin_kids_count")
+}
+
+// AdminMigrate requests the migration of the old-style KIDs of the state keys (MigrationResult)
+func AdminMigrate(keys ...string) *Request {
+	return NewRequest("admin_migrate", keys...)
+}
+
+// AdminMigrationDeadline sets the RFC3339 deadline, empty removes it (MigrationDeadline)
+func AdminMigrationDeadline(deadline string) *Request {
+	return NewRequest("admin_migration_deadline", deadline)
+}
+
+// AdminReindex requests the certificate index backfill (ReindexResult).
+// The limit 0 means max.
+func AdminReindex(start string, limit int) *Request {
+	if limit <= 0 {
+		return NewRequest("admin_reindex", start)
+	}
+	return NewRequest("admin_reindex", start, strconv.Itoa(limit))
+}
+
+// AdminReindexKIDs requests the backfill of the reverse-lookup keys of the KIDs (ReindexResult).
+// The limit 0 means max.
+func AdminReindexKIDs(start string, limit int) *Request {
+	if limit <= 0 {
+		return NewRequest("admin_reindex_kids", start)
+	}
+	return NewRequest("admin_reindex_kids", start, strconv.Itoa(limit))
+}
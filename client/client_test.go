@@ -0,0 +1,114 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestRequest(t *testing.T) {
+	tests := []struct {
+		req  *Request
+		args []string
+		trs  map[string]string
+	}{
+		{Get(), []string{"get"}, nil},
+		{GetKID(true).WithPIN("1234"), []string{"kid", "true", "json"}, map[string]string{TransientPIN: "1234"}},
+		{GetKID(false), []string{"kid", "", "json"}, nil},
+		{PIN().WithPIN("1234").WithNewPIN("5678"), []string{"pin"}, map[string]string{TransientPIN: "1234", TransientNewPIN: "5678"}},
+		{Revoke("01").WithForce().WithJSONError(), []string{"revoke", "01"}, map[string]string{TransientForce: "true", TransientErrorFormat: ErrorFormatJSON}},
+		{List("", nil), []string{"list", ""}, nil},
+		{List("b", &ListOptions{PageSize: 5, Revoked: RevokedOnly}), []string{"list", "b", `{"page_size":5,"revoked":"only"}`}, nil},
+		{LinkBegin("ab", 0).WithLinkCode("0123456789ab"), []string{"link_begin", "ab"}, map[string]string{TransientLinkCode: "0123456789ab"}},
+		{LinkBegin("ab", 60), []string{"link_begin", "ab", "60"}, nil},
+		{Label("", "phone", nil), []string{"label", "", "phone"}, nil},
+		{Label("01", "", map[string]string{}), []string{"label", "01", "", "{}"}, nil},
+		{TransferAlias("alice", "k"), []string{"alias_transfer", "alice", "k"}, nil},
+		{Resolve("Alice"), []string{"resolve", "Alice"}, nil},
+		{SetClaim("k", "country", "KR", ""), []string{"claim_set", "k", "country", "KR", ""}, nil},
+		{HasClaim("k", "adult", "", "kyc"), []string{"has_claim", "k", "adult", "", "kyc"}, nil},
+		{ResolveDID("did:kiesnet:k"), []string{"did", "did:kiesnet:k"}, nil},
+		{RemoveDIDService("hub"), []string{"did_service", "hub"}, nil},
+		{VerifySig("k", AnyActive, []byte{0xab, 0xcd}, []byte{0x01}), []string{"verify_sig", "k", "any", "abcd", "AQ=="}, nil},
+		{Expiring(7), []string{"expiring", "7"}, nil},
+		{Lock(""), []string{"lock", ""}, nil},
+		{SetGuardians(2, 0, "a", "b"), []string{"guardian_set", "2", "", "a", "b"}, nil},
+		{RemoveGuardians(), []string{"guardian_set", "0"}, nil},
+		{RecoveryRequest("k", true), []string{"recovery_request", "k", "true"}, nil},
+		{AdminMigrate("k1", "k2"), []string{"admin_migrate", "k1", "k2"}, nil},
+		{AdminReindex("", 10), []string{"admin_reindex", "", "10"}, nil},
+		{AdminImportCRL("crl"), []string{"admin_import_crl", "crl"}, nil},
+	}
+	for _, tt := range tests {
+		args := []string{}
+		for _, arg := range tt.req.Args() {
+			args = append(args, string(arg))
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("expected args %q, but %q", tt.args, args)
+		}
+		if len(tt.req.Transient) != len(tt.trs) {
+			t.Errorf("%s: expected transient %v, but %v", tt.req.Fn, tt.trs, tt.req.Transient)
+		}
+		for k, v := range tt.trs {
+			if string(tt.req.Transient[k]) != v {
+				t.Errorf("%s: expected transient %s=%s, but %s", tt.req.Fn, k, v, tt.req.Transient[k])
+			}
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		msg  string
+		code string
+		kid  string
+	}{
+		{"failed to get the invoker's KID|not registrated certificate", CodeNotRegisteredCertificate, ""},
+		{"failed to revoke the certificate|revoking the invoker's certificate requires the force", CodeSelfRevocation, ""},
+		{"incorrect number of parameters. expecting 1", CodeInvalidParameter, ""},
+		{"invalid TTL. expecting 1 ~ 3600", CodeInvalidParameter, ""},
+		{"too many services. expecting up to 10", CodeInvalidParameter, ""},
+		{"unknown function: [abc]", CodeUnknownFunction, ""},
+		{"already locked with the certificate", CodeAlreadyLocked, ""},
+		{"failed to get the invoker's identity", CodeInternal, ""},
+		{`{"code":"NOT_LOCKED_CERTIFICATE","message":"failed to get the invoker's identity|not locked certificate","kid":"abcd","sn":"01"}`, CodeNotLockedCertificate, "abcd"},
+	}
+	for _, tt := range tests {
+		e := ParseError(tt.msg)
+		if e.Code != tt.code || e.KID != tt.kid {
+			t.Errorf("%s: expected %s, but %+v", tt.msg, tt.code, e)
+		}
+	}
+	if e := ParseError(`{"code":"NOT_LOCKED_CERTIFICATE","message":"...|not locked certificate"}`); e.Cause() != "not locked certificate" {
+		t.Errorf("unexpected cause [%s]", e.Cause())
+	}
+}
+
+func TestDecode(t *testing.T) {
+	l := &CertificateList{}
+	res := shim.Success([]byte(`{"meta":{"fetched_records_count":1,"bookmark":"b"},"records":[{"@certificate":"abcd","sn":"01","revoked_time":"2018-12-01T00:00:00.000000000Z","is_current":true}]}`))
+	if err := Decode(res, l); err != nil {
+		t.Fatal(err)
+	}
+	if l.Meta.Bookmark != "b" || l.Meta.FetchedRecordsCount != 1 || len(l.Records) != 1 || l.Records[0].KID != "abcd" || !l.Records[0].Revoked() || !l.Records[0].IsCurrent {
+		t.Errorf("unexpected list: %+v", l)
+	}
+
+	qr := &QueryResult{}
+	if err := Decode(shim.Success([]byte(`{"records":[]}`)), qr); err != nil || qr.Bookmark() != "" || string(qr.Records) != "[]" {
+		t.Errorf("unexpected result: %+v, %v", qr, err)
+	}
+
+	err := Decode(peer.Response{Status: PINFailureStatus, Message: "failed to get the invoker's KID|mismatched PIN"}, nil)
+	if !IsCode(err, CodeMismatchedPIN) || err.(*Error).Status != PINFailureStatus {
+		t.Errorf("expected the mismatched PIN, but %v", err)
+	}
+	if err = Decode(shim.Success([]byte("abcd")), &Identity{}); err == nil || IsCode(err, CodeInternal) {
+		t.Errorf("expected unmarshal error, but %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package client
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// error codes
+const (
+	CodeInternal                     = "INTERNAL"
+	CodeNotRegisteredCertificate     = "NOT_REGISTERED_CERTIFICATE"
+	CodeRevokedCertificate           = "REVOKED_CERTIFICATE"
+	CodeExpiredCertificate           = "EXPIRED_CERTIFICATE"
+	CodeNotYetValidCertificate       = "NOT_YET_VALID_CERTIFICATE"
+	CodeNotRegisteredKID             = "NOT_REGISTERED_KID"
+	CodeInvalidLinkCode              = "INVALID_LINK_CODE"
+	CodeExpiredLinkCode              = "EXPIRED_LINK_CODE"
+	CodeKIDCollision                 = "KID_COLLISION"
+	CodeMismatchedPIN                = "MISMATCHED_PIN"
+	CodeNoGuardian                   = "NO_GUARDIAN"
+	CodeNoRecovery                   = "NO_RECOVERY"
+	CodePINCooldown                  = "PIN_COOLDOWN"
+	CodeMigrationRequired            = "MIGRATION_REQUIRED"
+	CodeNotAdmin                     = "NOT_ADMIN"
+	CodeNotApprovedReactivation      = "NOT_APPROVED_REACTIVATION"
+	CodeSelfRevocation               = "SELF_REVOCATION"
+	CodeLockingCertificateRevocation = "LOCKING_CERTIFICATE_REVOCATION"
+	CodeLastCertificateRevocation    = "LAST_CERTIFICATE_REVOCATION"
+	CodeNotLockedCertificate         = "NOT_LOCKED_CERTIFICATE"
+	CodeInvalidParameter             = "INVALID_PARAMETER"
+	CodeUnknownFunction              = "UNKNOWN_FUNCTION"
+	CodeNotSupportedKID              = "NOT_SUPPORTED_KID"
+	CodeAlreadyRegisteredKID         = "ALREADY_REGISTERED_KID"
+	CodeAlreadyRegisteredCertificate = "ALREADY_REGISTERED_CERTIFICATE"
+	CodeAlreadyRevokedCertificate    = "ALREADY_REVOKED_CERTIFICATE"
+	CodeNotRevokedCertificate        = "NOT_REVOKED_CERTIFICATE"
+	CodeAlreadyLocked                = "ALREADY_LOCKED"
+	CodeNotGuardian                  = "NOT_GUARDIAN"
+	CodeAlreadyRequestedRecovery     = "ALREADY_REQUESTED_RECOVERY"
+	CodeExpiredRecovery              = "EXPIRED_RECOVERY"
+	CodeAlreadyApprovedRecovery      = "ALREADY_APPROVED_RECOVERY"
+	CodeNotApprovedRecovery          = "NOT_APPROVED_RECOVERY"
+	CodeNotRecoveringCertificate     = "NOT_RECOVERING_CERTIFICATE"
+	CodeRecoveryWaitingPeriod        = "RECOVERY_WAITING_PERIOD"
+	CodeNotRegisteredAlias           = "NOT_REGISTERED_ALIAS"
+	CodeAlreadyRegisteredAlias       = "ALREADY_REGISTERED_ALIAS"
+	CodeAlreadyAliasedKID            = "ALREADY_ALIASED_KID"
+	CodeNotAliasOwner                = "NOT_ALIAS_OWNER"
+	CodeNotClaimIssuer               = "NOT_CLAIM_ISSUER"
+	CodeNoClaim                      = "NO_CLAIM"
+	CodeAlreadyRevokedClaim          = "ALREADY_REVOKED_CLAIM"
+	CodeRevokedByCA                  = "REVOKED_BY_CA"
+)
+
+// PINFailureStatus is the status of the recorded PIN mismatch.
+// Submit the transaction to record the failure.
+const PINFailureStatus = 299
+
+// codes of the causes in the string form
+var causeCodes = map[string]string{
+	"not registrated certificate":               CodeNotRegisteredCertificate,
+	"revoked certificate":                       CodeRevokedCertificate,
+	"expired certificate":                       CodeExpiredCertificate,
+	"not yet valid certificate":                 CodeNotYetValidCertificate,
+	"not registered KID":                        CodeNotRegisteredKID,
+	"invalid link code":                         CodeInvalidLinkCode,
+	"expired link code":                         CodeExpiredLinkCode,
+	"no available KID":                          CodeKIDCollision,
+	"mismatched PIN":                            CodeMismatchedPIN,
+	"no guardian":                               CodeNoGuardian,
+	"no recovery request":                       CodeNoRecovery,
+	"too many mismatched PINs. try again later": CodePINCooldown,
+	"old-style KID is no longer supported. migration required": CodeMigrationRequired,
+	"not an administrator": CodeNotAdmin,
+	"reactivation must be approved by an active certificate": CodeNotApprovedReactivation,
+	"not locked certificate":                                 CodeNotLockedCertificate,
+	"not supported KID":                                      CodeNotSupportedKID,
+	"already registered KID":                                 CodeAlreadyRegisteredKID,
+	"already registered certificate":                         CodeAlreadyRegisteredCertificate,
+	"already revoked certificate":                            CodeAlreadyRevokedCertificate,
+	"not revoked certificate":                                CodeNotRevokedCertificate,
+	"already locked with the certificate":                    CodeAlreadyLocked,
+	"not a guardian of the KID":                              CodeNotGuardian,
+	"already requested recovery":                             CodeAlreadyRequestedRecovery,
+	"expired recovery request":                               CodeExpiredRecovery,
+	"already approved recovery":                              CodeAlreadyApprovedRecovery,
+	"not approved recovery":                                  CodeNotApprovedRecovery,
+	"not the recovering certificate":                         CodeNotRecoveringCertificate,
+	"recovery is in the waiting period":                      CodeRecoveryWaitingPeriod,
+	"not registered alias":                                   CodeNotRegisteredAlias,
+	"already registered alias":                               CodeAlreadyRegisteredAlias,
+	"the KID already has an alias":                           CodeAlreadyAliasedKID,
+	"not the owner of the alias":                             CodeNotAliasOwner,
+	"not a claim issuer":                                     CodeNotClaimIssuer,
+	"no claim":                                               CodeNoClaim,
+	"already revoked claim":                                  CodeAlreadyRevokedClaim,
+	"the certificate revoked by the CA can't be reactivated": CodeRevokedByCA,
+}
+
+// codes of the cause prefixes in the string form
+var causePrefixCodes = []struct {
+	prefix string
+	code   string
+}{
+	{"revoking the invoker's certificate ", CodeSelfRevocation},
+	{"revoking the locking certificate ", CodeLockingCertificateRevocation},
+	{"revoking the last active certificate ", CodeLastCertificateRevocation},
+	{"unknown function: ", CodeUnknownFunction},
+	{"incorrect number of parameters", CodeInvalidParameter},
+	{"invalid ", CodeInvalidParameter},
+	{"link code must be ", CodeInvalidParameter},
+	{"claim expiry must be ", CodeInvalidParameter},
+	{"too many services", CodeInvalidParameter},
+}
+
+// Error is the error response of the kiesnet-id chaincode
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"` // the string form
+	KID     string `json:"kid,omitempty"`
+	SN      string `json:"sn,omitempty"`
+	Status  int32  `json:"-"`
+}
+
+// Error implements error interface
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Cause returns the last part of the string form
+func (e *Error) Cause() string {
+	return e.Message[strings.LastIndex(e.Message, "|")+1:]
+}
+
+// ParseError parses the JSON error or the string form of the error message.
+// The string form has no context (KID, SN).
+func ParseError(msg string) *Error {
+	e := &Error{}
+	if strings.HasPrefix(msg, "{") && json.Unmarshal([]byte(msg), e) == nil && e.Code != "" {
+		return e
+	}
+	e = &Error{Code: CodeInternal, Message: msg}
+	cause := e.Cause()
+	if code, ok := causeCodes[cause]; ok {
+		e.Code = code
+		return e
+	}
+	for _, pc := range causePrefixCodes {
+		if strings.HasPrefix(cause, pc.prefix) {
+			e.Code = pc.code
+			break
+		}
+	}
+	return e
+}
+
+// IsCode returns whether the error is *Error of the code
+func IsCode(err error, code string) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == code
+}
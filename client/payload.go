@@ -0,0 +1,316 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package client
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
+)
+
+// Identity is the payload of 'get', 'register', 'pin' and 'recovery_complete', and 'kid' without the SN
+type Identity struct {
+	ID             string            `json:"id"`
+	SN             string            `json:"sn,omitempty"`
+	Alias          string            `json:"alias,omitempty"`
+	Label          string            `json:"label,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+	LockExpiryTime *txtime.Time      `json:"lock_expiry_time,omitempty"`
+}
+
+// KID is the payload of 'lock' and 'unlock'
+type KID struct {
+	ID             string       `json:"@kid"`
+	Lock           string       `json:"lock,omitempty"` // SN of the locking certificate
+	LockExpiryTime *txtime.Time `json:"lock_expiry_time,omitempty"`
+	Link           string       `json:"link,omitempty"`
+	Alias          string       `json:"alias,omitempty"`
+	CreatedTime    *txtime.Time `json:"created_time,omitempty"`
+	UpdatedTime    *txtime.Time `json:"updated_time,omitempty"`
+}
+
+// Certificate is the payload of 'revoke', 'reactivate' and 'label', and the record of 'list'
+type Certificate struct {
+	KID              string            `json:"@certificate"`
+	SN               string            `json:"sn"`
+	Label            string            `json:"label,omitempty"`
+	Metadata         map[string]string `json:"metadata,omitempty"` // device metadata (e.g. os, app_version)
+	SubjectCN        string            `json:"subject_cn,omitempty"`
+	Issuer           string            `json:"issuer,omitempty"`
+	AuthorityKeyID   string            `json:"authority_key_id,omitempty"`
+	NotBefore        *txtime.Time      `json:"not_before,omitempty"`
+	NotAfter         *txtime.Time      `json:"not_after,omitempty"`
+	PublicKeyAlgo    string            `json:"public_key_algorithm,omitempty"`
+	Curve            string            `json:"curve,omitempty"`       // ECDSA only
+	PublicKey        string            `json:"public_key,omitempty"`  // base64, PKIX DER
+	Fingerprint      string            `json:"fingerprint,omitempty"` // hex, SHA-256 of DER, empty if registered before the details
+	CreatedTime      *txtime.Time      `json:"created_time,omitempty"`
+	RevokedTime      *txtime.Time      `json:"revoked_time,omitempty"`
+	RevocationReason string            `json:"revocation_reason,omitempty"` // revoked by the CRL
+	ReactivatedTime  *txtime.Time      `json:"reactivated_time,omitempty"`
+	ReactivatedCount int               `json:"reactivated_count,omitempty"`
+	IsCurrent        bool              `json:"is_current,omitempty"` // list only, the invoker's certificate
+	IsLocking        bool              `json:"is_locking,omitempty"` // list only, holding the KID lock
+	IsExpired        bool              `json:"is_expired,omitempty"` // list only, X.509 validity has ended
+}
+
+// Revoked _
+func (cert *Certificate) Revoked() bool {
+	return cert.RevokedTime != nil
+}
+
+// QueryMeta is the meta of the paginated results
+type QueryMeta struct {
+	FetchedRecordsCount int32  `json:"fetched_records_count,omitempty"`
+	Bookmark            string `json:"bookmark,omitempty"` // empty in the last page
+}
+
+// QueryResult is the paginated result, the records are decoded by the caller
+type QueryResult struct {
+	Meta    *QueryMeta      `json:"meta,omitempty"`
+	Records json.RawMessage `json:"records"`
+}
+
+// Bookmark returns the bookmark of the next page, empty in the last page
+func (qr *QueryResult) Bookmark() string {
+	if qr.Meta != nil {
+		return qr.Meta.Bookmark
+	}
+	return ""
+}
+
+// CertificateList is the payload of 'list' and 'expiring'
+type CertificateList struct {
+	Meta    *QueryMeta     `json:"meta,omitempty"`
+	Records []*Certificate `json:"records"`
+}
+
+// History is a modification of the KID or the certificate
+type History struct {
+	TxID      string          `json:"tx_id"`
+	Timestamp *txtime.Time    `json:"timestamp,omitempty"`
+	IsDelete  bool            `json:"is_delete"`
+	Value     json.RawMessage `json:"value,omitempty"` // KID or Certificate
+}
+
+// HistoryList is the payload of 'history'
+type HistoryList struct {
+	Meta    *QueryMeta `json:"meta,omitempty"`
+	Records []*History `json:"records"`
+}
+
+// list options
+const (
+	RevokedExclude = "exclude"
+	RevokedInclude = "include"
+	RevokedOnly    = "only"
+	SortAsc        = "asc"
+	SortDesc       = "desc"
+)
+
+// ListOptions is the options of 'list'. Omitted options are default.
+type ListOptions struct {
+	PageSize int    `json:"page_size,omitempty"`
+	Revoked  string `json:"revoked,omitempty"`
+	From     string `json:"from,omitempty"` // RFC3339
+	To       string `json:"to,omitempty"`   // RFC3339
+	Sort     string `json:"sort,omitempty"`
+}
+
+// Link is the payload of 'link_begin'
+type Link struct {
+	KID         string       `json:"kid"`
+	SN          string       `json:"sn"`
+	Fingerprint string       `json:"fingerprint"`
+	CreatedTime *txtime.Time `json:"created_time,omitempty"`
+	ExpiryTime  *txtime.Time `json:"expiry_time,omitempty"`
+}
+
+// Alias is the payload of 'alias_claim', 'alias_transfer' and 'resolve'
+type Alias struct {
+	Alias       string       `json:"@alias"` // lowercase
+	KID         string       `json:"kid"`
+	CreatedTime *txtime.Time `json:"created_time,omitempty"`
+}
+
+// ClaimIssuer is the payload of 'admin_claim_issuer'
+type ClaimIssuer struct {
+	Name        string       `json:"@claim_issuer"`
+	MSPID       string       `json:"msp_id"`
+	UpdatedTime *txtime.Time `json:"updated_time,omitempty"`
+}
+
+// Claim is the payload of 'claim_set' and 'claim_revoke', and the record of 'claims'
+type Claim struct {
+	KID         string       `json:"@claim"`
+	Type        string       `json:"type"`
+	Value       string       `json:"value,omitempty"`
+	Issuer      string       `json:"issuer"`
+	IssuerMSP   string       `json:"issuer_msp"`
+	IssuerSN    string       `json:"issuer_sn"`
+	ExpiryTime  *txtime.Time `json:"expiry_time,omitempty"`
+	CreatedTime *txtime.Time `json:"created_time,omitempty"`
+	UpdatedTime *txtime.Time `json:"updated_time,omitempty"`
+	RevokedTime *txtime.Time `json:"revoked_time,omitempty"`
+	IsValid     bool         `json:"is_valid,omitempty"` // 'claims' only, not revoked nor expired
+}
+
+// ClaimList is the payload of 'claims'
+type ClaimList struct {
+	Records []*Claim `json:"records"`
+}
+
+// ClaimCheck is the payload of 'has_claim'
+type ClaimCheck struct {
+	KID      string   `json:"kid"`
+	Type     string   `json:"type"`
+	HasClaim bool     `json:"has_claim"`
+	Claims   []*Claim `json:"claims"` // valid claims matched
+}
+
+// JWK is the public key in JSON Web Key form
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// DIDVerificationMethod is the public key of the certificate in the DID Document
+type DIDVerificationMethod struct {
+	ID           string       `json:"id"` // DID#SN
+	Type         string       `json:"type"`
+	Controller   string       `json:"controller"`
+	PublicKeyJwk *JWK         `json:"publicKeyJwk"`
+	Expires      *txtime.Time `json:"expires,omitempty"`
+	Revoked      *txtime.Time `json:"revoked,omitempty"`
+}
+
+// DIDService is the service endpoint of the DID Document
+type DIDService struct {
+	ID              string `json:"id"` // DID#ID in the DID Document
+	Type            string `json:"type"`
+	ServiceEndpoint string `json:"serviceEndpoint"`
+}
+
+// DIDDocument is the payload of 'did'
+type DIDDocument struct {
+	Context            []string                 `json:"@context"`
+	ID                 string                   `json:"id"`
+	VerificationMethod []*DIDVerificationMethod `json:"verificationMethod"`
+	Authentication     []string                 `json:"authentication"`
+	AssertionMethod    []string                 `json:"assertionMethod"`
+	Service            []*DIDService            `json:"service,omitempty"`
+}
+
+// DIDServices is the payload of 'did_service'
+type DIDServices struct {
+	KID         string        `json:"@did_services"`
+	Services    []*DIDService `json:"services"`
+	UpdatedTime *txtime.Time  `json:"updated_time,omitempty"`
+}
+
+// GuardianSet is the payload of 'guardian_set' and 'guardians'
+type GuardianSet struct {
+	KID         string       `json:"@guardian"`
+	Guardians   []string     `json:"guardians"`
+	Threshold   int          `json:"threshold"`
+	Delay       int          `json:"delay"` // seconds
+	UpdatedTime *txtime.Time `json:"updated_time,omitempty"`
+}
+
+// Recovery is the payload of 'recovery*'
+type Recovery struct {
+	KID           string       `json:"kid"`
+	SN            string       `json:"sn"`
+	Revoke        bool         `json:"revoke"`
+	Approvals     []string     `json:"approvals"`
+	CreatedTime   *txtime.Time `json:"created_time,omitempty"`
+	ExpiryTime    *txtime.Time `json:"expiry_time,omitempty"`
+	ApprovedTime  *txtime.Time `json:"approved_time,omitempty"`
+	EffectiveTime *txtime.Time `json:"effective_time,omitempty"`
+}
+
+// PrivateKID is the record of 'admin_kids'
+type PrivateKID struct {
+	KID         string       `json:"kid"`
+	Key         string       `json:"key"`
+	HasPIN      bool         `json:"has_pin"`
+	CreatedTime *txtime.Time `json:"created_time,omitempty"`
+	UpdatedTime *txtime.Time `json:"updated_time,omitempty"`
+}
+
+// PrivateKIDList is the payload of 'admin_kids'
+type PrivateKIDList struct {
+	Meta    *QueryMeta    `json:"meta,omitempty"`
+	Records []*PrivateKID `json:"records"`
+}
+
+// MigrationCount is the payload of 'admin_kids_count'
+type MigrationCount struct {
+	Total   int `json:"total"`
+	WithPIN int `json:"with_pin"`
+}
+
+// MigrationResult is the payload of 'admin_migrate'
+type MigrationResult struct {
+	Migrated []string `json:"migrated"`
+	Skipped  []string `json:"skipped"`
+}
+
+// MigrationDeadline is the payload of 'admin_migration_deadline'
+type MigrationDeadline struct {
+	Deadline *txtime.Time `json:"deadline,omitempty"`
+}
+
+// ReindexResult is the payload of 'admin_reindex'
+type ReindexResult struct {
+	Indexed  int    `json:"indexed"`
+	Bookmark string `json:"bookmark"`
+}
+
+// CRLMatch is a registered certificate in the CRL
+type CRLMatch struct {
+	KID    string `json:"kid"`
+	SN     string `json:"sn"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// CRLImportResult is the payload of 'admin_import_crl'
+type CRLImportResult struct {
+	Issuer         string      `json:"issuer"`
+	Entries        int         `json:"entries"`
+	Revoked        []*CRLMatch `json:"revoked"`
+	AlreadyRevoked []*CRLMatch `json:"already_revoked"`
+	Mismatched     []*CRLMatch `json:"mismatched"` // same SN of another issuer
+	Unlocked       []*CRLMatch `json:"unlocked"`   // KIDs locked by the revoked certificates
+}
+
+// SignatureVerification is the payload of 'verify_sig'
+type SignatureVerification struct {
+	KID      string `json:"kid"`
+	SN       string `json:"sn,omitempty"` // the verifying certificate
+	Verified bool   `json:"verified"`
+}
+
+// Decode unmarshals the payload of the response into a new value 'v'.
+// If the response is an error, it returns *Error.
+func Decode(res peer.Response, v interface{}) error {
+	if res.Status != shim.OK {
+		e := ParseError(res.Message)
+		e.Status = res.Status
+		return e
+	}
+	if nil == v {
+		return nil
+	}
+	if err := json.Unmarshal(res.Payload, v); err != nil {
+		return errors.Wrap(err, "failed to unmarshal the payload")
+	}
+	return nil
+}
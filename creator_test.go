@@ -0,0 +1,157 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/common/attrmgr"
+	"github.com/hyperledger/fabric/protos/msp"
+)
+
+const testMSPID = "ORG1"
+
+// testCA issues X.509 certificates for test creators
+type testCA struct {
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	serial int64
+}
+
+// testIdentity is a client enrolled by the testCA
+type testIdentity struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	creator []byte // serialized identity
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name, Organization: []string{testMSPID}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, serial: 1000}
+}
+
+// enroll issues a certificate with a new key pair.
+func (ca *testCA) enroll(t *testing.T, cn string, attrs map[string]string) *testIdentity {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca.reenroll(t, cn, key, attrs)
+}
+
+// reenroll issues a new certificate (new serial number) for the key pair.
+// The same common name results the same client-id.
+func (ca *testCA) reenroll(t *testing.T, cn string, key *ecdsa.PrivateKey, attrs map[string]string) *testIdentity {
+	ca.serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{testMSPID}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if len(attrs) > 0 {
+		value, err := json.Marshal(&attrmgr.Attributes{Attrs: attrs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.ExtraExtensions = []pkix.Extension{{Id: attrmgr.AttrOID, Value: value}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creator, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   testMSPID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testIdentity{cert: cert, key: key, creator: creator}
+}
+
+// crl issues the PEM CRL of the serial numbers revoked at the time with the reason code.
+// The reason code < 0 omits the extension.
+func (ca *testCA) crl(t *testing.T, revokedAt time.Time, reasons map[int64]int) []byte {
+	entries := []pkix.RevokedCertificate{}
+	for serial, reason := range reasons {
+		entry := pkix.RevokedCertificate{SerialNumber: big.NewInt(serial), RevocationTime: revokedAt}
+		if reason >= 0 {
+			value, err := asn1.Marshal(asn1.Enumerated(reason))
+			if err != nil {
+				t.Fatal(err)
+			}
+			entry.Extensions = []pkix.Extension{{Id: asn1.ObjectIdentifier{2, 5, 29, 21}, Value: value}}
+		}
+		entries = append(entries, entry)
+	}
+	der, err := ca.cert.CreateCRL(rand.Reader, ca.key, entries, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+}
+
+// withMSP returns the identity serialized with another MSP ID
+func (id *testIdentity) withMSP(t *testing.T, mspID string) *testIdentity {
+	creator, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: id.cert.Raw}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testIdentity{cert: id.cert, key: id.key, creator: creator}
+}
+
+// pubkeyAttrs makes the certificate use public-key base UUID
+var pubkeyAttrs = map[string]string{"uuid": "pubkey"}
+
+// SN returns the serial number as the chaincode does
+func (id *testIdentity) SN() string {
+	return hex.EncodeToString(id.cert.SerialNumber.Bytes())
+}
+
+// Fingerprint returns the hex SHA-256 of the certificate DER
+func (id *testIdentity) Fingerprint() string {
+	fp := sha256.Sum256(id.cert.Raw)
+	return hex.EncodeToString(fp[:])
+}
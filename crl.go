@@ -0,0 +1,143 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	oidExtensionAuthorityKeyID = asn1.ObjectIdentifier{2, 5, 29, 35}
+	oidExtensionReasonCode     = asn1.ObjectIdentifier{2, 5, 29, 21}
+)
+
+// CRL revocation reasons (RFC 5280), indexed by the reason code
+var crlReasons = []string{
+	"unspecified",
+	"keyCompromise",
+	"cACompromise",
+	"affiliationChanged",
+	"superseded",
+	"cessationOfOperation",
+	"certificateHold",
+	"", // 7 is not used
+	"removeFromCRL",
+	"privilegeWithdrawn",
+	"aACompromise",
+}
+
+// CRL is the parsed X.509 CRL
+type CRL struct {
+	Issuer         string // same form as the recorded certificate issuer
+	AuthorityKeyID string // hex, empty if the CRL has no extension
+	list           *pkix.CertificateList
+}
+
+// ParseCRL parses the PEM or the base64 DER of the X.509 CRL.
+// The signature is not verified, the issuer is checked against the recorded certificates.
+func ParseCRL(data string) (*CRL, error) {
+	data = strings.TrimSpace(data) // not the DER, the bytes of the signature may be spaces
+	der := []byte(data)
+	if !strings.HasPrefix(data, "-----BEGIN") {
+		var err error
+		if der, err = base64.StdEncoding.DecodeString(data); err != nil {
+			return nil, errors.New("invalid CRL. expecting PEM or base64 DER")
+		}
+	}
+	list, err := x509.ParseCRL(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid CRL")
+	}
+
+	issuer := pkix.Name{}
+	issuer.FillFromRDNSequence(&list.TBSCertList.Issuer)
+	crl := &CRL{Issuer: issuer.String(), list: list}
+	for _, ext := range list.TBSCertList.Extensions {
+		if ext.Id.Equal(oidExtensionAuthorityKeyID) {
+			aki := struct {
+				ID []byte `asn1:"optional,tag:0"`
+			}{}
+			if _, err := asn1.Unmarshal(ext.Value, &aki); err == nil {
+				crl.AuthorityKeyID = hex.EncodeToString(aki.ID)
+			}
+		}
+	}
+	return crl, nil
+}
+
+// Entries returns the revoked certificates
+func (crl *CRL) Entries() []pkix.RevokedCertificate {
+	return crl.list.TBSCertList.RevokedCertificates
+}
+
+// Issues returns whether the certificate is issued by the issuer of the CRL.
+// The certificates without the details can't be checked, so they match by the serial number only.
+func (crl *CRL) Issues(cert *Certificate) bool {
+	if !cert.HasDetails() {
+		return true
+	}
+	if cert.Issuer != crl.Issuer {
+		return false
+	}
+	return "" == crl.AuthorityKeyID || "" == cert.AuthorityKeyID || crl.AuthorityKeyID == cert.AuthorityKeyID
+}
+
+// CRLEntrySN returns the serial number of the entry, in the form of the certificate SN
+func CRLEntrySN(entry pkix.RevokedCertificate) string {
+	return hex.EncodeToString(entry.SerialNumber.Bytes())
+}
+
+// CRLEntryReason returns the revocation reason of the entry, "unspecified" without the reason code
+func CRLEntryReason(entry pkix.RevokedCertificate) string {
+	for _, ext := range entry.Extensions {
+		if ext.Id.Equal(oidExtensionReasonCode) {
+			var code asn1.Enumerated
+			if _, err := asn1.Unmarshal(ext.Value, &code); err == nil && code >= 0 && int(code) < len(crlReasons) && crlReasons[code] != "" {
+				return crlReasons[code]
+			}
+		}
+	}
+	return crlReasons[0]
+}
+
+// CRLMatch is a registered certificate in the CRL
+type CRLMatch struct {
+	KID    string `json:"kid"`
+	SN     string `json:"sn"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// CRLImportResult is the summary of the CRL import
+type CRLImportResult struct {
+	Issuer         string      `json:"issuer"`
+	Entries        int         `json:"entries"`         // revoked certificates in the CRL
+	Revoked        []*CRLMatch `json:"revoked"`         // revoked by the import
+	AlreadyRevoked []*CRLMatch `json:"already_revoked"` // revoked before
+	Mismatched     []*CRLMatch `json:"mismatched"`      // same SN of another issuer
+	Unlocked       []*CRLMatch `json:"unlocked"`        // KIDs locked by the revoked certificates
+}
+
+// NewCRLImportResult _
+func NewCRLImportResult(crl *CRL) *CRLImportResult {
+	return &CRLImportResult{
+		Issuer:         crl.Issuer,
+		Entries:        len(crl.Entries()),
+		Revoked:        []*CRLMatch{},
+		AlreadyRevoked: []*CRLMatch{},
+		Mismatched:     []*CRLMatch{},
+		Unlocked:       []*CRLMatch{},
+	}
+}
+
+// MarshalPayload _
+func (cr *CRLImportResult) MarshalPayload() ([]byte, error) {
+	return json.Marshal(cr)
+}
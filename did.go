@@ -0,0 +1,242 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
+)
+
+// DIDPrefix is the prefix of the DID of the KID (did:kiesnet:<kid>)
+const DIDPrefix = "did:kiesnet:"
+
+// DIDContexts are the JSON-LD contexts of the DID Document
+var DIDContexts = []string{
+	"https://www.w3.org/ns/did/v1",
+	"https://w3id.org/security/suites/jws-2020/v1",
+}
+
+// DIDVerificationMethodType is the type of the verification methods
+const DIDVerificationMethodType = "JsonWebKey2020"
+
+// limits of the DID services
+const (
+	DIDServiceMaxCount          = 10
+	DIDServiceTypeMaxLength     = 64
+	DIDServiceEndpointMaxLength = 256
+)
+
+var didServiceIDRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// ParseDID returns the KID of the DID. The KID itself is accepted.
+func ParseDID(did string) string {
+	return strings.TrimPrefix(did, DIDPrefix)
+}
+
+// DIDService is a service endpoint of the DID Document
+type DIDService struct {
+	ID              string `json:"id"` // fragment
+	Type            string `json:"type"`
+	ServiceEndpoint string `json:"serviceEndpoint"`
+}
+
+// Validate _
+func (s *DIDService) Validate() error {
+	if !didServiceIDRegexp.MatchString(s.ID) {
+		return errors.New("invalid service ID. expecting 1 ~ 32 letters, digits, _ or -")
+	}
+	if "" == s.Type || len(s.Type) > DIDServiceTypeMaxLength {
+		return errors.Errorf("invalid service type. expecting 1 ~ %d characters", DIDServiceTypeMaxLength)
+	}
+	for _, r := range s.Type {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) || unicode.IsSpace(r) {
+			return errors.New("invalid service type. expecting printable ASCII without spaces")
+		}
+	}
+	if len(s.ServiceEndpoint) > DIDServiceEndpointMaxLength {
+		return errors.Errorf("invalid service endpoint. expecting up to %d characters", DIDServiceEndpointMaxLength)
+	}
+	if u, err := url.Parse(s.ServiceEndpoint); err != nil || "" == u.Scheme || ("" == u.Host && "" == u.Opaque) {
+		return errors.New("invalid service endpoint. expecting absolute URI")
+	}
+	return nil
+}
+
+// DIDServices is the service endpoints of the KID, registered by the owner
+type DIDServices struct {
+	DOCTYPEID   string        `json:"@did_services"` // KID
+	Services    []*DIDService `json:"services"`
+	UpdatedTime *txtime.Time  `json:"updated_time,omitempty"`
+}
+
+// NewDIDServices _
+func NewDIDServices(kid string) *DIDServices {
+	return &DIDServices{
+		DOCTYPEID: kid,
+		Services:  []*DIDService{},
+	}
+}
+
+// Set adds or replaces the service of the ID
+func (ds *DIDServices) Set(s *DIDService) error {
+	for i, _s := range ds.Services {
+		if _s.ID == s.ID {
+			ds.Services[i] = s
+			return nil
+		}
+	}
+	if len(ds.Services) >= DIDServiceMaxCount {
+		return errors.Errorf("too many services. expecting up to %d", DIDServiceMaxCount)
+	}
+	ds.Services = append(ds.Services, s)
+	return nil
+}
+
+// Remove removes the service of the ID, and returns whether it existed
+func (ds *DIDServices) Remove(id string) bool {
+	for i, s := range ds.Services {
+		if s.ID == id {
+			ds.Services = append(ds.Services[:i], ds.Services[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalPayload _
+func (ds *DIDServices) MarshalPayload() ([]byte, error) {
+	return json.Marshal(ds)
+}
+
+// JWK is the public key in JSON Web Key form (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"` // EC
+	X   string `json:"x,omitempty"`   // EC
+	Y   string `json:"y,omitempty"`   // EC
+	N   string `json:"n,omitempty"`   // RSA
+	E   string `json:"e,omitempty"`   // RSA
+}
+
+// NewJWK converts the base64 PKIX DER public key of the certificate
+func NewJWK(publicKey string) (*JWK, error) {
+	der, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode the public key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the public key")
+	}
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return &JWK{
+			Kty: "EC",
+			Crv: pub.Curve.Params().Name,
+			X:   base64URL(pub.X, size),
+			Y:   base64URL(pub.Y, size),
+		}, nil
+	case *rsa.PublicKey:
+		return &JWK{
+			Kty: "RSA",
+			N:   base64URL(pub.N, 0),
+			E:   base64URL(big.NewInt(int64(pub.E)), 0),
+		}, nil
+	}
+	return nil, errors.New("not supported public key")
+}
+
+// big-endian, left-padded to the size
+func base64URL(n *big.Int, size int) string {
+	b := n.Bytes()
+	if len(b) < size {
+		b = append(make([]byte, size-len(b)), b...)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DIDVerificationMethod is the public key of the certificate
+type DIDVerificationMethod struct {
+	ID           string       `json:"id"` // DID#SN
+	Type         string       `json:"type"`
+	Controller   string       `json:"controller"`
+	PublicKeyJwk *JWK         `json:"publicKeyJwk"`
+	Expires      *txtime.Time `json:"expires,omitempty"` // X.509 not_after
+	Revoked      *txtime.Time `json:"revoked,omitempty"` // revoked certificate
+}
+
+// DIDDocumentService is the service of the DID Document
+type DIDDocumentService struct {
+	ID              string `json:"id"` // DID#ID
+	Type            string `json:"type"`
+	ServiceEndpoint string `json:"serviceEndpoint"`
+}
+
+// DIDDocument is the W3C DID Document of the KID
+type DIDDocument struct {
+	Context            []string                 `json:"@context"`
+	ID                 string                   `json:"id"`
+	VerificationMethod []*DIDVerificationMethod `json:"verificationMethod"`
+	Authentication     []string                 `json:"authentication"`
+	AssertionMethod    []string                 `json:"assertionMethod"`
+	Service            []*DIDDocumentService    `json:"service,omitempty"`
+}
+
+// NewDIDDocument builds the DID Document of the KID.
+// The active certificates are the verification methods, and the revoked are marked as removed.
+// The certificates without the public key are omitted.
+func NewDIDDocument(kid *KID, certs []*Certificate, ds *DIDServices, ts *txtime.Time) (*DIDDocument, error) {
+	did := DIDPrefix + kid.DOCTYPEID
+	doc := &DIDDocument{
+		Context:            DIDContexts,
+		ID:                 did,
+		VerificationMethod: []*DIDVerificationMethod{},
+		Authentication:     []string{},
+		AssertionMethod:    []string{},
+	}
+	for _, cert := range certs {
+		if "" == cert.PublicKey {
+			continue
+		}
+		jwk, err := NewJWK(cert.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		vm := &DIDVerificationMethod{
+			ID:           did + "#" + cert.SN,
+			Type:         DIDVerificationMethodType,
+			Controller:   did,
+			PublicKeyJwk: jwk,
+			Expires:      cert.NotAfter,
+			Revoked:      cert.RevokedTime,
+		}
+		doc.VerificationMethod = append(doc.VerificationMethod, vm)
+		if nil == cert.RevokedTime && !cert.IsExpired(ts) {
+			doc.Authentication = append(doc.Authentication, vm.ID)
+			doc.AssertionMethod = append(doc.AssertionMethod, vm.ID)
+		}
+	}
+	if ds != nil {
+		for _, s := range ds.Services {
+			doc.Service = append(doc.Service, &DIDDocumentService{ID: did + "#" + s.ID, Type: s.Type, ServiceEndpoint: s.ServiceEndpoint})
+		}
+	}
+	return doc, nil
+}
+
+// MarshalPayload _
+func (doc *DIDDocument) MarshalPayload() ([]byte, error) {
+	return json.Marshal(doc)
+}
@@ -0,0 +1,55 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+// ErrorFormatJSON is the value of the 'kiesnet-id/error_format' transient.
+// The error response message is the JSON error payload instead of the string form.
+const ErrorFormatJSON = "json"
+
+// ErrorPayload is the machine-readable error
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"` // the string form
+	KID     string `json:"kid,omitempty"`
+	SN      string `json:"sn,omitempty"`
+}
+
+// NewErrorPayload _
+func NewErrorPayload(err error, msg string) *ErrorPayload {
+	ep := &ErrorPayload{Code: CodeInternal, Message: msg}
+	if e, ok := err.(ResponsibleError); ok {
+		ep.Code = e.Code()
+		ep.KID, ep.SN = e.Context()
+	}
+	return ep
+}
+
+// MarshalPayload _
+func (ep *ErrorPayload) MarshalPayload() ([]byte, error) {
+	return json.Marshal(ep)
+}
+
+// The error responses of the tx functions carry the error payload,
+// and it is moved into the message only if the invoker opts in to the JSON error.
+// The string form of the message is default for backward compatibility.
+func formatErrorResponse(stub shim.ChaincodeStubInterface, res peer.Response) peer.Response {
+	if shim.OK == res.Status {
+		return res
+	}
+	transient, _ := stub.GetTransient()
+	if ErrorFormatJSON == string(transient["kiesnet-id/error_format"]) {
+		if nil == res.Payload { // not by responseError
+			res.Payload, _ = NewErrorPayload(nil, res.Message).MarshalPayload()
+		}
+		res.Message = string(res.Payload)
+	}
+	res.Payload = nil
+	return res
+}
@@ -2,19 +2,76 @@
 
 package main
 
+// error codes
+const (
+	CodeInternal                     = "INTERNAL" // not responsible errors, the message is hidden
+	CodeNotRegisteredCertificate     = "NOT_REGISTERED_CERTIFICATE"
+	CodeRevokedCertificate           = "REVOKED_CERTIFICATE"
+	CodeExpiredCertificate           = "EXPIRED_CERTIFICATE"
+	CodeNotYetValidCertificate       = "NOT_YET_VALID_CERTIFICATE"
+	CodeNotRegisteredKID             = "NOT_REGISTERED_KID"
+	CodeInvalidLinkCode              = "INVALID_LINK_CODE"
+	CodeExpiredLinkCode              = "EXPIRED_LINK_CODE"
+	CodeKIDCollision                 = "KID_COLLISION"
+	CodeMismatchedPIN                = "MISMATCHED_PIN"
+	CodeNoGuardian                   = "NO_GUARDIAN"
+	CodeNoRecovery                   = "NO_RECOVERY"
+	CodePINCooldown                  = "PIN_COOLDOWN"
+	CodeMigrationRequired            = "MIGRATION_REQUIRED"
+	CodeNotAdmin                     = "NOT_ADMIN"
+	CodeNotApprovedReactivation      = "NOT_APPROVED_REACTIVATION"
+	CodeSelfRevocation               = "SELF_REVOCATION"
+	CodeLockingCertificateRevocation = "LOCKING_CERTIFICATE_REVOCATION"
+	CodeLastCertificateRevocation    = "LAST_CERTIFICATE_REVOCATION"
+	CodeNotLockedCertificate         = "NOT_LOCKED_CERTIFICATE"
+	CodeInvalidParameter             = "INVALID_PARAMETER"
+	CodeUnknownFunction              = "UNKNOWN_FUNCTION"
+	CodeNotSupportedKID              = "NOT_SUPPORTED_KID"
+	CodeAlreadyRegisteredKID         = "ALREADY_REGISTERED_KID"
+	CodeAlreadyRegisteredCertificate = "ALREADY_REGISTERED_CERTIFICATE"
+	CodeAlreadyRevokedCertificate    = "ALREADY_REVOKED_CERTIFICATE"
+	CodeNotRevokedCertificate        = "NOT_REVOKED_CERTIFICATE"
+	CodeAlreadyLocked                = "ALREADY_LOCKED"
+	CodeNotGuardian                  = "NOT_GUARDIAN"
+	CodeAlreadyRequestedRecovery     = "ALREADY_REQUESTED_RECOVERY"
+	CodeExpiredRecovery              = "EXPIRED_RECOVERY"
+	CodeAlreadyApprovedRecovery      = "ALREADY_APPROVED_RECOVERY"
+	CodeNotApprovedRecovery          = "NOT_APPROVED_RECOVERY"
+	CodeNotRecoveringCertificate     = "NOT_RECOVERING_CERTIFICATE"
+	CodeRecoveryWaitingPeriod        = "RECOVERY_WAITING_PERIOD"
+	CodeNotRegisteredAlias           = "NOT_REGISTERED_ALIAS"
+	CodeAlreadyRegisteredAlias       = "ALREADY_REGISTERED_ALIAS"
+	CodeAlreadyAliasedKID            = "ALREADY_ALIASED_KID"
+	CodeNotAliasOwner                = "NOT_ALIAS_OWNER"
+	CodeNotClaimIssuer               = "NOT_CLAIM_ISSUER"
+	CodeNoClaim                      = "NO_CLAIM"
+	CodeAlreadyRevokedClaim          = "ALREADY_REVOKED_CLAIM"
+	CodeRevokedByCA                  = "REVOKED_BY_CA"
+)
+
 // ResponsibleError is the interface used to distinguish responsible errors
 type ResponsibleError interface {
 	IsReponsible() bool
+	Code() string              // stable, machine-readable code
+	Context() (kid, sn string) // optional context
 }
 
 // ResponsibleErrorImpl _
-type ResponsibleErrorImpl struct{}
+type ResponsibleErrorImpl struct {
+	KID string // context, optional
+	SN  string // context, optional
+}
 
 // IsReponsible _
 func (e ResponsibleErrorImpl) IsReponsible() bool {
 	return true
 }
 
+// Context _
+func (e ResponsibleErrorImpl) Context() (string, string) {
+	return e.KID, e.SN
+}
+
 // NotRegisteredCertificateError _
 type NotRegisteredCertificateError struct {
 	ResponsibleErrorImpl
@@ -25,6 +82,11 @@ func (e NotRegisteredCertificateError) Error() string {
 	return "not registrated certificate"
 }
 
+// Code _
+func (e NotRegisteredCertificateError) Code() string {
+	return CodeNotRegisteredCertificate
+}
+
 // RevokedCertificateError _
 type RevokedCertificateError struct {
 	ResponsibleErrorImpl
@@ -35,9 +97,105 @@ func (e RevokedCertificateError) Error() string {
 	return "revoked certificate"
 }
 
+// Code _
+func (e RevokedCertificateError) Code() string {
+	return CodeRevokedCertificate
+}
+
+// ExpiredCertificateError _
+type ExpiredCertificateError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e ExpiredCertificateError) Error() string {
+	return "expired certificate"
+}
+
+// Code _
+func (e ExpiredCertificateError) Code() string {
+	return CodeExpiredCertificate
+}
+
+// NotYetValidCertificateError _
+type NotYetValidCertificateError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e NotYetValidCertificateError) Error() string {
+	return "not yet valid certificate"
+}
+
+// Code _
+func (e NotYetValidCertificateError) Code() string {
+	return CodeNotYetValidCertificate
+}
+
+// NotRegisteredKIDError _
+type NotRegisteredKIDError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e NotRegisteredKIDError) Error() string {
+	return "not registered KID"
+}
+
+// Code _
+func (e NotRegisteredKIDError) Code() string {
+	return CodeNotRegisteredKID
+}
+
+// InvalidLinkCodeError _
+type InvalidLinkCodeError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e InvalidLinkCodeError) Error() string {
+	return "invalid link code"
+}
+
+// Code _
+func (e InvalidLinkCodeError) Code() string {
+	return CodeInvalidLinkCode
+}
+
+// ExpiredLinkCodeError _
+type ExpiredLinkCodeError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e ExpiredLinkCodeError) Error() string {
+	return "expired link code"
+}
+
+// Code _
+func (e ExpiredLinkCodeError) Code() string {
+	return CodeExpiredLinkCode
+}
+
+// KIDCollisionError _
+type KIDCollisionError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e KIDCollisionError) Error() string {
+	return "no available KID"
+}
+
+// Code _
+func (e KIDCollisionError) Code() string {
+	return CodeKIDCollision
+}
+
 // MismatchedPINError _
 type MismatchedPINError struct {
 	ResponsibleErrorImpl
+	Failures int // recorded failures, 0 if not recorded
 }
 
 // Error implements error interface
@@ -45,6 +203,158 @@ func (e MismatchedPINError) Error() string {
 	return "mismatched PIN"
 }
 
+// Code _
+func (e MismatchedPINError) Code() string {
+	return CodeMismatchedPIN
+}
+
+// NoGuardianError _
+type NoGuardianError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e NoGuardianError) Error() string {
+	return "no guardian"
+}
+
+// Code _
+func (e NoGuardianError) Code() string {
+	return CodeNoGuardian
+}
+
+// NoRecoveryError _
+type NoRecoveryError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e NoRecoveryError) Error() string {
+	return "no recovery request"
+}
+
+// Code _
+func (e NoRecoveryError) Code() string {
+	return CodeNoRecovery
+}
+
+// PINCooldownError _
+type PINCooldownError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e PINCooldownError) Error() string {
+	return "too many mismatched PINs. try again later"
+}
+
+// Code _
+func (e PINCooldownError) Code() string {
+	return CodePINCooldown
+}
+
+// MigrationRequiredError _
+type MigrationRequiredError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e MigrationRequiredError) Error() string {
+	return "old-style KID is no longer supported. migration required"
+}
+
+// Code _
+func (e MigrationRequiredError) Code() string {
+	return CodeMigrationRequired
+}
+
+// NotAdminError _
+type NotAdminError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e NotAdminError) Error() string {
+	return "not an administrator"
+}
+
+// Code _
+func (e NotAdminError) Code() string {
+	return CodeNotAdmin
+}
+
+// NotApprovedReactivationError _
+type NotApprovedReactivationError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e NotApprovedReactivationError) Error() string {
+	return "reactivation must be approved by an active certificate"
+}
+
+// Code _
+func (e NotApprovedReactivationError) Code() string {
+	return CodeNotApprovedReactivation
+}
+
+// SelfRevocationError _
+type SelfRevocationError struct {
+	ResponsibleErrorImpl
+	Forcible bool
+}
+
+// Error implements error interface
+func (e SelfRevocationError) Error() string {
+	if e.Forcible {
+		return "revoking the invoker's certificate requires the force"
+	}
+	return "revoking the invoker's certificate is not allowed"
+}
+
+// Code _
+func (e SelfRevocationError) Code() string {
+	return CodeSelfRevocation
+}
+
+// LockingCertificateRevocationError _
+type LockingCertificateRevocationError struct {
+	ResponsibleErrorImpl
+	Forcible bool
+}
+
+// Error implements error interface
+func (e LockingCertificateRevocationError) Error() string {
+	if e.Forcible {
+		return "revoking the locking certificate requires the force"
+	}
+	return "revoking the locking certificate is not allowed"
+}
+
+// Code _
+func (e LockingCertificateRevocationError) Code() string {
+	return CodeLockingCertificateRevocation
+}
+
+// LastCertificateRevocationError _
+type LastCertificateRevocationError struct {
+	ResponsibleErrorImpl
+	Forcible bool
+}
+
+// Error implements error interface
+func (e LastCertificateRevocationError) Error() string {
+	if e.Forcible {
+		return "revoking the last active certificate requires the force"
+	}
+	return "revoking the last active certificate is not allowed"
+}
+
+// Code _
+func (e LastCertificateRevocationError) Code() string {
+	return CodeLastCertificateRevocation
+}
+
 // NotLockedCertificateError _
 type NotLockedCertificateError struct {
 	ResponsibleErrorImpl
@@ -54,3 +364,355 @@ type NotLockedCertificateError struct {
 func (e NotLockedCertificateError) Error() string {
 	return "not locked certificate"
 }
+
+// Code _
+func (e NotLockedCertificateError) Code() string {
+	return CodeNotLockedCertificate
+}
+
+// InvalidParameterError _
+type InvalidParameterError struct {
+	ResponsibleErrorImpl
+	Reason string
+}
+
+// Error implements error interface
+func (e InvalidParameterError) Error() string {
+	return e.Reason
+}
+
+// Code _
+func (e InvalidParameterError) Code() string {
+	return CodeInvalidParameter
+}
+
+// UnknownFunctionError _
+type UnknownFunctionError struct {
+	ResponsibleErrorImpl
+	Function string
+}
+
+// Error implements error interface
+func (e UnknownFunctionError) Error() string {
+	return "unknown function: [" + e.Function + "]"
+}
+
+// Code _
+func (e UnknownFunctionError) Code() string {
+	return CodeUnknownFunction
+}
+
+// NotSupportedKIDError _
+type NotSupportedKIDError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e NotSupportedKIDError) Error() string {
+	return "not supported KID"
+}
+
+// Code _
+func (e NotSupportedKIDError) Code() string {
+	return CodeNotSupportedKID
+}
+
+// AlreadyRegisteredKIDError _
+type AlreadyRegisteredKIDError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e AlreadyRegisteredKIDError) Error() string {
+	return "already registered KID"
+}
+
+// Code _
+func (e AlreadyRegisteredKIDError) Code() string {
+	return CodeAlreadyRegisteredKID
+}
+
+// AlreadyRegisteredCertificateError _
+type AlreadyRegisteredCertificateError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e AlreadyRegisteredCertificateError) Error() string {
+	return "already registered certificate"
+}
+
+// Code _
+func (e AlreadyRegisteredCertificateError) Code() string {
+	return CodeAlreadyRegisteredCertificate
+}
+
+// AlreadyRevokedCertificateError _
+type AlreadyRevokedCertificateError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e AlreadyRevokedCertificateError) Error() string {
+	return "already revoked certificate"
+}
+
+// Code _
+func (e AlreadyRevokedCertificateError) Code() string {
+	return CodeAlreadyRevokedCertificate
+}
+
+// NotRevokedCertificateError _
+type NotRevokedCertificateError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e NotRevokedCertificateError) Error() string {
+	return "not revoked certificate"
+}
+
+// Code _
+func (e NotRevokedCertificateError) Code() string {
+	return CodeNotRevokedCertificate
+}
+
+// AlreadyLockedError _
+type AlreadyLockedError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e AlreadyLockedError) Error() string {
+	return "already locked with the certificate"
+}
+
+// Code _
+func (e AlreadyLockedError) Code() string {
+	return CodeAlreadyLocked
+}
+
+// NotGuardianError _
+type NotGuardianError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e NotGuardianError) Error() string {
+	return "not a guardian of the KID"
+}
+
+// Code _
+func (e NotGuardianError) Code() string {
+	return CodeNotGuardian
+}
+
+// AlreadyRequestedRecoveryError _
+type AlreadyRequestedRecoveryError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e AlreadyRequestedRecoveryError) Error() string {
+	return "already requested recovery"
+}
+
+// Code _
+func (e AlreadyRequestedRecoveryError) Code() string {
+	return CodeAlreadyRequestedRecovery
+}
+
+// ExpiredRecoveryError _
+type ExpiredRecoveryError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e ExpiredRecoveryError) Error() string {
+	return "expired recovery request"
+}
+
+// Code _
+func (e ExpiredRecoveryError) Code() string {
+	return CodeExpiredRecovery
+}
+
+// AlreadyApprovedRecoveryError _
+type AlreadyApprovedRecoveryError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e AlreadyApprovedRecoveryError) Error() string {
+	return "already approved recovery"
+}
+
+// Code _
+func (e AlreadyApprovedRecoveryError) Code() string {
+	return CodeAlreadyApprovedRecovery
+}
+
+// NotApprovedRecoveryError _
+type NotApprovedRecoveryError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e NotApprovedRecoveryError) Error() string {
+	return "not approved recovery"
+}
+
+// Code _
+func (e NotApprovedRecoveryError) Code() string {
+	return CodeNotApprovedRecovery
+}
+
+// NotRecoveringCertificateError _
+type NotRecoveringCertificateError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e NotRecoveringCertificateError) Error() string {
+	return "not the recovering certificate"
+}
+
+// Code _
+func (e NotRecoveringCertificateError) Code() string {
+	return CodeNotRecoveringCertificate
+}
+
+// RecoveryWaitingPeriodError _
+type RecoveryWaitingPeriodError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e RecoveryWaitingPeriodError) Error() string {
+	return "recovery is in the waiting period"
+}
+
+// Code _
+func (e RecoveryWaitingPeriodError) Code() string {
+	return CodeRecoveryWaitingPeriod
+}
+
+// NotRegisteredAliasError _
+type NotRegisteredAliasError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e NotRegisteredAliasError) Error() string {
+	return "not registered alias"
+}
+
+// Code _
+func (e NotRegisteredAliasError) Code() string {
+	return CodeNotRegisteredAlias
+}
+
+// AlreadyRegisteredAliasError _
+type AlreadyRegisteredAliasError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e AlreadyRegisteredAliasError) Error() string {
+	return "already registered alias"
+}
+
+// Code _
+func (e AlreadyRegisteredAliasError) Code() string {
+	return CodeAlreadyRegisteredAlias
+}
+
+// AlreadyAliasedKIDError _
+type AlreadyAliasedKIDError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e AlreadyAliasedKIDError) Error() string {
+	return "the KID already has an alias"
+}
+
+// Code _
+func (e AlreadyAliasedKIDError) Code() string {
+	return CodeAlreadyAliasedKID
+}
+
+// NotAliasOwnerError _
+type NotAliasOwnerError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e NotAliasOwnerError) Error() string {
+	return "not the owner of the alias"
+}
+
+// Code _
+func (e NotAliasOwnerError) Code() string {
+	return CodeNotAliasOwner
+}
+
+// NotClaimIssuerError _
+type NotClaimIssuerError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e NotClaimIssuerError) Error() string {
+	return "not a claim issuer"
+}
+
+// Code _
+func (e NotClaimIssuerError) Code() string {
+	return CodeNotClaimIssuer
+}
+
+// NoClaimError _
+type NoClaimError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e NoClaimError) Error() string {
+	return "no claim"
+}
+
+// Code _
+func (e NoClaimError) Code() string {
+	return CodeNoClaim
+}
+
+// AlreadyRevokedClaimError _
+type AlreadyRevokedClaimError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e AlreadyRevokedClaimError) Error() string {
+	return "already revoked claim"
+}
+
+// Code _
+func (e AlreadyRevokedClaimError) Code() string {
+	return CodeAlreadyRevokedClaim
+}
+
+// RevokedByCAError _
+type RevokedByCAError struct {
+	ResponsibleErrorImpl
+}
+
+// Error implements error interface
+func (e RevokedByCAError) Error() string {
+	return "the certificate revoked by the CA can't be reactivated"
+}
+
+// Code _
+func (e RevokedByCAError) Code() string {
+	return CodeRevokedByCA
+}
@@ -0,0 +1,66 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+)
+
+// EventName is the chaincode event name.
+// A transaction can set only one chaincode event, so all events of the transaction are in the payload.
+const EventName = "kiesnet-id"
+
+// EventVersion is the version of the event payload
+const EventVersion = 1
+
+// event types
+const (
+	EventKIDRegistered     = "kid.registered"
+	EventKIDMigrated       = "kid.migrated"
+	EventKIDLinked         = "kid.linked"
+	EventKIDLocked         = "kid.locked"
+	EventKIDUnlocked       = "kid.unlocked"
+	EventPINUpdated        = "pin.updated"
+	EventCertRegistered    = "cert.registered"
+	EventCertRevoked       = "cert.revoked"
+	EventCertReactivated   = "cert.reactivated"
+	EventGuardianUpdated   = "guardian.updated"
+	EventRecoveryRequested = "recovery.requested"
+	EventRecoveryApproved  = "recovery.approved"
+	EventRecoveryCancelled = "recovery.cancelled"
+	EventRecoveryRejected  = "recovery.rejected"
+	EventKIDRecovered      = "kid.recovered"
+	EventAliasClaimed      = "alias.claimed"
+	EventAliasReleased     = "alias.released"
+	EventClaimSet          = "claim.set"
+	EventClaimRevoked      = "claim.revoked"
+)
+
+// Event is an identity lifecycle change
+type Event struct {
+	Type   string       `json:"type"`
+	KID    string       `json:"kid"`
+	SN     string       `json:"sn,omitempty"`
+	TxTime *txtime.Time `json:"txtime,omitempty"`
+}
+
+// EventPayload is the payload of the chaincode event
+type EventPayload struct {
+	Version int      `json:"version"`
+	Events  []*Event `json:"events"`
+}
+
+// NewEventPayload _
+func NewEventPayload(events []*Event) *EventPayload {
+	return &EventPayload{
+		Version: EventVersion,
+		Events:  events,
+	}
+}
+
+// MarshalPayload _
+func (ep *EventPayload) MarshalPayload() ([]byte, error) {
+	return json.Marshal(ep)
+}
@@ -0,0 +1,78 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+// Package event decodes the chaincode events of the kiesnet-id chaincode.
+package event
+
+import (
+	"encoding/json"
+
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
+)
+
+// Name is the chaincode event name of the kiesnet-id chaincode
+const Name = "kiesnet-id"
+
+// Version is the latest version of the event payload this package decodes
+const Version = 1
+
+// event types
+const (
+	KIDRegistered     = "kid.registered"
+	KIDMigrated       = "kid.migrated"
+	KIDLinked         = "kid.linked"
+	KIDLocked         = "kid.locked"
+	KIDUnlocked       = "kid.unlocked"
+	PINUpdated        = "pin.updated"
+	CertRegistered    = "cert.registered"
+	CertRevoked       = "cert.revoked"
+	CertReactivated   = "cert.reactivated"
+	GuardianUpdated   = "guardian.updated"
+	RecoveryRequested = "recovery.requested"
+	RecoveryApproved  = "recovery.approved"
+	RecoveryCancelled = "recovery.cancelled"
+	RecoveryRejected  = "recovery.rejected"
+	KIDRecovered      = "kid.recovered"
+	AliasClaimed      = "alias.claimed"
+	AliasReleased     = "alias.released"
+	ClaimSet          = "claim.set"
+	ClaimRevoked      = "claim.revoked"
+)
+
+// Event is an identity lifecycle change
+type Event struct {
+	Type   string       `json:"type"`
+	KID    string       `json:"kid"`
+	SN     string       `json:"sn,omitempty"`
+	TxTime *txtime.Time `json:"txtime,omitempty"`
+}
+
+// Payload has all events of a transaction
+type Payload struct {
+	Version int      `json:"version"`
+	Events  []*Event `json:"events"`
+}
+
+// Decode unmarshals the chaincode event payload.
+// It fails if the payload version is newer than this package supports.
+func Decode(payload []byte) (*Payload, error) {
+	p := &Payload{}
+	if err := json.Unmarshal(payload, p); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the event payload")
+	}
+	if p.Version < 1 || p.Version > Version {
+		return nil, errors.Errorf("not supported event payload version [%d]", p.Version)
+	}
+	return p, nil
+}
+
+// Filter returns the events of the type
+func (p *Payload) Filter(typ string) []*Event {
+	events := []*Event{}
+	for _, e := range p.Events {
+		if e.Type == typ {
+			events = append(events, e)
+		}
+	}
+	return events
+}
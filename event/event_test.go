@@ -0,0 +1,34 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package event
+
+import "testing"
+
+func TestDecode(t *testing.T) {
+	p, err := Decode([]byte(`{"version":1,"events":[{"type":"kid.registered","kid":"abcd","sn":"01","txtime":"2018-12-01T00:00:00.000000000Z"},{"type":"cert.registered","kid":"abcd","sn":"01","txtime":"2018-12-01T00:00:00.000000000Z"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Events) != 2 || p.Events[0].Type != KIDRegistered || p.Events[0].KID != "abcd" || p.Events[0].SN != "01" || p.Events[0].TxTime == nil {
+		t.Errorf("unexpected payload: %+v", p)
+	}
+	if es := p.Filter(CertRegistered); len(es) != 1 || es[0] != p.Events[1] {
+		t.Errorf("unexpected filtered events: %+v", es)
+	}
+	if es := p.Filter(CertRevoked); len(es) != 0 {
+		t.Errorf("unexpected filtered events: %+v", es)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	tests := []string{
+		`{"version":2,"events":[]}`,
+		`{"events":[]}`,
+		`[]`,
+	}
+	for _, tt := range tests {
+		if _, err := Decode([]byte(tt)); err == nil {
+			t.Errorf("expected error: %s", tt)
+		}
+	}
+}
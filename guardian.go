@@ -0,0 +1,77 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
+)
+
+// GuardianMaxCount _
+const GuardianMaxCount = 10
+
+// recovery waiting period (seconds)
+const (
+	RecoveryDefaultDelay = 259200  // 3 days
+	RecoveryMinDelay     = 3600    // 1 hour
+	RecoveryMaxDelay     = 2592000 // 30 days
+)
+
+// GuardianSet is the guardian KIDs which can approve the recovery of the KID
+type GuardianSet struct {
+	DOCTYPEID   string       `json:"@guardian"` // KID
+	Guardians   []string     `json:"guardians"`
+	Threshold   int          `json:"threshold"` // M of N
+	Delay       int          `json:"delay"`     // waiting period (seconds) before the approved recovery takes effect
+	UpdatedTime *txtime.Time `json:"updated_time,omitempty"`
+}
+
+// NewGuardianSet _
+func NewGuardianSet(kid string) *GuardianSet {
+	return &GuardianSet{
+		DOCTYPEID: kid,
+		Delay:     RecoveryDefaultDelay,
+	}
+}
+
+// Validate _
+func (gs *GuardianSet) Validate() error {
+	n := len(gs.Guardians)
+	if n < 1 || n > GuardianMaxCount {
+		return errors.Errorf("invalid number of guardians. expecting 1 ~ %d", GuardianMaxCount)
+	}
+	if gs.Threshold < 1 || gs.Threshold > n {
+		return errors.Errorf("invalid threshold. expecting 1 ~ %d", n)
+	}
+	if gs.Delay < RecoveryMinDelay || gs.Delay > RecoveryMaxDelay {
+		return errors.Errorf("invalid waiting period. expecting %d ~ %d", RecoveryMinDelay, RecoveryMaxDelay)
+	}
+	seen := map[string]bool{}
+	for _, guardian := range gs.Guardians {
+		if guardian == gs.DOCTYPEID {
+			return errors.New("the KID can't be its own guardian")
+		}
+		if seen[guardian] {
+			return errors.Errorf("duplicated guardian [%s]", guardian)
+		}
+		seen[guardian] = true
+	}
+	return nil
+}
+
+// Has returns whether the KID is a guardian
+func (gs *GuardianSet) Has(kid string) bool {
+	for _, guardian := range gs.Guardians {
+		if guardian == kid {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalPayload _
+func (gs *GuardianSet) MarshalPayload() ([]byte, error) {
+	return json.Marshal(gs)
+}
@@ -0,0 +1,33 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+)
+
+// History is a modification of the state
+type History struct {
+	TxID      string          `json:"tx_id"`
+	Timestamp *txtime.Time    `json:"timestamp,omitempty"`
+	IsDelete  bool            `json:"is_delete"`
+	Value     json.RawMessage `json:"value,omitempty"`
+}
+
+// NewHistory _
+func NewHistory(km *queryresult.KeyModification) *History {
+	h := &History{
+		TxID:     km.GetTxId(),
+		IsDelete: km.GetIsDelete(),
+	}
+	if ts := km.GetTimestamp(); ts != nil {
+		h.Timestamp = txtime.Unix(ts.GetSeconds(), int64(ts.GetNanos()))
+	}
+	if !h.IsDelete && len(km.GetValue()) > 0 {
+		h.Value = json.RawMessage(km.GetValue())
+	}
+	return h
+}
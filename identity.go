@@ -2,7 +2,11 @@
 
 package main
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+)
 
 // Identity _
 type Identity struct {
@@ -46,8 +50,26 @@ func (identity *Identity) GetSN() string {
 
 // MarshalPayload _
 func (identity *Identity) MarshalPayload() ([]byte, error) {
+	var lockExpiryTime *txtime.Time
+	var alias string
+	if identity.kid != nil {
+		if identity.kid.Lock != "" {
+			lockExpiryTime = identity.kid.LockExpiryTime
+		}
+		alias = identity.kid.Alias
+	}
+	var label string
+	var metadata map[string]string
+	if identity.cert != nil {
+		label = identity.cert.Label
+		metadata = identity.cert.Metadata
+	}
 	return json.Marshal(&struct {
-		ID string `json:"id"`
-		SN string `json:"sn"`
-	}{ID: identity.GetID(), SN: identity.GetSN()})
+		ID             string            `json:"id"`
+		SN             string            `json:"sn"`
+		Alias          string            `json:"alias,omitempty"`
+		Label          string            `json:"label,omitempty"`
+		Metadata       map[string]string `json:"metadata,omitempty"`
+		LockExpiryTime *txtime.Time      `json:"lock_expiry_time,omitempty"`
+	}{ID: identity.GetID(), SN: identity.GetSN(), Alias: alias, Label: label, Metadata: metadata, LockExpiryTime: lockExpiryTime})
 }
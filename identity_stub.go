@@ -13,9 +13,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
 	"github.com/key-inside/kiesnet-ccpkg/txtime"
 	"github.com/pkg/errors"
 )
@@ -25,9 +29,14 @@ const collectionName = "kid"
 // IdentityStub _
 type IdentityStub struct {
 	stub       shim.ChaincodeStubInterface
-	uuid       string // client-id or public-key
-	sn         string // serial number
+	uuid       string            // client-id or public-key
+	sn         string            // serial number
+	cert       *x509.Certificate // creator's certificate
+	admin      bool              // 'kiesnet-id.admin' attribute is "true"
+	mspID      string
+	issuer     string // 'kiesnet-id.claim_issuer' attribute
 	transients map[string][]byte
+	events     []*Event // events of the transaction
 }
 
 // pkcs1PublicKey reflects the ASN.1 structure of a PKCS#1 public key.
@@ -81,7 +90,11 @@ func NewIdentityStub(stub shim.ChaincodeStubInterface) (*IdentityStub, error) {
 	ib.stub = stub
 	ib.uuid = uuid
 	ib.sn = hex.EncodeToString(cert.SerialNumber.Bytes())
+	ib.cert = cert
 	ib.transients = transients
+	ib.admin = (nil == clientIdentity.AssertAttributeValue("kiesnet-id.admin", "true"))
+	ib.mspID, _ = clientIdentity.GetMSPID() // error is always nil
+	ib.issuer, _, _ = clientIdentity.GetAttributeValue(ClaimIssuerAttribute)
 
 	return ib, nil
 }
@@ -98,15 +111,45 @@ func (ib *IdentityStub) CreateKIDKey() string {
 	return "KID_" + ib.uuid
 }
 
+// PrivateKIDMarker is the reverse-lookup value of the old-style KID, not to reveal the uuid of the private KID
+const PrivateKIDMarker = "@private"
+
+// CreateKIDIDKey returns the reverse-lookup key of the KID
+func (ib *IdentityStub) CreateKIDIDKey(kid string) string {
+	return "KIDID_" + kid
+}
+
+// MaxKIDRetries is the max number of re-deriving the KID on collision
+const MaxKIDRetries = 8
+
 // CreateKID creates new KID and writes it into the ledger
-// ISSUE: collision check
 func (ib *IdentityStub) CreateKID() (*KID, error) {
 	ts, err := txtime.GetTime(ib.stub)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get the timestamp")
 	}
 
-	kid := NewKID(ib.uuid, ib.stub.GetTxID())
+	// collision check, re-derive with the counter
+	var kid *KID
+	for i := 0; i <= MaxKIDRetries && kid == nil; i++ {
+		nonce := ib.stub.GetTxID()
+		if i > 0 {
+			nonce = fmt.Sprintf("%s#%d", nonce, i)
+		}
+		candidate := NewKID(ib.uuid, nonce)
+		exists, err := ib.ExistsKID(candidate.DOCTYPEID)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			kid = candidate
+		} else {
+			logger.Debugf("KID collision %s", candidate.DOCTYPEID)
+		}
+	}
+	if nil == kid {
+		return nil, KIDCollisionError{}
+	}
 
 	pinCode := string(ib.GetTransient("kiesnet-id/pin"))
 	if pinCode != "" { // old-style
@@ -125,12 +168,100 @@ func (ib *IdentityStub) CreateKID() (*KID, error) {
 	if err = ib.PutKID(kid); err != nil {
 		return nil, err
 	}
+	lookup := ib.uuid
+	if kid.isPriv { // the migration replaces it
+		lookup = PrivateKIDMarker
+	}
+	if err = ib.stub.PutState(ib.CreateKIDIDKey(kid.DOCTYPEID), []byte(lookup)); err != nil {
+		return nil, errors.Wrap(err, "failed to put the KID reverse-lookup state")
+	}
+	if err = ib.PutEvent(EventKIDRegistered, kid.DOCTYPEID, ib.sn, ts); err != nil {
+		return nil, err
+	}
 
 	return kid, nil
 }
 
+// ExistsKID checks whether the KID is already in use
+func (ib *IdentityStub) ExistsKID(kid string) (bool, error) {
+	data, err := ib.stub.GetState(ib.CreateKIDIDKey(kid))
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get the KID reverse-lookup state")
+	}
+	// The KIDs created before the reverse-lookup key get it by the migration (admin_migrate, admin_reindex_kids).
+	// The rich query isn't re-validated at the commit, and LevelDB doesn't support it.
+	return data != nil, nil
+}
+
 // GetKID retrieves the KID from the ledger.
 func (ib *IdentityStub) GetKID(migr bool) (*KID, error) {
+	kid, err := ib.ReadKID()
+	if err != nil {
+		return nil, err
+	}
+
+	if !kid.isPriv { // new-style
+		if kid.Lock != "" && kid.Lock != ib.sn {
+			ts, err := txtime.GetTime(ib.stub)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to get the timestamp")
+			}
+			if kid.IsLocked(ts) {
+				return nil, NotLockedCertificateError{ResponsibleErrorImpl{KID: kid.DOCTYPEID, SN: ib.sn}}
+			}
+		}
+		return kid, nil
+	}
+
+	md, err := GetMigrationDeadline(ib.stub)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	if migr { // migr == secure(in old-version)
+		if kid.HasPIN() {
+			if err = ib.CheckPIN(kid); err != nil {
+				return nil, err
+			}
+			if !md.IsOver(ts) { // maintain old-style
+				return kid, nil
+			} // else force to migrate
+		} // else migrate
+
+		// migrate OB -> YB
+		logger.Debugf("migration KID %s", kid.DOCTYPEID)
+		_ = ib.MigrateKID(kid, ib.sn, ts) // ignore error
+	} else if md.IsOver(ts) {
+		return nil, MigrationRequiredError{ResponsibleErrorImpl{KID: kid.DOCTYPEID, SN: ib.sn}}
+	}
+
+	return kid, nil
+}
+
+// MigrateKID moves the old-style KID from the private collection to the public state (OB -> YB)
+func (ib *IdentityStub) MigrateKID(kid *KID, sn string, ts *txtime.Time) error {
+	key := ib.GetKIDKey(kid)
+	kid.isPriv = false
+	kid.Pin = nil
+	kid.UpdatedTime = ts
+	if err := ib.PutKID(kid); err != nil {
+		return err
+	}
+	if err := ib.stub.DelPrivateData(collectionName, key); err != nil {
+		return errors.Wrap(err, "failed to delete the private KID state")
+	}
+	if err := ib.stub.PutState(ib.CreateKIDIDKey(kid.DOCTYPEID), []byte(strings.TrimPrefix(key, "KID_"))); err != nil {
+		return errors.Wrap(err, "failed to put the KID reverse-lookup state")
+	}
+	return ib.PutEvent(EventKIDMigrated, kid.DOCTYPEID, sn, ts)
+}
+
+// ReadKID retrieves the KID from the ledger without checking the lock and migration.
+func (ib *IdentityStub) ReadKID() (*KID, error) {
 	key := ib.CreateKIDKey()
 	data, err := ib.stub.GetState(key)
 	if err != nil {
@@ -141,11 +272,21 @@ func (ib *IdentityStub) GetKID(migr bool) (*KID, error) {
 		if err = json.Unmarshal(data, kid); err != nil {
 			return nil, errors.Wrap(err, "failed to unmarshal the KID")
 		}
-
-		if kid.Lock != "" && kid.Lock != ib.sn {
-			return nil, NotLockedCertificateError{}
+		if kid.Link != "" { // linked device
+			key = kid.Link
+			data, err = ib.stub.GetState(key)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to get the linked KID state")
+			}
+			if nil == data {
+				return nil, errors.New("failed to get the linked KID")
+			}
+			kid = &KID{}
+			if err = json.Unmarshal(data, kid); err != nil {
+				return nil, errors.Wrap(err, "failed to unmarshal the KID")
+			}
 		}
-
+		kid.key = key
 		return kid, nil
 	}
 
@@ -160,41 +301,12 @@ func (ib *IdentityStub) GetKID(migr bool) (*KID, error) {
 			return nil, errors.Wrap(err, "failed to unmarshal the KID")
 		}
 		kid.isPriv = true
-
-		if migr { // migr == secure(in old-version)
-			if kid.Pin != nil { // never be false
-				if !kid.Pin.Match("") { // maintain old-style
-					pinBytes := ib.GetTransient("kiesnet-id/pin")
-					if pinBytes != nil {
-						if kid.Pin.Match(string(pinBytes)) {
-							return kid, nil
-						}
-					}
-					return nil, MismatchedPINError{}
-				} // else migrate
-			} // else migrate
-
-			// migrate OB -> YB
-			logger.Debugf("migration KID %s", kid.DOCTYPEID)
-
-			ts, err := txtime.GetTime(ib.stub)
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to get the timestamp")
-			}
-
-			kid.isPriv = false
-			kid.Pin = nil
-			kid.UpdatedTime = ts
-			if err = ib.PutKID(kid); err == nil {
-				_ = ib.stub.DelPrivateData(collectionName, key) // ignore error
-			}
-		}
-
+		kid.key = key
 		return kid, nil
 	}
 
 	// no KID = non-registered client
-	return nil, NotRegisteredCertificateError{}
+	return nil, NotRegisteredCertificateError{ResponsibleErrorImpl{SN: ib.sn}}
 }
 
 // PutKID writes the KID into the ledger
@@ -204,17 +316,102 @@ func (ib *IdentityStub) PutKID(kid *KID) error {
 		return errors.Wrap(err, "failed to marshal the KID")
 	}
 	if kid.isPriv {
-		if err = ib.stub.PutPrivateData(collectionName, ib.CreateKIDKey(), data); err != nil {
+		if err = ib.stub.PutPrivateData(collectionName, ib.GetKIDKey(kid), data); err != nil {
 			return errors.Wrap(err, "failed to put the KID state")
 		}
 	} else {
-		if err = ib.stub.PutState(ib.CreateKIDKey(), data); err != nil {
+		if err = ib.stub.PutState(ib.GetKIDKey(kid), data); err != nil {
 			return errors.Wrap(err, "failed to put the KID state")
 		}
 	}
 	return nil
 }
 
+// GetKIDKey returns the state key of the KID.
+// The key of the linked KID is not the invoker's.
+func (ib *IdentityStub) GetKIDKey(kid *KID) string {
+	if kid.key != "" {
+		return kid.key
+	}
+	return ib.CreateKIDKey()
+}
+
+// PIN
+
+// CreatePINAttemptKey _
+func (ib *IdentityStub) CreatePINAttemptKey(kid string) string {
+	return "PINATTEMPT_" + kid
+}
+
+// CheckPIN matches the 'kiesnet-id/pin' transient with the PIN of the old-style KID.
+// The mismatch is recorded in the private collection, and too many mismatches put the KID into the cooldown.
+func (ib *IdentityStub) CheckPIN(kid *KID) error {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	attempt, err := ib.GetPINAttempt(kid.DOCTYPEID)
+	if err != nil {
+		return err
+	}
+	if attempt.IsCoolingDown(ts) {
+		return PINCooldownError{ResponsibleErrorImpl{KID: kid.DOCTYPEID}}
+	}
+
+	pinBytes := ib.GetTransient("kiesnet-id/pin")
+	if nil == pinBytes { // not an attempt
+		return MismatchedPINError{ResponsibleErrorImpl: ResponsibleErrorImpl{KID: kid.DOCTYPEID}}
+	}
+	if kid.Pin.Match(string(pinBytes)) {
+		if attempt.Failures > 0 { // reset
+			if err = ib.stub.DelPrivateData(collectionName, ib.CreatePINAttemptKey(kid.DOCTYPEID)); err != nil {
+				return errors.Wrap(err, "failed to delete the PIN attempt state")
+			}
+		}
+		if kid.Pin.NeedsRehash() { // legacy hash
+			kid.Pin.Rehash(string(pinBytes))
+			if err = ib.PutKID(kid); err != nil {
+				return errors.Wrap(err, "failed to rehash the PIN")
+			}
+		}
+		return nil
+	}
+
+	attempt.Fail(ts)
+	if err = ib.PutPINAttempt(attempt); err != nil {
+		return err
+	}
+	return MismatchedPINError{ResponsibleErrorImpl: ResponsibleErrorImpl{KID: kid.DOCTYPEID}, Failures: attempt.Failures}
+}
+
+// GetPINAttempt retrieves the failed PIN attempts of the KID from the private collection
+func (ib *IdentityStub) GetPINAttempt(kid string) (*PINAttempt, error) {
+	data, err := ib.stub.GetPrivateData(collectionName, ib.CreatePINAttemptKey(kid))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the PIN attempt state")
+	}
+	attempt := NewPINAttempt(kid)
+	if data != nil {
+		if err = json.Unmarshal(data, attempt); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal the PIN attempt")
+		}
+	}
+	return attempt, nil
+}
+
+// PutPINAttempt writes the failed PIN attempts into the private collection
+func (ib *IdentityStub) PutPINAttempt(attempt *PINAttempt) error {
+	data, err := json.Marshal(attempt)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the PIN attempt")
+	}
+	if err = ib.stub.PutPrivateData(collectionName, ib.CreatePINAttemptKey(attempt.DOCTYPEID), data); err != nil {
+		return errors.Wrap(err, "failed to put the PIN attempt state")
+	}
+	return nil
+}
+
 // UpdatePIN _
 func (ib *IdentityStub) UpdatePIN(kid *KID) error {
 	if !kid.isPriv { // if new-style, do nothing.
@@ -232,87 +429,1550 @@ func (ib *IdentityStub) UpdatePIN(kid *KID) error {
 	}
 
 	kid.Pin = pin
-	return ib.PutKID(kid)
+	if err = ib.PutKID(kid); err != nil {
+		return err
+	}
+	return ib.PutEvent(EventPINUpdated, kid.DOCTYPEID, ib.sn, pin.UpdatedTime)
 }
 
-// Certificate
+// Private KIDs (administrator)
 
-// CertificatesFetchSize _
-const CertificatesFetchSize = 20
+// GetPrivateKIDsResult returns a page of the old-style KIDs in the private collection.
+// It queries the private data, so it must be in a read-only transaction.
+func (ib *IdentityStub) GetPrivateKIDsResult(bookmark string) (*QueryResult, error) {
+	kvs, err := ib.queryPrivateKIDs(bookmark, PrivateKIDsFetchSize+1)
+	if err != nil {
+		return nil, err
+	}
+	result := &QueryResult{Meta: &peer.QueryResponseMetadata{}}
+	if len(kvs) > PrivateKIDsFetchSize {
+		kvs = kvs[:PrivateKIDsFetchSize]
+		result.Meta.Bookmark = kvs[len(kvs)-1].DOCTYPEID
+	}
+	records := make([]*PrivateKID, 0, len(kvs))
+	for _, kid := range kvs {
+		records = append(records, NewPrivateKID(kid))
+	}
+	result.Meta.FetchedRecordsCount = int32(len(records))
+	if result.Records, err = json.Marshal(records); err != nil {
+		return nil, errors.Wrap(err, "failed to marshal the KIDs")
+	}
+	return result, nil
+}
 
-// CreateCertificateKey _
-func (ib *IdentityStub) CreateCertificateKey(kid string, sn string) string {
-	return fmt.Sprintf("CERT_%s_%s", kid, sn)
+// CountPrivateKIDs counts the old-style KIDs in the private collection.
+// It queries the private data, so it must be in a read-only transaction.
+func (ib *IdentityStub) CountPrivateKIDs() (*MigrationCount, error) {
+	mc := &MigrationCount{}
+	bookmark := ""
+	for {
+		kvs, err := ib.queryPrivateKIDs(bookmark, PrivateKIDsFetchSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, kid := range kvs {
+			mc.Total++
+			if kid.HasPIN() {
+				mc.WithPIN++
+			}
+		}
+		if len(kvs) < PrivateKIDsFetchSize {
+			return mc, nil
+		}
+		bookmark = kvs[len(kvs)-1].DOCTYPEID
+	}
 }
 
-// CreateCertificate creates new certificate and writes it into the ledger
-func (ib *IdentityStub) CreateCertificate(kid string) (*Certificate, error) {
+func (ib *IdentityStub) queryPrivateKIDs(bookmark string, limit int) ([]*KID, error) {
+	iter, err := ib.stub.GetPrivateDataQueryResult(collectionName, CreateQueryPrivateKIDs(bookmark, limit))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query the private KIDs")
+	}
+	defer iter.Close()
+
+	kids := []*KID{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to query the private KIDs")
+		}
+		kid := &KID{}
+		if err = json.Unmarshal(kv.Value, kid); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal the KID")
+		}
+		kid.isPriv = true
+		kid.key = kv.Key
+		kids = append(kids, kid)
+	}
+	return kids, nil
+}
+
+// MigratePrivateKIDs migrates the PIN-less old-style KIDs of the state keys.
+// The KIDs with the PIN or not in the private collection, and the other states (e.g. PINATTEMPT_) are skipped.
+func (ib *IdentityStub) MigratePrivateKIDs(keys []string) (*MigrationResult, error) {
 	ts, err := txtime.GetTime(ib.stub)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get the timestamp")
 	}
 
-	cert := NewCertificate(kid, ib.sn)
-	cert.CreatedTime = ts
-	if err = ib.PutCertificate(cert); err != nil {
-		return nil, err
+	mr := &MigrationResult{Migrated: []string{}, Skipped: []string{}}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "KID_") {
+			mr.Skipped = append(mr.Skipped, key)
+			continue
+		}
+		data, err := ib.stub.GetPrivateData(collectionName, key)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get the KID state")
+		}
+		if nil == data {
+			mr.Skipped = append(mr.Skipped, key)
+			continue
+		}
+		kid := &KID{}
+		if err = json.Unmarshal(data, kid); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal the KID")
+		}
+		kid.isPriv = true
+		kid.key = key
+		if "" == kid.DOCTYPEID || kid.HasPIN() {
+			mr.Skipped = append(mr.Skipped, key)
+			continue
+		}
+		if err = ib.MigrateKID(kid, "", ts); err != nil {
+			return nil, err
+		}
+		mr.Migrated = append(mr.Migrated, kid.DOCTYPEID)
 	}
-
-	return cert, nil
+	return mr, nil
 }
 
-// GetCertificate retrieves the certificate from the ledger
-func (ib *IdentityStub) GetCertificate(kid string, sn string) (*Certificate, error) {
-	if "" == sn {
-		sn = ib.sn
+// IndexKIDs writes the reverse-lookup keys of the public KIDs created before the key, from the start key.
+// The linked devices (pointers to the KIDs) are skipped.
+func (ib *IdentityStub) IndexKIDs(start string, limit int) (*ReindexResult, error) {
+	if "" == start {
+		start = "KID_"
 	}
-	data, err := ib.stub.GetState(ib.CreateCertificateKey(kid, sn))
+	iter, err := ib.stub.GetStateByRange(start, "KID`") // '`' is next to '_'
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get the certificate state")
+		return nil, errors.Wrap(err, "failed to get the KID states")
 	}
-	if data != nil {
-		cert := &Certificate{}
-		if err = json.Unmarshal(data, cert); err != nil {
-			return nil, errors.Wrap(err, "failed to unmarshal the certificate")
+	defer iter.Close()
+
+	rr := &ReindexResult{}
+	for n := 0; iter.HasNext(); n++ {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get the KID states")
 		}
-		return cert, nil
+		if n >= limit {
+			rr.Bookmark = kv.Key
+			break
+		}
+		kid := &KID{}
+		if err = json.Unmarshal(kv.Value, kid); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal the KID")
+		}
+		if kid.Link != "" {
+			continue
+		}
+		key := ib.CreateKIDIDKey(kid.DOCTYPEID)
+		data, err := ib.stub.GetState(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get the KID reverse-lookup state")
+		}
+		if data != nil {
+			continue
+		}
+		if err = ib.stub.PutState(key, []byte(strings.TrimPrefix(kv.Key, "KID_"))); err != nil {
+			return nil, errors.Wrap(err, "failed to put the KID reverse-lookup state")
+		}
+		rr.Indexed++
+	}
+	return rr, nil
+}
+
+// Link
+
+// CreateLinkKey _
+func (ib *IdentityStub) CreateLinkKey(hash string) string {
+	return "LINK_" + hash
+}
+
+// CreateLink creates the link for pairing the new device of the certificate fingerprint with the KID,
+// and writes it into the ledger
+func (ib *IdentityStub) CreateLink(kid *KID, code, fingerprint string, ttl int) (*Link, error) {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	link := NewLink(code)
+	link.KID = kid.DOCTYPEID
+	link.Key = ib.GetKIDKey(kid)
+	link.SN = ib.sn
+	link.Fingerprint = fingerprint
+	link.CreatedTime = ts
+	link.ExpiryTime = txtime.New(ts.Add(time.Duration(ttl) * time.Second))
+
+	data, err := json.Marshal(link)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal the link")
 	}
-	return nil, NotRegisteredCertificateError{}
+	if err = ib.stub.PutState(ib.CreateLinkKey(link.DOCTYPEID), data); err != nil {
+		return nil, errors.Wrap(err, "failed to put the link state")
+	}
+
+	return link, nil
 }
 
-// GetQueryCertificatesResult _
-func (ib *IdentityStub) GetQueryCertificatesResult(kid, bookmark string) (*QueryResult, error) {
-	query := CreateQueryNotRevokedCertificates(kid)
-	iter, meta, err := ib.stub.GetQueryResultWithPagination(query, CertificatesFetchSize, bookmark)
+// LinkKID consumes the link and links the invoker's uuid with the KID.
+// The link is only for the certificate of the fingerprint, and the certificate which began it must be active.
+func (ib *IdentityStub) LinkKID(code string) (*KID, error) {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	key := ib.CreateLinkKey(CreateLinkHash(code))
+	data, err := ib.stub.GetState(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the link state")
+	}
+	if nil == data {
+		return nil, InvalidLinkCodeError{}
+	}
+	link := &Link{}
+	if err = json.Unmarshal(data, link); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the link")
+	}
+	if !link.IsFor(ib.cert) { // the code alone doesn't link
+		return nil, InvalidLinkCodeError{}
+	}
+	if link.ExpiryTime.Cmp(ts) <= 0 {
+		return nil, ExpiredLinkCodeError{}
+	}
+	cert, err := ib.GetCertificate(link.KID, link.SN)
 	if err != nil {
 		return nil, err
 	}
-	defer iter.Close()
+	if err = cert.Validate(ts); err != nil {
+		return nil, err
+	}
+
+	data, err = ib.stub.GetState(link.Key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the KID state")
+	}
+	if nil == data {
+		return nil, errors.New("failed to get the KID to be linked")
+	}
+	kid := &KID{}
+	if err = json.Unmarshal(data, kid); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the KID")
+	}
+	kid.key = link.Key
+
+	if err = ib.putKIDPointer(kid, ts); err != nil {
+		return nil, err
+	}
+	if err = ib.stub.DelState(key); err != nil { // one-time
+		return nil, errors.Wrap(err, "failed to delete the link state")
+	}
+	if err = ib.PutEvent(EventKIDLinked, kid.DOCTYPEID, ib.sn, ts); err != nil {
+		return nil, err
+	}
 
-	return NewQueryResult(meta, iter)
+	return kid, nil
 }
 
-// PutCertificate writes the certificate into the ledger
-func (ib *IdentityStub) PutCertificate(cert *Certificate) error {
-	data, err := json.Marshal(cert)
+// writes the KID_ pointer of the invoker's uuid to the KID
+func (ib *IdentityStub) putKIDPointer(kid *KID, ts *txtime.Time) error {
+	pointer := &KID{
+		DOCTYPEID:   kid.DOCTYPEID,
+		Link:        kid.key,
+		CreatedTime: ts,
+		UpdatedTime: ts,
+	}
+	data, err := json.Marshal(pointer)
 	if err != nil {
-		return errors.Wrap(err, "failed to marshal the certificate")
+		return errors.Wrap(err, "failed to marshal the KID")
 	}
-	if err = ib.stub.PutState(ib.CreateCertificateKey(cert.DOCTYPEID, cert.SN), data); err != nil {
-		return errors.Wrap(err, "failed to put the certificate state")
+	if err = ib.stub.PutState(ib.CreateKIDKey(), data); err != nil {
+		return errors.Wrap(err, "failed to put the KID state")
 	}
 	return nil
 }
 
-// RevokeCertificate revokes the certificate and writes it into the ledger
-func (ib *IdentityStub) RevokeCertificate(cert *Certificate) error {
-	ts, err := txtime.GetTime(ib.stub)
+// GetKIDByID retrieves the new-style KID from the ledger by the ID.
+// The ID is validated first, as it may be in the rich query.
+func (ib *IdentityStub) GetKIDByID(id string) (*KID, error) {
+	if err := ValidateKID(id); err != nil {
+		return nil, InvalidParameterError{Reason: err.Error()}
+	}
+	data, err := ib.stub.GetState(ib.CreateKIDIDKey(id))
 	if err != nil {
-		return errors.Wrap(err, "failed to get the timestamp")
+		return nil, errors.Wrap(err, "failed to get the KID reverse-lookup state")
 	}
-	cert.RevokedTime = ts
-	if err = ib.PutCertificate(cert); err != nil {
-		return errors.Wrap(err, "failed to revoke the certificate")
+	if PrivateKIDMarker == string(data) { // old-style, not in the public state
+		return nil, NotRegisteredKIDError{ResponsibleErrorImpl{KID: id}}
 	}
-	return nil
+	if data != nil {
+		key := "KID_" + string(data)
+		if data, err = ib.stub.GetState(key); err != nil {
+			return nil, errors.Wrap(err, "failed to get the KID state")
+		}
+		if nil == data {
+			return nil, NotRegisteredKIDError{ResponsibleErrorImpl{KID: id}}
+		}
+		kid := &KID{}
+		if err = json.Unmarshal(data, kid); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal the KID")
+		}
+		kid.key = key
+		return kid, nil
+	}
+
+	// KIDs created before the reverse-lookup key
+	iter, err := ib.stub.GetQueryResult(CreateQueryOriginKIDByID(id))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query the KID")
+	}
+	defer iter.Close()
+	if !iter.HasNext() {
+		return nil, NotRegisteredKIDError{ResponsibleErrorImpl{KID: id}}
+	}
+	kv, err := iter.Next()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query the KID")
+	}
+	kid := &KID{}
+	if err = json.Unmarshal(kv.Value, kid); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the KID")
+	}
+	kid.key = kv.Key
+	return kid, nil
+}
+
+// Alias
+
+// CreateAliasKey _
+func (ib *IdentityStub) CreateAliasKey(alias string) string {
+	return "ALIAS_" + alias
+}
+
+// GetAlias retrieves the normalized alias from the ledger
+func (ib *IdentityStub) GetAlias(alias string) (*Alias, error) {
+	data, err := ib.stub.GetState(ib.CreateAliasKey(alias))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the alias state")
+	}
+	if nil == data {
+		return nil, NotRegisteredAliasError{}
+	}
+	a := &Alias{}
+	if err = json.Unmarshal(data, a); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the alias")
+	}
+	return a, nil
+}
+
+// ClaimAlias assigns the normalized alias to the KID which has no alias, and writes them into the ledger
+func (ib *IdentityStub) ClaimAlias(kid *KID, alias string) (*Alias, error) {
+	if kid.Alias != "" {
+		return nil, AlreadyAliasedKIDError{ResponsibleErrorImpl{KID: kid.DOCTYPEID}}
+	}
+	data, err := ib.stub.GetState(ib.CreateAliasKey(alias))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the alias state")
+	}
+	if data != nil {
+		return nil, AlreadyRegisteredAliasError{}
+	}
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	a := NewAlias(alias, kid.DOCTYPEID)
+	a.CreatedTime = ts
+	if err = ib.putAlias(a); err != nil {
+		return nil, err
+	}
+	kid.Alias = alias
+	kid.UpdatedTime = ts
+	if err = ib.PutKID(kid); err != nil {
+		return nil, err
+	}
+	if err = ib.PutEvent(EventAliasClaimed, kid.DOCTYPEID, ib.sn, ts); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// ReleaseAlias removes the alias of the owner KID from the ledger
+func (ib *IdentityStub) ReleaseAlias(kid *KID, a *Alias) error {
+	if a.KID != kid.DOCTYPEID {
+		return NotAliasOwnerError{ResponsibleErrorImpl{KID: kid.DOCTYPEID}}
+	}
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	if err = ib.stub.DelState(ib.CreateAliasKey(a.DOCTYPEID)); err != nil {
+		return errors.Wrap(err, "failed to delete the alias state")
+	}
+	kid.Alias = ""
+	kid.UpdatedTime = ts
+	if err = ib.PutKID(kid); err != nil {
+		return err
+	}
+	return ib.PutEvent(EventAliasReleased, kid.DOCTYPEID, ib.sn, ts)
+}
+
+// TransferAlias moves the alias of the owner KID to the KID which has no alias
+func (ib *IdentityStub) TransferAlias(kid *KID, a *Alias, to *KID) (*Alias, error) {
+	if a.KID != kid.DOCTYPEID {
+		return nil, NotAliasOwnerError{ResponsibleErrorImpl{KID: kid.DOCTYPEID}}
+	}
+	if to.Alias != "" {
+		return nil, AlreadyAliasedKIDError{ResponsibleErrorImpl{KID: to.DOCTYPEID}}
+	}
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	a.KID = to.DOCTYPEID
+	a.CreatedTime = ts
+	if err = ib.putAlias(a); err != nil {
+		return nil, err
+	}
+	kid.Alias = ""
+	kid.UpdatedTime = ts
+	if err = ib.PutKID(kid); err != nil {
+		return nil, err
+	}
+	to.Alias = a.DOCTYPEID
+	to.UpdatedTime = ts
+	if err = ib.PutKID(to); err != nil {
+		return nil, err
+	}
+	if err = ib.PutEvent(EventAliasReleased, kid.DOCTYPEID, ib.sn, ts); err != nil {
+		return nil, err
+	}
+	if err = ib.PutEvent(EventAliasClaimed, to.DOCTYPEID, "", ts); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (ib *IdentityStub) putAlias(a *Alias) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the alias")
+	}
+	if err = ib.stub.PutState(ib.CreateAliasKey(a.DOCTYPEID), data); err != nil {
+		return errors.Wrap(err, "failed to put the alias state")
+	}
+	return nil
+}
+
+// Claim
+
+// CreateClaimIssuerKey _
+func (ib *IdentityStub) CreateClaimIssuerKey(name string) string {
+	return "CLAIM_ISSUER_" + name
+}
+
+// GetClaimIssuer retrieves the claim issuer of the invoker's certificate attribute, and checks the MSP ID
+func (ib *IdentityStub) GetClaimIssuer() (*ClaimIssuer, error) {
+	if "" == ib.issuer {
+		return nil, NotClaimIssuerError{}
+	}
+	data, err := ib.stub.GetState(ib.CreateClaimIssuerKey(ib.issuer))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the claim issuer state")
+	}
+	if nil == data {
+		return nil, NotClaimIssuerError{}
+	}
+	ci := &ClaimIssuer{}
+	if err = json.Unmarshal(data, ci); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the claim issuer")
+	}
+	if ci.MSPID != ib.mspID {
+		return nil, NotClaimIssuerError{}
+	}
+	return ci, nil
+}
+
+// PutClaimIssuer writes the claim issuer into the ledger
+func (ib *IdentityStub) PutClaimIssuer(ci *ClaimIssuer) error {
+	data, err := json.Marshal(ci)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the claim issuer")
+	}
+	if err = ib.stub.PutState(ib.CreateClaimIssuerKey(ci.DOCTYPEID), data); err != nil {
+		return errors.Wrap(err, "failed to put the claim issuer state")
+	}
+	return nil
+}
+
+// DelClaimIssuer removes the claim issuer from the ledger. The claims issued remain, but are not valid.
+func (ib *IdentityStub) DelClaimIssuer(name string) error {
+	if err := ib.stub.DelState(ib.CreateClaimIssuerKey(name)); err != nil {
+		return errors.Wrap(err, "failed to delete the claim issuer state")
+	}
+	return nil
+}
+
+// CreateClaimKey _
+func (ib *IdentityStub) CreateClaimKey(kid, typ, issuer string) (string, error) {
+	key, err := ib.stub.CreateCompositeKey(ClaimObjectType, []string{kid, typ, issuer})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create the claim key")
+	}
+	return key, nil
+}
+
+// GetClaim retrieves the claim of the issuer from the ledger
+func (ib *IdentityStub) GetClaim(kid, typ, issuer string) (*Claim, error) {
+	key, err := ib.CreateClaimKey(kid, typ, issuer)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ib.stub.GetState(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the claim state")
+	}
+	if nil == data {
+		return nil, NoClaimError{ResponsibleErrorImpl{KID: kid}}
+	}
+	c := &Claim{}
+	if err = json.Unmarshal(data, c); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the claim")
+	}
+	return c, nil
+}
+
+// SetClaim adds or updates the claim of the invoker's issuer, and writes it into the ledger
+func (ib *IdentityStub) SetClaim(ci *ClaimIssuer, kid, typ, value string, expiry *txtime.Time) (*Claim, error) {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	c, err := ib.GetClaim(kid, typ, ci.DOCTYPEID)
+	if err != nil {
+		if _, ok := err.(NoClaimError); !ok {
+			return nil, err
+		}
+		c = NewClaim(kid, typ, ci.DOCTYPEID)
+		c.CreatedTime = ts
+	}
+	c.Value = value
+	c.IssuerMSP = ci.MSPID
+	c.IssuerSN = ib.sn
+	c.ExpiryTime = expiry
+	c.UpdatedTime = ts
+	c.RevokedTime = nil
+	if err = ib.PutClaim(c); err != nil {
+		return nil, err
+	}
+	if err = ib.PutEvent(EventClaimSet, kid, "", ts); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// RevokeClaim revokes the claim and writes it into the ledger. The revocation remains in the claims list.
+func (ib *IdentityStub) RevokeClaim(c *Claim) error {
+	if c.RevokedTime != nil {
+		return AlreadyRevokedClaimError{ResponsibleErrorImpl{KID: c.DOCTYPEID}}
+	}
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the timestamp")
+	}
+	c.IssuerSN = ib.sn
+	c.UpdatedTime = ts
+	c.RevokedTime = ts
+	if err = ib.PutClaim(c); err != nil {
+		return err
+	}
+	return ib.PutEvent(EventClaimRevoked, c.DOCTYPEID, "", ts)
+}
+
+// PutClaim writes the claim into the ledger
+func (ib *IdentityStub) PutClaim(c *Claim) error {
+	key, err := ib.CreateClaimKey(c.DOCTYPEID, c.Type, c.Issuer)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the claim")
+	}
+	if err = ib.stub.PutState(key, data); err != nil {
+		return errors.Wrap(err, "failed to put the claim state")
+	}
+	return nil
+}
+
+// GetClaimList returns the claims of the KID, including the revoked and expired
+func (ib *IdentityStub) GetClaimList(kid string) (*ClaimList, error) {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+	claims, err := ib.getClaims(kid)
+	if err != nil {
+		return nil, err
+	}
+	issuers, err := ib.getClaimIssuers(claims)
+	if err != nil {
+		return nil, err
+	}
+	cl := &ClaimList{Records: []*ClaimRecord{}}
+	for _, c := range claims {
+		cl.Records = append(cl.Records, &ClaimRecord{Claim: c, IsValid: c.IsIssuedBy(issuers[c.Issuer]) && c.IsValid(ts)})
+	}
+	return cl, nil
+}
+
+// CheckClaim returns the valid claims of the type, with the value and the issuer if not empty
+func (ib *IdentityStub) CheckClaim(kid, typ, value, issuer string) (*ClaimCheck, error) {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+	claims, err := ib.getClaims(kid, typ)
+	if err != nil {
+		return nil, err
+	}
+	issuers, err := ib.getClaimIssuers(claims)
+	if err != nil {
+		return nil, err
+	}
+	cc := &ClaimCheck{KID: kid, Type: typ, Claims: []*Claim{}}
+	for _, c := range claims {
+		if c.IsIssuedBy(issuers[c.Issuer]) && c.IsValid(ts) && (value == "" || c.Value == value) && (issuer == "" || c.Issuer == issuer) {
+			cc.Claims = append(cc.Claims, c)
+		}
+	}
+	cc.HasClaim = len(cc.Claims) > 0
+	return cc, nil
+}
+
+// returns the registered issuers of the claims, nil if removed.
+// The claims of the removed issuer are not valid.
+func (ib *IdentityStub) getClaimIssuers(claims []*Claim) (map[string]*ClaimIssuer, error) {
+	issuers := map[string]*ClaimIssuer{}
+	for _, c := range claims {
+		if _, ok := issuers[c.Issuer]; ok {
+			continue
+		}
+		data, err := ib.stub.GetState(ib.CreateClaimIssuerKey(c.Issuer))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get the claim issuer state")
+		}
+		if nil == data {
+			issuers[c.Issuer] = nil
+			continue
+		}
+		ci := &ClaimIssuer{}
+		if err = json.Unmarshal(data, ci); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal the claim issuer")
+		}
+		issuers[c.Issuer] = ci
+	}
+	return issuers, nil
+}
+
+// returns the claims of the partial composite key
+func (ib *IdentityStub) getClaims(attrs ...string) ([]*Claim, error) {
+	iter, err := ib.stub.GetStateByPartialCompositeKey(ClaimObjectType, attrs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the claim states")
+	}
+	defer iter.Close()
+
+	claims := []*Claim{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get the claim states")
+		}
+		c := &Claim{}
+		if err = json.Unmarshal(kv.Value, c); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal the claim")
+		}
+		claims = append(claims, c)
+	}
+	return claims, nil
+}
+
+// DID
+
+// CreateDIDServicesKey _
+func (ib *IdentityStub) CreateDIDServicesKey(kid string) string {
+	return "DID_SERVICE_" + kid
+}
+
+// GetDIDServices retrieves the DID services of the KID from the ledger, empty if none
+func (ib *IdentityStub) GetDIDServices(kid string) (*DIDServices, error) {
+	data, err := ib.stub.GetState(ib.CreateDIDServicesKey(kid))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the DID services state")
+	}
+	ds := NewDIDServices(kid)
+	if nil == data {
+		return ds, nil
+	}
+	if err = json.Unmarshal(data, ds); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the DID services")
+	}
+	return ds, nil
+}
+
+// PutDIDServices writes the DID services into the ledger
+func (ib *IdentityStub) PutDIDServices(ds *DIDServices) error {
+	data, err := json.Marshal(ds)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the DID services")
+	}
+	if err = ib.stub.PutState(ib.CreateDIDServicesKey(ds.DOCTYPEID), data); err != nil {
+		return errors.Wrap(err, "failed to put the DID services state")
+	}
+	return nil
+}
+
+// GetDIDDocument builds the DID Document of the KID with its certificates and services
+func (ib *IdentityStub) GetDIDDocument(kid *KID) (*DIDDocument, error) {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+	certs, err := ib.getCertificates(kid.DOCTYPEID, "")
+	if err != nil {
+		return nil, err
+	}
+	ds, err := ib.GetDIDServices(kid.DOCTYPEID)
+	if err != nil {
+		return nil, err
+	}
+	return NewDIDDocument(kid, certs, ds, ts)
+}
+
+// VerifySignature verifies the signature of the digest with the certificate of the SN,
+// or any active certificate of the KID. The revoked and expired certificates don't verify,
+// neither do the other certificates while the KID is locked.
+func (ib *IdentityStub) VerifySignature(kid *KID, sn string, digest, sig []byte) (*SignatureVerification, error) {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+	var certs []*Certificate
+	if SignatureAnyActive == sn {
+		if certs, err = ib.getCertificates(kid.DOCTYPEID, CertificateActive); err != nil {
+			return nil, err
+		}
+	} else {
+		cert, err := ib.GetCertificate(kid.DOCTYPEID, sn)
+		if err != nil {
+			return nil, err
+		}
+		certs = []*Certificate{cert}
+	}
+
+	sv := &SignatureVerification{KID: kid.DOCTYPEID}
+	locked := kid.IsLocked(ts)
+	for _, cert := range certs {
+		if cert.RevokedTime != nil || cert.IsExpired(ts) || "" == cert.PublicKey || (locked && cert.SN != kid.Lock) {
+			continue
+		}
+		ok, err := VerifySignature(cert.PublicKey, digest, sig)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to verify the signature")
+		}
+		if ok {
+			sv.SN = cert.SN
+			sv.Verified = true
+			break
+		}
+	}
+	return sv, nil
+}
+
+// Guardian
+
+// CreateGuardianSetKey _
+func (ib *IdentityStub) CreateGuardianSetKey(kid string) string {
+	return "GUARDIAN_" + kid
+}
+
+// GetGuardianSet retrieves the guardians of the KID from the ledger
+func (ib *IdentityStub) GetGuardianSet(kid string) (*GuardianSet, error) {
+	data, err := ib.stub.GetState(ib.CreateGuardianSetKey(kid))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the guardian state")
+	}
+	if nil == data {
+		return nil, NoGuardianError{ResponsibleErrorImpl{KID: kid}}
+	}
+	gs := &GuardianSet{}
+	if err = json.Unmarshal(data, gs); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the guardians")
+	}
+	return gs, nil
+}
+
+// PutGuardianSet writes the guardians into the ledger
+func (ib *IdentityStub) PutGuardianSet(gs *GuardianSet) error {
+	data, err := json.Marshal(gs)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the guardians")
+	}
+	if err = ib.stub.PutState(ib.CreateGuardianSetKey(gs.DOCTYPEID), data); err != nil {
+		return errors.Wrap(err, "failed to put the guardian state")
+	}
+	return ib.PutEvent(EventGuardianUpdated, gs.DOCTYPEID, ib.sn, gs.UpdatedTime)
+}
+
+// DelGuardianSet removes the guardians of the KID from the ledger
+func (ib *IdentityStub) DelGuardianSet(kid string, ts *txtime.Time) error {
+	if err := ib.stub.DelState(ib.CreateGuardianSetKey(kid)); err != nil {
+		return errors.Wrap(err, "failed to delete the guardian state")
+	}
+	return ib.PutEvent(EventGuardianUpdated, kid, ib.sn, ts)
+}
+
+// Recovery
+
+// CreateRecoveryKey _
+func (ib *IdentityStub) CreateRecoveryKey(kid string) string {
+	return "RECOVERY_" + kid
+}
+
+// CreateRecovery creates the recovery request of the KID with the invoker's certificate, and writes it into the ledger
+func (ib *IdentityStub) CreateRecovery(kid *KID, revoke bool) (*Recovery, error) {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	r := NewRecovery(kid.DOCTYPEID)
+	r.Key = ib.GetKIDKey(kid)
+	r.UUID = ib.uuid
+	r.SN = ib.sn
+	r.Revoke = revoke
+	r.CreatedTime = ts
+	r.ExpiryTime = txtime.New(ts.Add(RecoveryRequestTTL * time.Second))
+	if err = ib.PutRecovery(r); err != nil {
+		return nil, err
+	}
+	if err = ib.PutEvent(EventRecoveryRequested, kid.DOCTYPEID, ib.sn, ts); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetRecovery retrieves the recovery request of the KID from the ledger
+func (ib *IdentityStub) GetRecovery(kid string) (*Recovery, error) {
+	data, err := ib.stub.GetState(ib.CreateRecoveryKey(kid))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the recovery state")
+	}
+	if nil == data {
+		return nil, NoRecoveryError{ResponsibleErrorImpl{KID: kid}}
+	}
+	r := &Recovery{}
+	if err = json.Unmarshal(data, r); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the recovery")
+	}
+	return r, nil
+}
+
+// PutRecovery writes the recovery request into the ledger
+func (ib *IdentityStub) PutRecovery(r *Recovery) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the recovery")
+	}
+	if err = ib.stub.PutState(ib.CreateRecoveryKey(r.DOCTYPEID), data); err != nil {
+		return errors.Wrap(err, "failed to put the recovery state")
+	}
+	return nil
+}
+
+// ApproveRecovery adds the approval of the guardian.
+// The waiting period begins when the approvals meet the threshold.
+func (ib *IdentityStub) ApproveRecovery(r *Recovery, gs *GuardianSet, guardian string) error {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the timestamp")
+	}
+	r.Approvals = append(r.Approvals, guardian)
+	if nil == r.ApprovedTime && r.CountApprovals(gs) >= gs.Threshold {
+		r.ApprovedTime = ts
+		r.EffectiveTime = txtime.New(ts.Add(time.Duration(gs.Delay) * time.Second))
+	}
+	if err = ib.PutRecovery(r); err != nil {
+		return err
+	}
+	return ib.PutEvent(EventRecoveryApproved, r.DOCTYPEID, ib.sn, ts)
+}
+
+// CancelRecovery removes the recovery request from the ledger
+func (ib *IdentityStub) CancelRecovery(r *Recovery) error {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the timestamp")
+	}
+	if err = ib.stub.DelState(ib.CreateRecoveryKey(r.DOCTYPEID)); err != nil {
+		return errors.Wrap(err, "failed to delete the recovery state")
+	}
+	return ib.PutEvent(EventRecoveryCancelled, r.DOCTYPEID, ib.sn, ts)
+}
+
+// RejectRecovery removes the recovery request rejected by the guardian from the ledger
+func (ib *IdentityStub) RejectRecovery(r *Recovery) error {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the timestamp")
+	}
+	if err = ib.stub.DelState(ib.CreateRecoveryKey(r.DOCTYPEID)); err != nil {
+		return errors.Wrap(err, "failed to delete the recovery state")
+	}
+	return ib.PutEvent(EventRecoveryRejected, r.DOCTYPEID, ib.sn, ts)
+}
+
+// RecoverKID attaches the invoker's certificate to the KID, clears the lock,
+// revokes the other certificates if requested, and consumes the recovery.
+func (ib *IdentityStub) RecoverKID(r *Recovery) (*KID, *Certificate, error) {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	data, err := ib.stub.GetState(r.Key)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to get the KID state")
+	}
+	if nil == data {
+		return nil, nil, NotRegisteredKIDError{ResponsibleErrorImpl{KID: r.DOCTYPEID}}
+	}
+	kid := &KID{}
+	if err = json.Unmarshal(data, kid); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to unmarshal the KID")
+	}
+	kid.key = r.Key
+
+	// KID_ pointer of the new device
+	if ib.CreateKIDKey() != r.Key {
+		current, err := ib.ReadKID()
+		if err != nil {
+			if _, ok := err.(NotRegisteredCertificateError); !ok {
+				return nil, nil, err
+			}
+			if err = ib.putKIDPointer(kid, ts); err != nil {
+				return nil, nil, err
+			}
+		} else if current.DOCTYPEID != kid.DOCTYPEID {
+			return nil, nil, errors.New("already registered KID")
+		}
+	}
+
+	// new certificate
+	cert, err := ib.GetCertificate(kid.DOCTYPEID, "")
+	if err != nil {
+		if _, ok := err.(NotRegisteredCertificateError); !ok {
+			return nil, nil, err
+		}
+		if cert, err = ib.CreateCertificate(kid.DOCTYPEID); err != nil {
+			return nil, nil, err
+		}
+	} else if cert.RevokedTime != nil {
+		if err = ib.ReactivateCertificate(cert); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// old certificates
+	if r.Revoke {
+		certs, err := ib.getActiveCertificates(kid.DOCTYPEID)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, c := range certs {
+			if c.SN != cert.SN {
+				if err = ib.RevokeCertificate(c); err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+	}
+
+	kid.Lock = ""
+	kid.LockExpiryTime = nil
+	kid.UpdatedTime = ts
+	if err = ib.PutKID(kid); err != nil {
+		return nil, nil, err
+	}
+	if err = ib.stub.DelState(ib.CreateRecoveryKey(r.DOCTYPEID)); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to delete the recovery state")
+	}
+	if err = ib.PutEvent(EventKIDRecovered, kid.DOCTYPEID, ib.sn, ts); err != nil {
+		return nil, nil, err
+	}
+
+	return kid, cert, nil
+}
+
+// Certificate
+
+// CertificatesFetchSize _
+const CertificatesFetchSize = 20
+
+// CreateCertificateKey _
+func (ib *IdentityStub) CreateCertificateKey(kid string, sn string) string {
+	return fmt.Sprintf("CERT_%s_%s", kid, sn)
+}
+
+// CreateCertificate creates new certificate and writes it into the ledger
+func (ib *IdentityStub) CreateCertificate(kid string) (*Certificate, error) {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	cert := NewCertificate(kid, ib.sn)
+	cert.SetDetails(ib.cert)
+	cert.CreatedTime = ts
+	if err = ib.PutCertificate(cert); err != nil {
+		return nil, err
+	}
+	if err = ib.PutEvent(EventCertRegistered, kid, ib.sn, ts); err != nil {
+		return nil, err
+	}
+
+	return cert, nil
+}
+
+// GetCertificate retrieves the certificate from the ledger
+func (ib *IdentityStub) GetCertificate(kid string, sn string) (*Certificate, error) {
+	if "" == sn {
+		sn = ib.sn
+	}
+	data, err := ib.stub.GetState(ib.CreateCertificateKey(kid, sn))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the certificate state")
+	}
+	if data != nil {
+		cert := &Certificate{}
+		if err = json.Unmarshal(data, cert); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal the certificate")
+		}
+		return cert, nil
+	}
+	return nil, NotRegisteredCertificateError{ResponsibleErrorImpl{KID: kid, SN: sn}}
+}
+
+// GetQueryCertificatesResult returns a page of the KID's certificates with the list options.
+// The records mark the invoker's certificate and the certificate holding the lock.
+// Without the time range and the sort order, it uses the certificate index instead of the rich query.
+func (ib *IdentityStub) GetQueryCertificatesResult(kid *KID, opts *ListOptions, bookmark string) (*QueryResult, error) {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	var certs []*Certificate
+	var meta *peer.QueryResponseMetadata
+	if opts.RequiresRichQuery() {
+		certs, meta, err = ib.queryCertificates(kid.DOCTYPEID, opts, bookmark)
+	} else {
+		certs, meta, err = ib.getIndexedCertificates(kid.DOCTYPEID, opts, bookmark)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &QueryResult{Meta: meta}
+	if result.Records, err = ib.marshalCertificateRecords(kid, certs, ts); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetExpiringCertificatesResult returns the active certificates of the KID
+// whose X.509 validity ends before the time, in the order of the expiry.
+// The certificates without the details are excluded.
+func (ib *IdentityStub) GetExpiringCertificatesResult(kid *KID, until *txtime.Time) (*QueryResult, error) {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	certs, err := ib.getActiveCertificates(kid.DOCTYPEID)
+	if err != nil {
+		return nil, err
+	}
+	expiring := []*Certificate{}
+	for _, cert := range certs {
+		if cert.NotAfter != nil && cert.NotAfter.Cmp(until) < 0 {
+			expiring = append(expiring, cert)
+		}
+	}
+	sort.SliceStable(expiring, func(i, j int) bool {
+		return expiring[i].NotAfter.Cmp(expiring[j].NotAfter) < 0
+	})
+
+	result := &QueryResult{Meta: &peer.QueryResponseMetadata{FetchedRecordsCount: int32(len(expiring))}}
+	if result.Records, err = ib.marshalCertificateRecords(kid, expiring, ts); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (ib *IdentityStub) marshalCertificateRecords(kid *KID, certs []*Certificate, ts *txtime.Time) ([]byte, error) {
+	records := make([]*CertificateRecord, 0, len(certs))
+	for _, cert := range certs {
+		records = append(records, &CertificateRecord{
+			Certificate: cert,
+			IsCurrent:   cert.SN == ib.sn,
+			IsLocking:   cert.SN == kid.Lock && kid.IsLocked(ts),
+			IsExpired:   cert.IsExpired(ts),
+		})
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal the certificates")
+	}
+	return data, nil
+}
+
+// CouchDB only
+func (ib *IdentityStub) queryCertificates(kid string, opts *ListOptions, bookmark string) ([]*Certificate, *peer.QueryResponseMetadata, error) {
+	query := CreateQueryCertificates(kid, opts)
+	iter, meta, err := ib.stub.GetQueryResultWithPagination(query, int32(opts.PageSize), bookmark)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer iter.Close()
+
+	certs := []*Certificate{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		cert := &Certificate{}
+		if err = json.Unmarshal(kv.Value, cert); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to unmarshal the certificate")
+		}
+		certs = append(certs, cert)
+	}
+	return certs, meta, nil
+}
+
+// returns a page of the certificates by the index.
+// Until the index is complete (admin_reindex), it queries the certificates as before the index (CouchDB).
+func (ib *IdentityStub) getIndexedCertificates(kid string, opts *ListOptions, bookmark string) ([]*Certificate, *peer.QueryResponseMetadata, error) {
+	complete, err := ib.isCertificateIndexComplete()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !complete {
+		return ib.queryCertificates(kid, opts, bookmark)
+	}
+
+	attrs := []string{kid}
+	switch opts.Revoked {
+	case RevokedExclude:
+		attrs = append(attrs, CertificateActive)
+	case RevokedOnly:
+		attrs = append(attrs, CertificateRevoked)
+	}
+	iter, meta, err := ib.stub.GetStateByPartialCompositeKeyWithPagination(CertificateIndex, attrs, int32(opts.PageSize), bookmark)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer iter.Close()
+
+	certs, err := ib.getCertificatesByIndex(iter)
+	if err != nil {
+		return nil, nil, err
+	}
+	return certs, meta, nil
+}
+
+// returns the certificates of the index keys
+func (ib *IdentityStub) getCertificatesByIndex(iter shim.StateQueryIteratorInterface) ([]*Certificate, error) {
+	certs := []*Certificate{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attrs, err := ib.stub.SplitCompositeKey(kv.Key)
+		if err != nil || len(attrs) != 3 {
+			return nil, errors.Errorf("invalid certificate index [%s]", kv.Key)
+		}
+		cert, err := ib.GetCertificate(attrs[0], attrs[2])
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// HasActiveCertificate checks whether the KID has an active certificate except the 'sn'
+func (ib *IdentityStub) HasActiveCertificate(kid, sn string) (bool, error) {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get the timestamp")
+	}
+	certs, err := ib.getActiveCertificates(kid)
+	if err != nil {
+		return false, err
+	}
+	for _, cert := range certs {
+		if cert.SN != sn && !cert.IsExpired(ts) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (ib *IdentityStub) getActiveCertificates(kid string) ([]*Certificate, error) {
+	return ib.getCertificates(kid, CertificateActive)
+}
+
+// returns the certificates of the KID, of the status if not empty.
+// Until the index is complete (admin_reindex), it scans the certificate states of the KID.
+func (ib *IdentityStub) getCertificates(kid, status string) ([]*Certificate, error) {
+	complete, err := ib.isCertificateIndexComplete()
+	if err != nil {
+		return nil, err
+	}
+	if complete {
+		attrs := []string{kid}
+		if status != "" {
+			attrs = append(attrs, status)
+		}
+		iter, err := ib.stub.GetStateByPartialCompositeKey(CertificateIndex, attrs)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get the certificate index")
+		}
+		defer iter.Close()
+		return ib.getCertificatesByIndex(iter)
+	}
+
+	prefix := ib.CreateCertificateKey(kid, "")
+	iter, err := ib.stub.GetStateByRange(prefix, strings.TrimSuffix(prefix, "_")+"`") // '`' is next to '_'
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the certificate states")
+	}
+	defer iter.Close()
+
+	certs := []*Certificate{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get the certificate states")
+		}
+		cert := &Certificate{}
+		if err = json.Unmarshal(kv.Value, cert); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal the certificate")
+		}
+		if "" == status || cert.Status() == status {
+			certs = append(certs, cert)
+		}
+	}
+	return certs, nil
+}
+
+// returns whether the index has all certificates, marked by the backfill
+func (ib *IdentityStub) isCertificateIndexComplete() (bool, error) {
+	data, err := ib.stub.GetState(CertificateIndexCompleteKey)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get the certificate index state")
+	}
+	return data != nil, nil
+}
+
+// PutCertificate writes the certificate and its index into the ledger
+func (ib *IdentityStub) PutCertificate(cert *Certificate) error {
+	data, err := json.Marshal(cert)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the certificate")
+	}
+	if err = ib.stub.PutState(ib.CreateCertificateKey(cert.DOCTYPEID, cert.SN), data); err != nil {
+		return errors.Wrap(err, "failed to put the certificate state")
+	}
+	return ib.putCertificateIndex(cert)
+}
+
+// writes the index key of the certificate's status, and removes the other status's
+func (ib *IdentityStub) putCertificateIndex(cert *Certificate) error {
+	for _, status := range []string{CertificateActive, CertificateRevoked} {
+		key, err := ib.stub.CreateCompositeKey(CertificateIndex, []string{cert.DOCTYPEID, status, cert.SN})
+		if err != nil {
+			return errors.Wrap(err, "failed to create the certificate index key")
+		}
+		if status == cert.Status() {
+			err = ib.stub.PutState(key, CertificateIndexValue)
+		} else {
+			err = ib.stub.DelState(key)
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to put the certificate index state")
+		}
+	}
+	key, err := ib.stub.CreateCompositeKey(CertificateSNIndex, []string{cert.SN, cert.DOCTYPEID})
+	if err != nil {
+		return errors.Wrap(err, "failed to create the serial number index key")
+	}
+	if err = ib.stub.PutState(key, CertificateIndexValue); err != nil {
+		return errors.Wrap(err, "failed to put the serial number index state")
+	}
+	return nil
+}
+
+// returns the KIDs of the certificates of the serial number
+func (ib *IdentityStub) getKIDsBySN(sn string) ([]string, error) {
+	iter, err := ib.stub.GetStateByPartialCompositeKey(CertificateSNIndex, []string{sn})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the serial number index")
+	}
+	defer iter.Close()
+
+	kids := []string{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get the serial number index")
+		}
+		_, attrs, err := ib.stub.SplitCompositeKey(kv.Key)
+		if err != nil || len(attrs) != 2 {
+			return nil, errors.Errorf("invalid serial number index [%s]", kv.Key)
+		}
+		kids = append(kids, attrs[1])
+	}
+	return kids, nil
+}
+
+// ReindexCertificates writes the index of the certificates from the start key, up to the limit.
+// It backfills the index of the certificates created before the index. Reaching the end marks the index complete.
+func (ib *IdentityStub) ReindexCertificates(start string, limit int) (*ReindexResult, error) {
+	if "" == start {
+		start = "CERT_"
+	}
+	iter, err := ib.stub.GetStateByRange(start, "CERT`") // '`' is next to '_'
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the certificate states")
+	}
+	defer iter.Close()
+
+	rr := &ReindexResult{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get the certificate states")
+		}
+		if rr.Indexed >= limit {
+			rr.Bookmark = kv.Key
+			break
+		}
+		cert := &Certificate{}
+		if err = json.Unmarshal(kv.Value, cert); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal the certificate")
+		}
+		if err = ib.putCertificateIndex(cert); err != nil {
+			return nil, err
+		}
+		rr.Indexed++
+	}
+	if "" == rr.Bookmark { // all indexed
+		ts, err := txtime.GetTime(ib.stub)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get the timestamp")
+		}
+		if err = ib.stub.PutState(CertificateIndexCompleteKey, []byte(ts.String())); err != nil {
+			return nil, errors.Wrap(err, "failed to put the certificate index state")
+		}
+	}
+	return rr, nil
+}
+
+// RevokeCertificate revokes the certificate and writes it into the ledger
+func (ib *IdentityStub) RevokeCertificate(cert *Certificate) error {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the timestamp")
+	}
+	cert.RevokedTime = ts
+	cert.RevocationReason = ""
+	if err = ib.PutCertificate(cert); err != nil {
+		return errors.Wrap(err, "failed to revoke the certificate")
+	}
+	return ib.PutEvent(EventCertRevoked, cert.DOCTYPEID, cert.SN, ts)
+}
+
+// ImportCRL revokes the registered certificates in the CRL with the revocation time and reason of the CRL.
+// The certificates of other issuers are not revoked. The KIDs locked by the revoked certificates are unlocked.
+func (ib *IdentityStub) ImportCRL(crl *CRL) (*CRLImportResult, error) {
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the timestamp")
+	}
+
+	cr := NewCRLImportResult(crl)
+	imported := map[string]bool{} // the ledger doesn't read the writes of the transaction
+	for _, entry := range crl.Entries() {
+		sn := CRLEntrySN(entry)
+		kids, err := ib.getKIDsBySN(sn)
+		if err != nil {
+			return nil, err
+		}
+		for _, kid := range kids {
+			if imported[kid+sn] {
+				continue
+			}
+			imported[kid+sn] = true
+			cert, err := ib.GetCertificate(kid, sn)
+			if err != nil {
+				return nil, err
+			}
+			m := &CRLMatch{KID: kid, SN: sn}
+			if !crl.Issues(cert) {
+				cr.Mismatched = append(cr.Mismatched, m)
+				continue
+			}
+			m.Reason = CRLEntryReason(entry)
+			if cert.RevokedTime != nil {
+				if "" == cert.RevocationReason { // revoked by the user, keeps the time
+					cert.RevocationReason = m.Reason
+					if err = ib.PutCertificate(cert); err != nil {
+						return nil, errors.Wrap(err, "failed to revoke the certificate")
+					}
+				}
+				cr.AlreadyRevoked = append(cr.AlreadyRevoked, m)
+			} else {
+				cert.RevokedTime = txtime.New(entry.RevocationTime.UTC())
+				cert.RevocationReason = m.Reason
+				if err = ib.PutCertificate(cert); err != nil {
+					return nil, errors.Wrap(err, "failed to revoke the certificate")
+				}
+				if err = ib.PutEvent(EventCertRevoked, kid, sn, ts); err != nil {
+					return nil, err
+				}
+				cr.Revoked = append(cr.Revoked, m)
+			}
+			unlocked, err := ib.unlockRevoked(kid, sn, ts)
+			if err != nil {
+				return nil, err
+			}
+			if unlocked {
+				cr.Unlocked = append(cr.Unlocked, m)
+			}
+		}
+	}
+	return cr, nil
+}
+
+// clears the lock of the KID held by the revoked certificate, nothing could unlock it.
+func (ib *IdentityStub) unlockRevoked(id, sn string, ts *txtime.Time) (bool, error) {
+	kid, err := ib.GetKIDByID(id)
+	if err != nil {
+		if _, ok := err.(NotRegisteredKIDError); ok { // private KID doesn't support the lock
+			return false, nil
+		}
+		return false, err
+	}
+	if kid.Lock != sn {
+		return false, nil
+	}
+	kid.Lock = ""
+	kid.LockExpiryTime = nil
+	kid.UpdatedTime = ts
+	if err = ib.PutKID(kid); err != nil {
+		return false, errors.Wrap(err, "failed to unlock the KID")
+	}
+	if err = ib.PutEvent(EventKIDUnlocked, id, sn, ts); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ReactivateCertificate reactivates the revoked certificate and writes it into the ledger.
+// The revocation remains in the history of the certificate.
+// The details are recorded if the certificate has none (or no public key) and is the invoker's.
+// The certificate revoked by the CRL (with the reason) can't be reactivated.
+func (ib *IdentityStub) ReactivateCertificate(cert *Certificate) error {
+	if cert.RevocationReason != "" {
+		return RevokedByCAError{ResponsibleErrorImpl{KID: cert.DOCTYPEID, SN: cert.SN}}
+	}
+	ts, err := txtime.GetTime(ib.stub)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the timestamp")
+	}
+	if (!cert.HasDetails() || "" == cert.PublicKey) && cert.SN == ib.sn { // registered before the details or the public key
+		cert.SetDetails(ib.cert)
+	}
+	if cert.IsExpired(ts) {
+		return ExpiredCertificateError{ResponsibleErrorImpl{KID: cert.DOCTYPEID, SN: cert.SN}}
+	}
+	cert.RevokedTime = nil
+	cert.ReactivatedTime = ts
+	cert.ReactivatedCount++
+	if err = ib.PutCertificate(cert); err != nil {
+		return errors.Wrap(err, "failed to reactivate the certificate")
+	}
+	return ib.PutEvent(EventCertReactivated, cert.DOCTYPEID, cert.SN, ts)
+}
+
+// Event
+
+// PutEvent adds the event and sets the chaincode event with all events of the transaction.
+func (ib *IdentityStub) PutEvent(typ, kid, sn string, ts *txtime.Time) error {
+	ib.events = append(ib.events, &Event{Type: typ, KID: kid, SN: sn, TxTime: ts})
+	data, err := NewEventPayload(ib.events).MarshalPayload()
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the event")
+	}
+	if err = ib.stub.SetEvent(EventName, data); err != nil {
+		return errors.Wrap(err, "failed to set the event")
+	}
+	return nil
+}
+
+// History
+
+// HistoryFetchSize _
+const HistoryFetchSize = 20
+
+// GetKIDHistoryResult returns the history of the KID state
+func (ib *IdentityStub) GetKIDHistoryResult(kid *KID, bookmark string) (*QueryResult, error) {
+	return ib.getHistoryResult(ib.GetKIDKey(kid), bookmark)
+}
+
+// GetCertificateHistoryResult returns the history of the certificate state
+func (ib *IdentityStub) GetCertificateHistoryResult(kid, sn, bookmark string) (*QueryResult, error) {
+	return ib.getHistoryResult(ib.CreateCertificateKey(kid, sn), bookmark)
+}
+
+func (ib *IdentityStub) getHistoryResult(key, bookmark string) (*QueryResult, error) {
+	iter, err := ib.stub.GetHistoryForKey(key)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	return NewHistoryQueryResult(iter, HistoryFetchSize, bookmark)
 }
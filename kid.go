@@ -5,19 +5,31 @@ package main
 import (
 	"encoding/hex"
 	"encoding/json"
+	"regexp"
 
 	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
 	"golang.org/x/crypto/sha3"
 )
 
+// LockMaxSeconds is the max duration of the lock in seconds (10 years)
+const LockMaxSeconds = 10 * 365 * 24 * 60 * 60
+
+// hex of the 20 bytes hash
+var kidRegexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
 // KID _
 type KID struct {
-	DOCTYPEID   string       `json:"@kid"`
-	Lock        string       `json:"lock,omitempty"`
-	Pin         *PIN         `json:"pin,omitempty"`
-	CreatedTime *txtime.Time `json:"created_time,omitempty"`
-	UpdatedTime *txtime.Time `json:"updated_time,omitempty"`
-	isPriv      bool
+	DOCTYPEID      string       `json:"@kid"`
+	Lock           string       `json:"lock,omitempty"`
+	LockExpiryTime *txtime.Time `json:"lock_expiry_time,omitempty"` // nil: never expire
+	Pin            *PIN         `json:"pin,omitempty"`
+	Link           string       `json:"link,omitempty"` // state key of the linked KID
+	Alias          string       `json:"alias,omitempty"`
+	CreatedTime    *txtime.Time `json:"created_time,omitempty"`
+	UpdatedTime    *txtime.Time `json:"updated_time,omitempty"`
+	isPriv         bool
+	key            string // state key
 }
 
 // NewKID _
@@ -34,6 +46,27 @@ func (kid *KID) CreateHash(rawID string) string {
 	return hex.EncodeToString(h)
 }
 
+// ValidateKID validates the form of the KID
+func ValidateKID(id string) error {
+	if !kidRegexp.MatchString(id) {
+		return errors.New("invalid KID. expecting 40 lowercase hex characters")
+	}
+	return nil
+}
+
+// IsLocked returns whether the lock is valid at the time
+func (kid *KID) IsLocked(ts *txtime.Time) bool {
+	if kid.Lock == "" {
+		return false
+	}
+	return nil == kid.LockExpiryTime || kid.LockExpiryTime.Cmp(ts) > 0
+}
+
+// HasPIN returns whether the old-style KID has the non-empty PIN, without the scrypt hashing
+func (kid *KID) HasPIN() bool {
+	return kid.Pin != nil && !kid.Pin.IsEmpty()
+}
+
 // MarshalPayload _
 func (kid *KID) MarshalPayload() ([]byte, error) {
 	if kid.isPriv {
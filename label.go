@@ -0,0 +1,75 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// limits of the certificate label and metadata
+const (
+	LabelMaxLength         = 32 // characters
+	MetadataMaxSize        = 8  // entries
+	MetadataValueMaxLength = 64 // characters
+)
+
+var metadataKeyRegexp = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// ValidateLabel validates the nickname of the certificate. Empty removes the label.
+// The label consists of letters, digits, spaces and -_.'(), without leading or trailing spaces.
+func ValidateLabel(label string) error {
+	if utf8.RuneCountInString(label) > LabelMaxLength {
+		return errors.Errorf("invalid label. expecting up to %d characters", LabelMaxLength)
+	}
+	for _, r := range label {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != ' ' && !isLabelSymbol(r) {
+			return errors.New("invalid label. expecting letters, digits, spaces or -_.'()")
+		}
+	}
+	if label != "" && (label[0] == ' ' || label[len(label)-1] == ' ') {
+		return errors.New("invalid label. expecting no leading or trailing spaces")
+	}
+	return nil
+}
+
+func isLabelSymbol(r rune) bool {
+	switch r {
+	case '-', '_', '.', '\'', '(', ')':
+		return true
+	}
+	return false
+}
+
+// ParseMetadata parses JSON object of the device metadata (e.g. {"os":"android 9","app_version":"1.2.0"}).
+// The keys are lowercase letters, digits and '_', the values are printable characters.
+func ParseMetadata(data string) (map[string]string, error) {
+	md := map[string]string{}
+	if err := json.Unmarshal([]byte(data), &md); err != nil {
+		return nil, errors.New("invalid metadata. expecting JSON object of strings")
+	}
+	if len(md) > MetadataMaxSize {
+		return nil, errors.Errorf("invalid metadata. expecting up to %d entries", MetadataMaxSize)
+	}
+	for k, v := range md {
+		if !metadataKeyRegexp.MatchString(k) {
+			return nil, errors.Errorf("invalid metadata key [%s]", k)
+		}
+		if utf8.RuneCountInString(v) > MetadataValueMaxLength {
+			return nil, errors.Errorf("invalid metadata [%s]. expecting up to %d characters", k, MetadataValueMaxLength)
+		}
+		for _, r := range v {
+			if !unicode.IsPrint(r) {
+				return nil, errors.Errorf("invalid metadata [%s]. expecting printable characters", k)
+			}
+		}
+	}
+	if 0 == len(md) {
+		return nil, nil
+	}
+	return md, nil
+}
@@ -0,0 +1,81 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/sha3"
+)
+
+// LinkCodeMinLength _
+const LinkCodeMinLength = 12
+
+// hex SHA-256 of the certificate DER
+var fingerprintRegexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// link TTL (seconds)
+const (
+	LinkDefaultTTL = 300
+	LinkMaxTTL     = 3600
+)
+
+// Link is the pending pairing of a new device with the KID
+type Link struct {
+	DOCTYPEID   string       `json:"@link"` // hash of the code
+	KID         string       `json:"kid"`
+	Key         string       `json:"key"`         // state key of the KID
+	SN          string       `json:"sn"`          // certificate which began the link
+	Fingerprint string       `json:"fingerprint"` // certificate of the new device
+	CreatedTime *txtime.Time `json:"created_time,omitempty"`
+	ExpiryTime  *txtime.Time `json:"expiry_time,omitempty"`
+}
+
+// NewLink _
+func NewLink(code string) *Link {
+	return &Link{DOCTYPEID: CreateLinkHash(code)}
+}
+
+// CreateLinkHash _
+func CreateLinkHash(code string) string {
+	h := make([]byte, 32)
+	sha3.ShakeSum256(h, []byte("kiesnet-id/link|"+code))
+	return hex.EncodeToString(h)
+}
+
+// ValidateFingerprint validates the fingerprint of the new device's certificate
+func ValidateFingerprint(fingerprint string) error {
+	if !fingerprintRegexp.MatchString(fingerprint) {
+		return errors.New("invalid fingerprint. expecting hex SHA-256 of the certificate")
+	}
+	return nil
+}
+
+// IsFor returns whether the link is for the certificate of the new device
+func (link *Link) IsFor(cert *x509.Certificate) bool {
+	fp := sha256.Sum256(cert.Raw)
+	return link.Fingerprint == hex.EncodeToString(fp[:])
+}
+
+// MarshalPayload _
+func (link *Link) MarshalPayload() ([]byte, error) {
+	return json.Marshal(&struct {
+		KID         string       `json:"kid"`
+		SN          string       `json:"sn"`
+		Fingerprint string       `json:"fingerprint"`
+		CreatedTime *txtime.Time `json:"created_time,omitempty"`
+		ExpiryTime  *txtime.Time `json:"expiry_time,omitempty"`
+	}{
+		KID:         link.KID,
+		SN:          link.SN,
+		Fingerprint: link.Fingerprint,
+		CreatedTime: link.CreatedTime,
+		ExpiryTime:  link.ExpiryTime,
+	})
+}
@@ -0,0 +1,111 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
+)
+
+// CertificatesMaxFetchSize is the cap of the page size
+const CertificatesMaxFetchSize = 100
+
+// revoked filters
+const (
+	RevokedExclude = "exclude"
+	RevokedInclude = "include"
+	RevokedOnly    = "only"
+)
+
+// sort orders of the created time (empty: the order of the certificate index)
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// ListOptions is the options of the certificates list
+type ListOptions struct {
+	PageSize int    `json:"page_size"`
+	Revoked  string `json:"revoked"`
+	From     string `json:"from,omitempty"` // RFC3339, created_time >= from
+	To       string `json:"to,omitempty"`   // RFC3339, created_time < to
+	Sort     string `json:"sort"`
+	from     *txtime.Time
+	to       *txtime.Time
+}
+
+// NewListOptions returns the default options
+func NewListOptions() *ListOptions {
+	return &ListOptions{
+		PageSize: CertificatesFetchSize,
+		Revoked:  RevokedExclude,
+	}
+}
+
+// ParseListOptions parses JSON string. Omitted options are default.
+func ParseListOptions(data string) (*ListOptions, error) {
+	opts := NewListOptions()
+	if err := json.Unmarshal([]byte(data), opts); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the list options")
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// Validate validates the options, and parses the time range
+func (opts *ListOptions) Validate() error {
+	if opts.PageSize < 1 || opts.PageSize > CertificatesMaxFetchSize {
+		return errors.Errorf("invalid page size. expecting 1 ~ %d", CertificatesMaxFetchSize)
+	}
+	switch opts.Revoked {
+	case RevokedExclude, RevokedInclude, RevokedOnly:
+	default:
+		return errors.Errorf("invalid revoked filter [%s]", opts.Revoked)
+	}
+	switch opts.Sort {
+	case "", SortAsc, SortDesc:
+	default:
+		return errors.Errorf("invalid sort order [%s]", opts.Sort)
+	}
+	var err error
+	if opts.from, err = parseListTime(opts.From); err != nil {
+		return err
+	}
+	if opts.to, err = parseListTime(opts.To); err != nil {
+		return err
+	}
+	if opts.from != nil && opts.to != nil && opts.from.Cmp(opts.to) >= 0 {
+		return errors.New("invalid time range. 'from' must be before 'to'")
+	}
+	return nil
+}
+
+func parseListTime(value string) (*txtime.Time, error) {
+	if "" == value {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, errors.Errorf("invalid time [%s]. expecting RFC3339 time", value)
+	}
+	return txtime.New(t.UTC()), nil
+}
+
+// RequiresRichQuery returns whether the options require CouchDB.
+// The certificate index can't filter or sort by the created time.
+func (opts *ListOptions) RequiresRichQuery() bool {
+	return opts.Sort != "" || opts.from != nil || opts.to != nil
+}
+
+// CertificateRecord is the certificate in the list
+type CertificateRecord struct {
+	*Certificate
+	IsCurrent bool `json:"is_current"` // the invoker's certificate
+	IsLocking bool `json:"is_locking"` // holding the KID lock
+	IsExpired bool `json:"is_expired"` // X.509 validity has ended
+}
@@ -3,131 +3,1182 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric/protos/peer"
 	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
 )
 
-var logger = shim.NewLogger("kiesnet-id")
+var logger = shim.NewLogger("kiesnet-id")
+
+// Chaincode _
+type Chaincode struct {
+}
+
+// Init implements shim.Chaincode interface.
+// params[0] : revocation policy JSON (optional, instantiate or upgrade)
+// params[1] : admin MSP IDs JSON array (optional)
+func (cc *Chaincode) Init(stub shim.ChaincodeStubInterface) peer.Response {
+	_, params := stub.GetFunctionAndParameters()
+	if len(params) > 0 && params[0] != "" {
+		policy, err := ParseRevocationPolicy(params[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if err = PutRevocationPolicy(stub, policy); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if len(params) > 1 && params[1] != "" {
+		msps, err := ParseAdminMSPs(params[1])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if err = PutAdminMSPs(stub, msps); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if err := InitCertificateIndex(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// Invoke implements shim.Chaincode interface.
+func (cc *Chaincode) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
+	fn, params := stub.GetFunctionAndParameters()
+	if txFn := routes[fn]; txFn != nil {
+		return formatErrorResponse(stub, txFn(stub, params))
+	}
+	return formatErrorResponse(stub, responseError(UnknownFunctionError{Function: fn}, ""))
+}
+
+// TxFunc _
+type TxFunc func(shim.ChaincodeStubInterface, []string) peer.Response
+
+// routes is the map of invoke functions
+var routes = map[string]TxFunc{
+	"admin_claim_issuer":       txAdminClaimIssuer,
+	"admin_import_crl":         txAdminImportCRL,
+	"admin_kids":               txAdminKids,
+	"admin_kids_count":         txAdminKidsCount,
+	"admin_migrate":            txAdminMigrate,
+	"admin_migration_deadline": txAdminMigrationDeadline,
+	"admin_reindex":            txAdminReindex,
+	"admin_reindex_kids":       txAdminReindexKIDs,
+	"alias_claim":              txAliasClaim,
+	"alias_release":            txAliasRelease,
+	"alias_transfer":           txAliasTransfer,
+	"claim_revoke":             txClaimRevoke,
+	"claim_set":                txClaimSet,
+	"claims":                   txClaims,
+	"did":                      txDid,
+	"did_service":              txDidService,
+	"expiring":                 txExpiring,
+	"get":                      txGet,
+	"guardian_set":             txGuardianSet,
+	"guardians":                txGuardians,
+	"has_claim":                txHasClaim,
+	"history":                  txHistory,
+	"kid":                      txKid,
+	"label":                    txLabel,
+	"link_begin":               txLinkBegin,
+	"list":                     txList,
+	"lock":                     txLock,
+	"pin":                      txPin,
+	"reactivate":               txReactivate,
+	"recovery":                 txRecovery,
+	"recovery_approve":         txRecoveryApprove,
+	"recovery_cancel":          txRecoveryCancel,
+	"recovery_complete":        txRecoveryComplete,
+	"recovery_reject":          txRecoveryReject,
+	"recovery_request":         txRecoveryRequest,
+	"register":                 txRegister,
+	"resolve":                  txResolve,
+	"revoke":                   txRevoke,
+	"unlock":                   txUnlock,
+	"ver":                      txVer,
+	"verify":                   txVerify,
+	"verify_sig":               txVerifySig,
+}
+
+// tx functions
+
+// params[0] : issuer name
+// params[1] : MSP ID of the issuer (empty: removes the issuer)
+func txAdminClaimIssuer(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 2 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 2"}, "")
+	}
+	if err := ValidateClaimName("issuer", params[0]); err != nil {
+		return responseError(InvalidParameterError{Reason: err.Error()}, "")
+	}
+
+	ib, err := getAdminIdentityStub(stub)
+	if err != nil {
+		return responseError(err, "failed to get the administrator's identity")
+	}
+
+	if "" == params[1] {
+		if err = ib.DelClaimIssuer(params[0]); err != nil {
+			return responseError(err, "failed to remove the claim issuer")
+		}
+		return shim.Success(nil)
+	}
+
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to set the claim issuer")
+	}
+	ci := NewClaimIssuer(params[0], params[1])
+	ci.UpdatedTime = ts
+	if err = ib.PutClaimIssuer(ci); err != nil {
+		return responseError(err, "failed to set the claim issuer")
+	}
+
+	return response(ci)
+}
+
+// params[0] : PEM or base64 DER of the X.509 CRL
+func txAdminImportCRL(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 1"}, "")
+	}
+
+	ib, err := getAdminIdentityStub(stub)
+	if err != nil {
+		return responseError(err, "failed to get the administrator's identity")
+	}
+
+	crl, err := ParseCRL(params[0])
+	if err != nil {
+		return responseError(InvalidParameterError{Reason: err.Error()}, "")
+	}
+
+	cr, err := ib.ImportCRL(crl)
+	if err != nil {
+		return responseError(err, "failed to import the CRL")
+	}
+
+	return response(cr)
+}
+
+// params[0] : bookmark
+func txAdminKids(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	ib, err := getAdminIdentityStub(stub)
+	if err != nil {
+		return responseError(err, "failed to get the administrator's identity")
+	}
+
+	bookmark := ""
+	if len(params) > 0 {
+		bookmark = params[0]
+	}
+	res, err := ib.GetPrivateKIDsResult(bookmark)
+	if err != nil {
+		return responseError(err, "failed to get the old-style KIDs")
+	}
+
+	return response(res)
+}
+
+func txAdminKidsCount(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	ib, err := getAdminIdentityStub(stub)
+	if err != nil {
+		return responseError(err, "failed to get the administrator's identity")
+	}
+
+	mc, err := ib.CountPrivateKIDs()
+	if err != nil {
+		return responseError(err, "failed to count the old-style KIDs")
+	}
+
+	return response(mc)
+}
+
+// params : state keys of the old-style KIDs (admin_kids)
+func txAdminMigrate(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 1 || len(params) > MigrationMaxBatchSize {
+		return responseError(InvalidParameterError{Reason: fmt.Sprintf("incorrect number of parameters. expecting 1 ~ %d", MigrationMaxBatchSize)}, "")
+	}
+
+	ib, err := getAdminIdentityStub(stub)
+	if err != nil {
+		return responseError(err, "failed to get the administrator's identity")
+	}
+
+	mr, err := ib.MigratePrivateKIDs(params)
+	if err != nil {
+		return responseError(err, "failed to migrate the old-style KIDs")
+	}
+
+	return response(mr)
+}
+
+// params[0] : RFC3339 deadline (empty: no deadline)
+func txAdminMigrationDeadline(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 1"}, "")
+	}
+
+	if _, err := getAdminIdentityStub(stub); err != nil {
+		return responseError(err, "failed to get the administrator's identity")
+	}
+
+	md := &MigrationDeadline{}
+	if params[0] != "" {
+		t, err := time.Parse(time.RFC3339, params[0])
+		if err != nil {
+			return responseError(InvalidParameterError{Reason: "invalid deadline. expecting RFC3339 time"}, "")
+		}
+		md.Deadline = txtime.New(t)
+	}
+	if err := PutMigrationDeadline(stub, md); err != nil {
+		return responseError(err, "failed to set the migration deadline")
+	}
+
+	return response(md)
+}
+
+// params[0] : start key (optional)
+// params[1] : max number of the certificates (optional, default: max)
+func txAdminReindex(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	ib, err := getAdminIdentityStub(stub)
+	if err != nil {
+		return responseError(err, "failed to get the administrator's identity")
+	}
+
+	start := ""
+	if len(params) > 0 {
+		start = params[0]
+	}
+	limit := ReindexMaxSize
+	if len(params) > 1 && params[1] != "" {
+		limit, err = strconv.Atoi(params[1])
+		if err != nil || limit < 1 || limit > ReindexMaxSize {
+			return responseError(InvalidParameterError{Reason: fmt.Sprintf("invalid limit. expecting 1 ~ %d", ReindexMaxSize)}, "")
+		}
+	}
+
+	rr, err := ib.ReindexCertificates(start, limit)
+	if err != nil {
+		return responseError(err, "failed to index the certificates")
+	}
+
+	return response(rr)
+}
+
+// params[0] : start key (optional)
+// params[1] : limit (optional)
+func txAdminReindexKIDs(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	ib, err := getAdminIdentityStub(stub)
+	if err != nil {
+		return responseError(err, "failed to get the administrator's identity")
+	}
+
+	start := ""
+	if len(params) > 0 {
+		start = params[0]
+	}
+	limit := ReindexMaxSize
+	if len(params) > 1 && params[1] != "" {
+		limit, err = strconv.Atoi(params[1])
+		if err != nil || limit < 1 || limit > ReindexMaxSize {
+			return responseError(InvalidParameterError{Reason: fmt.Sprintf("invalid limit. expecting 1 ~ %d", ReindexMaxSize)}, "")
+		}
+	}
+
+	rr, err := ib.IndexKIDs(start, limit)
+	if err != nil {
+		return responseError(err, "failed to index the KIDs")
+	}
+
+	return response(rr)
+}
+
+// params[0] : alias
+func txAliasClaim(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 1"}, "")
+	}
+	alias, err := NormalizeAlias(params[0])
+	if err != nil {
+		return responseError(InvalidParameterError{Reason: err.Error()}, "")
+	}
+
+	invoker, ib, err := getInvokerAndIdentityStub(stub, true)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+
+	kid := invoker.KID()
+	if kid.isPriv {
+		return responseError(NotSupportedKIDError{ResponsibleErrorImpl{KID: kid.DOCTYPEID}}, "")
+	}
+
+	a, err := ib.ClaimAlias(kid, alias)
+	if err != nil {
+		return responseError(err, "failed to claim the alias")
+	}
+
+	return response(a)
+}
+
+// params[0] : alias
+func txAliasRelease(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 1"}, "")
+	}
+	alias, err := NormalizeAlias(params[0])
+	if err != nil {
+		return responseError(InvalidParameterError{Reason: err.Error()}, "")
+	}
+
+	invoker, ib, err := getInvokerAndIdentityStub(stub, true)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+
+	a, err := ib.GetAlias(alias)
+	if err != nil {
+		return responseError(err, "failed to get the alias")
+	}
+	if err = ib.ReleaseAlias(invoker.KID(), a); err != nil {
+		return responseError(err, "failed to release the alias")
+	}
+
+	return shim.Success(nil)
+}
+
+// params[0] : alias
+// params[1] : KID to receive the alias
+func txAliasTransfer(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 2 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 2"}, "")
+	}
+	alias, err := NormalizeAlias(params[0])
+	if err != nil {
+		return responseError(InvalidParameterError{Reason: err.Error()}, "")
+	}
+
+	invoker, ib, err := getInvokerAndIdentityStub(stub, true)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+
+	a, err := ib.GetAlias(alias)
+	if err != nil {
+		return responseError(err, "failed to get the alias")
+	}
+	to, err := ib.GetKIDByID(params[1])
+	if err != nil {
+		return responseError(err, "failed to get the KID to receive the alias")
+	}
+	if a, err = ib.TransferAlias(invoker.KID(), a, to); err != nil {
+		return responseError(err, "failed to transfer the alias")
+	}
+
+	return response(a)
+}
+
+// params[0] : KID
+// params[1] : claim type
+func txClaimRevoke(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 2 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 2"}, "")
+	}
+
+	ib, err := NewIdentityStub(stub)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+	ci, err := ib.GetClaimIssuer()
+	if err != nil {
+		return responseError(err, "failed to get the claim issuer")
+	}
+
+	c, err := ib.GetClaim(params[0], params[1], ci.DOCTYPEID)
+	if err != nil {
+		return responseError(err, "failed to get the claim")
+	}
+	if err = ib.RevokeClaim(c); err != nil {
+		return responseError(err, "failed to revoke the claim")
+	}
+
+	return response(c)
+}
+
+// params[0] : KID
+// params[1] : claim type
+// params[2] : claim value (optional)
+// params[3] : RFC3339 expiry time (optional, empty: never expire)
+func txClaimSet(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 2 || len(params) > 4 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 2 ~ 4"}, "")
+	}
+	if err := ValidateClaimName("claim type", params[1]); err != nil {
+		return responseError(InvalidParameterError{Reason: err.Error()}, "")
+	}
+	value := ""
+	if len(params) > 2 {
+		value = params[2]
+		if err := ValidateClaimValue(value); err != nil {
+			return responseError(InvalidParameterError{Reason: err.Error()}, "")
+		}
+	}
+
+	ib, err := NewIdentityStub(stub)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+	ci, err := ib.GetClaimIssuer()
+	if err != nil {
+		return responseError(err, "failed to get the claim issuer")
+	}
+
+	var expiry *txtime.Time
+	if len(params) > 3 && params[3] != "" {
+		ts, err := txtime.GetTime(stub)
+		if err != nil {
+			return responseError(err, "failed to set the claim")
+		}
+		t, err := time.Parse(time.RFC3339, params[3])
+		if err != nil {
+			return responseError(InvalidParameterError{Reason: "invalid claim expiry. expecting RFC3339 time"}, "")
+		}
+		if expiry = txtime.New(t); expiry.Cmp(ts) <= 0 {
+			return responseError(InvalidParameterError{Reason: "claim expiry must be after the transaction time"}, "")
+		}
+	}
+
+	kid, err := ib.GetKIDByID(params[0])
+	if err != nil {
+		return responseError(err, "failed to get the KID of the claim")
+	}
+	c, err := ib.SetClaim(ci, kid.DOCTYPEID, params[1], value, expiry)
+	if err != nil {
+		return responseError(err, "failed to set the claim")
+	}
+
+	return response(c)
+}
+
+func txClaims(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	invoker, ib, err := getInvokerAndIdentityStub(stub, false)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+
+	cl, err := ib.GetClaimList(invoker.GetID())
+	if err != nil {
+		return responseError(err, "failed to get the claims")
+	}
+
+	return response(cl)
+}
+
+// params[0] : DID (did:kiesnet:<kid>) or KID
+func txDid(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 1"}, "")
+	}
+	id := ParseDID(params[0])
+	if strings.HasPrefix(id, "did:") {
+		return responseError(InvalidParameterError{Reason: "invalid DID. expecting " + DIDPrefix + "<kid>"}, "")
+	}
+
+	ib, err := NewIdentityStub(stub)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+
+	kid, err := ib.GetKIDByID(id)
+	if err != nil {
+		return responseError(err, "failed to get the KID of the DID")
+	}
+	doc, err := ib.GetDIDDocument(kid)
+	if err != nil {
+		return responseError(err, "failed to get the DID document")
+	}
+
+	return response(doc)
+}
+
+// params[0] : service ID
+// params[1] : service type (omitted with the endpoint: removes the service)
+// params[2] : service endpoint URI
+func txDidService(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 && len(params) != 3 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 1 or 3"}, "")
+	}
+
+	invoker, ib, err := getInvokerAndIdentityStub(stub, true)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+
+	kid := invoker.KID()
+	if kid.isPriv {
+		return responseError(NotSupportedKIDError{ResponsibleErrorImpl{KID: kid.DOCTYPEID}}, "")
+	}
+
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to set the DID service")
+	}
+	ds, err := ib.GetDIDServices(kid.DOCTYPEID)
+	if err != nil {
+		return responseError(err, "failed to get the DID services")
+	}
+	if 1 == len(params) {
+		ds.Remove(params[0])
+	} else {
+		s := &DIDService{ID: params[0], Type: params[1], ServiceEndpoint: params[2]}
+		if err = s.Validate(); err != nil {
+			return responseError(InvalidParameterError{Reason: err.Error()}, "")
+		}
+		if err = ds.Set(s); err != nil {
+			return responseError(InvalidParameterError{Reason: err.Error()}, "")
+		}
+	}
+	ds.UpdatedTime = ts
+	if err = ib.PutDIDServices(ds); err != nil {
+		return responseError(err, "failed to set the DID service")
+	}
+
+	// publishes the public key of the certificate registered before the public keys
+	if cert := invoker.Certificate(); "" == cert.PublicKey {
+		cert.SetDetails(ib.cert)
+		if err = ib.PutCertificate(cert); err != nil {
+			return responseError(err, "failed to set the DID service")
+		}
+	}
+
+	return response(ds)
+}
+
+// params[0] : days (optional, default 30)
+func txExpiring(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	invoker, ib, err := getInvokerAndIdentityStub(stub, false)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+
+	days := ExpiringDefaultDays
+	if len(params) > 0 && params[0] != "" {
+		days, err = strconv.Atoi(params[0])
+		if err != nil || days < 1 || days > ExpiringMaxDays { // bounded before the conversion, time.Duration overflows
+			return responseError(InvalidParameterError{Reason: fmt.Sprintf("invalid days. expecting 1 ~ %d", ExpiringMaxDays)}, "")
+		}
+	}
+
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to get the timestamp")
+	}
+	until := txtime.New(ts.Add(time.Duration(days) * 24 * time.Hour))
+	res, err := ib.GetExpiringCertificatesResult(invoker.KID(), until)
+	if err != nil {
+		return responseError(err, "failed to get the expiring certificates")
+	}
+
+	return response(res)
+}
+
+func txGet(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	invoker, _, err := getInvokerAndIdentityStub(stub, false)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+	return response(invoker)
+}
+
+// params[0] : threshold ("0" without guardians removes the guardians)
+// params[1] : waiting period seconds (empty: default)
+// params[2:] : guardian KIDs
+func txGuardianSet(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 1 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 1+"}, "")
+	}
+
+	invoker, ib, err := getInvokerAndIdentityStub(stub, true)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+
+	kid := invoker.KID()
+	if kid.isPriv {
+		return responseError(NotSupportedKIDError{ResponsibleErrorImpl{KID: kid.DOCTYPEID}}, "")
+	}
+
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to set the guardians")
+	}
+
+	if "0" == params[0] && len(params) < 3 {
+		if err = ib.DelGuardianSet(kid.DOCTYPEID, ts); err != nil {
+			return responseError(err, "failed to remove the guardians")
+		}
+		return shim.Success(nil)
+	}
+
+	gs := NewGuardianSet(kid.DOCTYPEID)
+	if gs.Threshold, err = strconv.Atoi(params[0]); err != nil {
+		return responseError(InvalidParameterError{Reason: "invalid threshold"}, "")
+	}
+	if len(params) > 1 && params[1] != "" {
+		if gs.Delay, err = strconv.Atoi(params[1]); err != nil {
+			return responseError(InvalidParameterError{Reason: "invalid waiting period"}, "")
+		}
+	}
+	if len(params) > 2 {
+		gs.Guardians = params[2:]
+	}
+	if err = gs.Validate(); err != nil {
+		return responseError(InvalidParameterError{Reason: err.Error()}, "")
+	}
+	for _, guardian := range gs.Guardians {
+		if _, err = ib.GetKIDByID(guardian); err != nil {
+			return responseError(err, "failed to get the guardian KID")
+		}
+	}
+
+	gs.UpdatedTime = ts
+	if err = ib.PutGuardianSet(gs); err != nil {
+		return responseError(err, "failed to set the guardians")
+	}
+
+	return response(gs)
+}
+
+func txGuardians(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	invoker, ib, err := getInvokerAndIdentityStub(stub, false)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+
+	gs, err := ib.GetGuardianSet(invoker.GetID())
+	if err != nil {
+		return responseError(err, "failed to get the guardians")
+	}
+
+	return response(gs)
+}
+
+// params[0] : KID
+// params[1] : claim type
+// params[2] : claim value (optional, empty: any value)
+// params[3] : issuer name (optional, empty: any issuer)
+func txHasClaim(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 2 || len(params) > 4 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 2 ~ 4"}, "")
+	}
+	if err := ValidateClaimName("claim type", params[1]); err != nil {
+		return responseError(InvalidParameterError{Reason: err.Error()}, "")
+	}
+	value, issuer := "", ""
+	if len(params) > 2 {
+		value = params[2]
+	}
+	if len(params) > 3 {
+		issuer = params[3]
+	}
+
+	ib, err := NewIdentityStub(stub)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+
+	cc, err := ib.CheckClaim(params[0], params[1], value, issuer)
+	if err != nil {
+		return responseError(err, "failed to check the claim")
+	}
+
+	return response(cc)
+}
+
+// params[0] : Serial Number (empty: the KID's history)
+// params[1] : bookmark
+func txHistory(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	invoker, ib, err := getInvokerAndIdentityStub(stub, false)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+
+	sn := ""
+	if len(params) > 0 {
+		sn = params[0]
+	}
+	bookmark := ""
+	if len(params) > 1 {
+		bookmark = params[1]
+	}
+
+	if sn == "" {
+		res, err := ib.GetKIDHistoryResult(invoker.KID(), bookmark)
+		if err != nil {
+			return responseError(err, "failed to get the KID history")
+		}
+		return response(res)
+	}
+
+	if _, err = ib.GetCertificate(invoker.GetID(), sn); err != nil {
+		return responseError(err, "failed to get the certificate")
+	}
+	res, err := ib.GetCertificateHistoryResult(invoker.GetID(), sn, bookmark)
+	if err != nil {
+		return responseError(err, "failed to get the certificate history")
+	}
+	return response(res)
+}
+
+// params[0] : migration flag (optional)
+// params[1] : "json" to get { id, lock_expiry_time } (optional)
+func txKid(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	migr := (len(params) > 0 && params[0] != "")
+	invoker, _, err := getInvokerAndIdentityStub(stub, migr)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+	if len(params) > 1 && "json" == params[1] {
+		kid := invoker.KID()
+		var lockExpiryTime *txtime.Time
+		if kid.Lock != "" {
+			lockExpiryTime = kid.LockExpiryTime
+		}
+		data, err := json.Marshal(&struct {
+			ID             string       `json:"id"`
+			LockExpiryTime *txtime.Time `json:"lock_expiry_time,omitempty"`
+		}{ID: kid.DOCTYPEID, LockExpiryTime: lockExpiryTime})
+		if err != nil {
+			return responseError(err, "failed to marshal payload")
+		}
+		return shim.Success(data)
+	}
+	return shim.Success([]byte(invoker.GetID()))
+}
+
+// params[0] : Serial Number (empty: the invoker's certificate)
+// params[1] : label (empty: removes the label)
+// params[2] : JSON object of the metadata (optional, omitted: keeps the metadata, "{}": removes the metadata)
+func txLabel(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 2 || len(params) > 3 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 2 ~ 3"}, "")
+	}
+	if err := ValidateLabel(params[1]); err != nil {
+		return responseError(InvalidParameterError{Reason: err.Error()}, "")
+	}
+	var metadata map[string]string
+	if len(params) > 2 {
+		var err error
+		if metadata, err = ParseMetadata(params[2]); err != nil {
+			return responseError(InvalidParameterError{Reason: err.Error()}, "")
+		}
+	}
+
+	invoker, ib, err := getInvokerAndIdentityStub(stub, true)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+
+	cert := invoker.Certificate()
+	if params[0] != "" && params[0] != cert.SN {
+		if cert, err = ib.GetCertificate(invoker.GetID(), params[0]); err != nil {
+			return responseError(err, "failed to get the certificate to be labeled")
+		}
+	}
+	cert.Label = params[1]
+	if len(params) > 2 {
+		cert.Metadata = metadata
+	}
+	if err = ib.PutCertificate(cert); err != nil {
+		return responseError(err, "failed to label the certificate")
+	}
+
+	return response(cert)
+}
+
+// params[0] : TTL seconds (optional)
+// params[0] : fingerprint of the new device's certificate
+// params[1] : TTL seconds (optional)
+func txLinkBegin(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 1 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 1+"}, "")
+	}
+	if err := ValidateFingerprint(params[0]); err != nil {
+		return responseError(InvalidParameterError{Reason: err.Error()}, "")
+	}
+
+	invoker, ib, err := getInvokerAndIdentityStub(stub, true)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+
+	kid := invoker.KID()
+	if kid.isPriv {
+		return responseError(NotSupportedKIDError{ResponsibleErrorImpl{KID: kid.DOCTYPEID}}, "")
+	}
+
+	ttl := LinkDefaultTTL
+	if len(params) > 1 && params[1] != "" {
+		ttl, err = strconv.Atoi(params[1])
+		if err != nil || ttl <= 0 || ttl > LinkMaxTTL {
+			return responseError(InvalidParameterError{Reason: fmt.Sprintf("invalid TTL. expecting 1 ~ %d", LinkMaxTTL)}, "")
+		}
+	}
+
+	code := string(ib.GetTransient("kiesnet-id/link_code"))
+	if len(code) < LinkCodeMinLength {
+		return responseError(InvalidParameterError{Reason: fmt.Sprintf("link code must be at least %d characters", LinkCodeMinLength)}, "")
+	}
+
+	link, err := ib.CreateLink(kid, code, params[0], ttl)
+	if err != nil {
+		return responseError(err, "failed to begin the link")
+	}
+
+	return response(link)
+}
+
+// params[0] : bookmark
+// params[1] : list options JSON (optional)
+func txList(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	invoker, ib, err := getInvokerAndIdentityStub(stub, false)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+
+	bookmark := ""
+	if len(params) > 0 {
+		bookmark = params[0]
+	}
+	opts := NewListOptions()
+	if len(params) > 1 && params[1] != "" {
+		if opts, err = ParseListOptions(params[1]); err != nil {
+			return responseError(InvalidParameterError{Reason: err.Error()}, "")
+		}
+	}
+	res, err := ib.GetQueryCertificatesResult(invoker.KID(), opts, bookmark)
+	if err != nil {
+		return responseError(err, "failed to get certificate list")
+	}
+
+	return response(res)
+}
+
+// params[0] : lock duration seconds or RFC3339 expiry time (optional, default: never expire)
+func txLock(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	invoker, ib, err := getInvokerAndIdentityStub(stub, true)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+
+	kid := invoker.KID()
+	if kid.isPriv {
+		return responseError(NotSupportedKIDError{ResponsibleErrorImpl{KID: kid.DOCTYPEID}}, "")
+	}
+
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to lock with the certificate")
+	}
+
+	if kid.IsLocked(ts) {
+		return responseError(AlreadyLockedError{ResponsibleErrorImpl{KID: kid.DOCTYPEID, SN: kid.Lock}}, "")
+	}
+
+	var expiry *txtime.Time
+	if len(params) > 0 && params[0] != "" {
+		if expiry, err = parseLockExpiry(params[0], ts); err != nil {
+			return responseError(InvalidParameterError{Reason: err.Error()}, "")
+		}
+	}
+
+	kid.Lock = ib.sn
+	kid.LockExpiryTime = expiry
+	kid.UpdatedTime = ts
+
+	if err = ib.PutKID(kid); err != nil {
+		return responseError(err, "failed to lock with the certificate")
+	}
+	if err = ib.PutEvent(EventKIDLocked, kid.DOCTYPEID, ib.sn, ts); err != nil {
+		return responseError(err, "failed to lock with the certificate")
+	}
+
+	return response(kid)
+}
+
+func txPin(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	invoker, ib, err := getInvokerAndIdentityStub(stub, true)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+
+	kid := invoker.KID()
+	if !kid.isPriv { // only old-style supported
+		return responseError(NotSupportedKIDError{ResponsibleErrorImpl{KID: kid.DOCTYPEID}}, "")
+	}
 
-// Chaincode _
-type Chaincode struct {
-}
+	if err = ib.UpdatePIN(kid); err != nil {
+		return responseError(err, "failed to update the PIN")
+	}
 
-// Init implements shim.Chaincode interface.
-func (cc *Chaincode) Init(stub shim.ChaincodeStubInterface) peer.Response {
-	return shim.Success(nil)
+	return response(invoker)
 }
 
-// Invoke implements shim.Chaincode interface.
-func (cc *Chaincode) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
-	fn, params := stub.GetFunctionAndParameters()
-	if txFn := routes[fn]; txFn != nil {
-		return txFn(stub, params)
+// params[0] : Serial Number
+func txReactivate(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 1"}, "")
 	}
-	return shim.Error("unknown function: [" + fn + "]")
-}
 
-// TxFunc _
-type TxFunc func(shim.ChaincodeStubInterface, []string) peer.Response
+	invoker, ib, err := getInvokerAndIdentityStub(stub, true)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
 
-// routes is the map of invoke functions
-var routes = map[string]TxFunc{
-	"get":      txGet,
-	"kid":      txKid,
-	"list":     txList,
-	"lock":     txLock,
-	"pin":      txPin,
-	"register": txRegister,
-	"revoke":   txRevoke,
-	"unlock":   txUnlock,
-	"ver":      txVer,
+	sn := params[0]
+	cert, err := ib.GetCertificate(invoker.GetID(), sn)
+	if err != nil {
+		return responseError(err, "failed to get the certificate to be reactivated")
+	}
+	if cert.RevokedTime == nil {
+		return responseError(NotRevokedCertificateError{ResponsibleErrorImpl{KID: cert.DOCTYPEID, SN: cert.SN}}, "")
+	}
+
+	if err = ib.ReactivateCertificate(cert); err != nil {
+		return responseError(err, "failed to reactivate the certificate")
+	}
+
+	return response(cert)
 }
 
-// tx functions
+// params[0] : KID
+func txRecovery(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 1"}, "")
+	}
 
-func txGet(stub shim.ChaincodeStubInterface, params []string) peer.Response {
-	invoker, _, err := getInvokerAndIdentityStub(stub, false)
+	ib, err := NewIdentityStub(stub)
 	if err != nil {
 		return responseError(err, "failed to get the invoker's identity")
 	}
-	return response(invoker)
+
+	r, err := ib.GetRecovery(params[0])
+	if err != nil {
+		return responseError(err, "failed to get the recovery")
+	}
+
+	return response(r)
 }
 
-func txKid(stub shim.ChaincodeStubInterface, params []string) peer.Response {
-	migr := (len(params) > 0 && params[0] != "")
-	invoker, _, err := getInvokerAndIdentityStub(stub, migr)
+// params[0] : KID
+func txRecoveryApprove(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 1"}, "")
+	}
+
+	invoker, ib, err := getInvokerAndIdentityStub(stub, true)
 	if err != nil {
 		return responseError(err, "failed to get the invoker's identity")
 	}
-	return shim.Success([]byte(invoker.GetID()))
+
+	gs, err := ib.GetGuardianSet(params[0])
+	if err != nil {
+		return responseError(err, "failed to get the guardians")
+	}
+	guardian := invoker.GetID()
+	if !gs.Has(guardian) {
+		return responseError(NotGuardianError{ResponsibleErrorImpl{KID: gs.DOCTYPEID}}, "")
+	}
+
+	r, err := ib.GetRecovery(params[0])
+	if err != nil {
+		return responseError(err, "failed to get the recovery")
+	}
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to approve the recovery")
+	}
+	if r.IsExpired(ts) {
+		return responseError(ExpiredRecoveryError{ResponsibleErrorImpl{KID: r.DOCTYPEID}}, "")
+	}
+	if r.HasApproval(guardian) {
+		return responseError(AlreadyApprovedRecoveryError{ResponsibleErrorImpl{KID: r.DOCTYPEID}}, "")
+	}
+
+	if err = ib.ApproveRecovery(r, gs, guardian); err != nil {
+		return responseError(err, "failed to approve the recovery")
+	}
+
+	return response(r)
 }
 
-// params[0] : bookmark
-func txList(stub shim.ChaincodeStubInterface, params []string) peer.Response {
-	invoker, ib, err := getInvokerAndIdentityStub(stub, false)
+// Any active certificate of the KID can cancel the recovery, even if the KID is locked.
+func txRecoveryCancel(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	ib, err := NewIdentityStub(stub)
 	if err != nil {
 		return responseError(err, "failed to get the invoker's identity")
 	}
 
-	bookmark := ""
-	if len(params) > 0 {
-		bookmark = params[0]
+	kid, err := ib.ReadKID()
+	if err != nil {
+		return responseError(err, "failed to get the invoker's KID")
+	}
+	cert, err := ib.GetCertificate(kid.DOCTYPEID, "")
+	if err != nil {
+		return responseError(err, "failed to get the invoker's certificate")
 	}
-	res, err := ib.GetQueryCertificatesResult(invoker.GetID(), bookmark)
+	ts, err := txtime.GetTime(stub)
 	if err != nil {
-		return responseError(err, "failed to get certificate list")
+		return responseError(err, "failed to get the timestamp")
+	}
+	if err = cert.Validate(ts); err != nil {
+		return responseError(err, "failed to get the invoker's certificate")
 	}
 
-	return response(res)
+	r, err := ib.GetRecovery(kid.DOCTYPEID)
+	if err != nil {
+		return responseError(err, "failed to get the recovery")
+	}
+	if err = ib.CancelRecovery(r); err != nil {
+		return responseError(err, "failed to cancel the recovery")
+	}
+
+	return response(r)
 }
 
-func txLock(stub shim.ChaincodeStubInterface, params []string) peer.Response {
-	invoker, ib, err := getInvokerAndIdentityStub(stub, true)
+// params[0] : KID
+func txRecoveryComplete(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 1"}, "")
+	}
+
+	ib, err := NewIdentityStub(stub)
 	if err != nil {
 		return responseError(err, "failed to get the invoker's identity")
 	}
 
-	kid := invoker.KID()
-	if kid.isPriv {
-		return shim.Error("not supported KID")
+	r, err := ib.GetRecovery(params[0])
+	if err != nil {
+		return responseError(err, "failed to get the recovery")
+	}
+	if r.UUID != ib.uuid || r.SN != ib.sn {
+		return responseError(NotRecoveringCertificateError{ResponsibleErrorImpl{KID: r.DOCTYPEID, SN: ib.sn}}, "")
+	}
+	gs, err := ib.GetGuardianSet(r.DOCTYPEID)
+	if err != nil {
+		return responseError(err, "failed to get the guardians")
+	}
+	if nil == r.ApprovedTime || r.CountApprovals(gs) < gs.Threshold {
+		return responseError(NotApprovedRecoveryError{ResponsibleErrorImpl{KID: r.DOCTYPEID}}, "")
+	}
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to recover the KID")
+	}
+	if !r.IsEffective(ts) {
+		return responseError(RecoveryWaitingPeriodError{ResponsibleErrorImpl{KID: r.DOCTYPEID}}, "")
 	}
 
-	if kid.Lock != "" {
-		return shim.Error("already locked with the certificate")
+	kid, cert, err := ib.RecoverKID(r)
+	if err != nil {
+		return responseError(err, "failed to recover the KID")
 	}
 
-	ts, err := txtime.GetTime(stub)
+	return response(NewIdentity(kid, cert))
+}
+
+// params[0] : KID
+// Anyone can request the recovery, so a guardian rejects the unknown request not approved yet.
+func txRecoveryReject(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 1"}, "")
+	}
+
+	invoker, ib, err := getInvokerAndIdentityStub(stub, true)
 	if err != nil {
-		return responseError(err, "failed to lock with the certificate")
+		return responseError(err, "failed to get the invoker's identity")
 	}
 
-	kid.Lock = ib.sn
-	kid.UpdatedTime = ts
+	gs, err := ib.GetGuardianSet(params[0])
+	if err != nil {
+		return responseError(err, "failed to get the guardians")
+	}
+	if !gs.Has(invoker.GetID()) {
+		return responseError(NotGuardianError{ResponsibleErrorImpl{KID: gs.DOCTYPEID}}, "")
+	}
 
-	if err = ib.PutKID(kid); err != nil {
-		return responseError(err, "failed to lock with the certificate")
+	r, err := ib.GetRecovery(params[0])
+	if err != nil {
+		return responseError(err, "failed to get the recovery")
+	}
+	if r.ApprovedTime != nil {
+		return responseError(AlreadyApprovedRecoveryError{ResponsibleErrorImpl{KID: r.DOCTYPEID}}, "")
 	}
 
-	return response(kid)
+	if err = ib.RejectRecovery(r); err != nil {
+		return responseError(err, "failed to reject the recovery")
+	}
+
+	return response(r)
 }
 
-func txPin(stub shim.ChaincodeStubInterface, params []string) peer.Response {
-	invoker, ib, err := getInvokerAndIdentityStub(stub, true)
+// params[0] : KID
+// params[1] : "true" to revoke the other certificates (optional)
+func txRecoveryRequest(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) < 1 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 1+"}, "")
+	}
+
+	ib, err := NewIdentityStub(stub)
 	if err != nil {
 		return responseError(err, "failed to get the invoker's identity")
 	}
 
-	kid := invoker.KID()
-	if !kid.isPriv {	// only old-style supported
-		return shim.Error("not supported KID")
+	// the invoker's uuid must not belong to another KID
+	if current, err := ib.ReadKID(); err != nil {
+		if _, ok := err.(NotRegisteredCertificateError); !ok {
+			return responseError(err, "failed to get the invoker's KID")
+		}
+	} else if current.DOCTYPEID != params[0] {
+		return responseError(AlreadyRegisteredKIDError{ResponsibleErrorImpl{KID: current.DOCTYPEID, SN: ib.sn}}, "")
 	}
 
-	if err = ib.UpdatePIN(kid); err != nil {
-		return responseError(err, "failed to update the PIN")
+	kid, err := ib.GetKIDByID(params[0])
+	if err != nil {
+		return responseError(err, "failed to get the KID")
+	}
+	if _, err = ib.GetGuardianSet(kid.DOCTYPEID); err != nil {
+		return responseError(err, "failed to get the guardians")
 	}
 
-	return response(invoker)
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to request the recovery")
+	}
+	if r, err := ib.GetRecovery(kid.DOCTYPEID); err != nil {
+		if _, ok := err.(NoRecoveryError); !ok {
+			return responseError(err, "failed to get the recovery")
+		}
+	} else if !r.IsExpired(ts) {
+		return responseError(AlreadyRequestedRecoveryError{ResponsibleErrorImpl{KID: kid.DOCTYPEID}}, "")
+	}
+
+	revoke := len(params) > 1 && "true" == params[1]
+	r, err := ib.CreateRecovery(kid, revoke)
+	if err != nil {
+		return responseError(err, "failed to request the recovery")
+	}
+
+	return response(r)
 }
 
 func txRegister(stub shim.ChaincodeStubInterface, params []string) peer.Response {
@@ -136,16 +1187,26 @@ func txRegister(stub shim.ChaincodeStubInterface, params []string) peer.Response
 		return responseError(err, "failed to get the invoker's identity")
 	}
 
+	linkCode := string(ib.GetTransient("kiesnet-id/link_code"))
+
 	kid, err := ib.GetKID(true)
 	if err != nil {
 		if _, ok := err.(NotRegisteredCertificateError); !ok {
 			return responseError(err, "failed to get the invoker's KID")
 		}
-		// create new KID
-		kid, err = ib.CreateKID()
-		if err != nil {
-			return responseError(err, "failed to create new KID")
+		if linkCode != "" { // link with the existing KID
+			kid, err = ib.LinkKID(linkCode)
+			if err != nil {
+				return responseError(err, "failed to link the KID")
+			}
+		} else { // create new KID
+			kid, err = ib.CreateKID()
+			if err != nil {
+				return responseError(err, "failed to create new KID")
+			}
 		}
+	} else if linkCode != "" {
+		return responseError(AlreadyRegisteredKIDError{ResponsibleErrorImpl{KID: kid.DOCTYPEID, SN: ib.sn}}, "")
 	}
 
 	cert, err := ib.GetCertificate(kid.DOCTYPEID, "")
@@ -154,11 +1215,25 @@ func txRegister(stub shim.ChaincodeStubInterface, params []string) peer.Response
 			return responseError(err, "failed to register the certificate")
 		}
 	} else {
-		// ISSUE: re-register revoked certificate
-		if err = cert.Validate(); err != nil {
-			return responseError(err, "failed to register the certificate")
+		if nil == cert.RevokedTime {
+			return responseError(AlreadyRegisteredCertificateError{ResponsibleErrorImpl{KID: cert.DOCTYPEID, SN: cert.SN}}, "")
+		}
+		if cert.RevocationReason != "" {
+			return responseError(RevokedByCAError{ResponsibleErrorImpl{KID: cert.DOCTYPEID, SN: cert.SN}}, "failed to reactivate the certificate")
 		}
-		return shim.Error("already registered certificate")
+		// re-register revoked certificate, only if the KID has no other active certificate
+		// else, an active certificate has to reactivate it
+		active, err := ib.HasActiveCertificate(kid.DOCTYPEID, cert.SN)
+		if err != nil {
+			return responseError(err, "failed to reactivate the certificate")
+		}
+		if active {
+			return responseError(NotApprovedReactivationError{}, "failed to reactivate the certificate")
+		}
+		if err = ib.ReactivateCertificate(cert); err != nil {
+			return responseError(err, "failed to reactivate the certificate")
+		}
+		return response(NewIdentity(kid, cert))
 	}
 
 	cert, err = ib.CreateCertificate(kid.DOCTYPEID)
@@ -169,10 +1244,33 @@ func txRegister(stub shim.ChaincodeStubInterface, params []string) peer.Response
 	return response(NewIdentity(kid, cert))
 }
 
+// params[0] : alias
+func txResolve(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 1 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 1"}, "")
+	}
+	alias, err := NormalizeAlias(params[0])
+	if err != nil {
+		return responseError(InvalidParameterError{Reason: err.Error()}, "")
+	}
+
+	ib, err := NewIdentityStub(stub)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+
+	a, err := ib.GetAlias(alias)
+	if err != nil {
+		return responseError(err, "failed to resolve the alias")
+	}
+
+	return response(a)
+}
+
 // params[0] : Serial Number
 func txRevoke(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	if len(params) != 1 {
-		return shim.Error("incorrect number of parameters. expecting 1")
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 1"}, "")
 	}
 
 	invoker, ib, err := getInvokerAndIdentityStub(stub, true)
@@ -180,14 +1278,43 @@ func txRevoke(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 		return responseError(err, "failed to get the invoker's identity")
 	}
 
-	// ISSUE: have to prevent self-revoking ?
 	sn := params[0]
 	revokee, err := ib.GetCertificate(invoker.GetID(), sn)
 	if err != nil {
 		return responseError(err, "failed to get the certificate to be revoked")
 	}
 	if revokee.RevokedTime != nil {
-		return shim.Error("already revoked certificate")
+		return responseError(AlreadyRevokedCertificateError{ResponsibleErrorImpl{KID: revokee.DOCTYPEID, SN: revokee.SN}}, "")
+	}
+
+	// safeguards
+	policy, err := GetRevocationPolicy(stub)
+	if err != nil {
+		return responseError(err, "failed to get the revocation policy")
+	}
+	force := "true" == string(ib.GetTransient("kiesnet-id/force"))
+	if revokee.SN == invoker.GetSN() {
+		if ok, forcible := permitsRevocation(policy.Self, force); !ok {
+			return responseError(SelfRevocationError{Forcible: forcible}, "failed to revoke the certificate")
+		}
+	}
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to revoke the certificate")
+	}
+	if revokee.SN == invoker.KID().Lock && invoker.KID().IsLocked(ts) {
+		if ok, forcible := permitsRevocation(policy.Lock, force); !ok {
+			return responseError(LockingCertificateRevocationError{Forcible: forcible}, "failed to revoke the certificate")
+		}
+	}
+	active, err := ib.HasActiveCertificate(invoker.GetID(), revokee.SN)
+	if err != nil {
+		return responseError(err, "failed to revoke the certificate")
+	}
+	if !active {
+		if ok, forcible := permitsRevocation(policy.Last, force); !ok {
+			return responseError(LastCertificateRevocationError{Forcible: forcible}, "failed to revoke the certificate")
+		}
 	}
 
 	if err = ib.RevokeCertificate(revokee); err != nil {
@@ -205,7 +1332,7 @@ func txUnlock(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 
 	kid := invoker.KID()
 	if kid.isPriv {
-		return shim.Error("not supported KID")
+		return responseError(NotSupportedKIDError{ResponsibleErrorImpl{KID: kid.DOCTYPEID}}, "")
 	}
 
 	if kid.Lock != "" {
@@ -214,10 +1341,14 @@ func txUnlock(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 			return responseError(err, "failed to unlock with the certificate")
 		}
 		kid.Lock = ""
+		kid.LockExpiryTime = nil
 		kid.UpdatedTime = ts
 		if err = ib.PutKID(kid); err != nil {
 			return responseError(err, "failed to unlock with the certificate")
 		}
+		if err = ib.PutEvent(EventKIDUnlocked, kid.DOCTYPEID, ib.sn, ts); err != nil {
+			return responseError(err, "failed to unlock with the certificate")
+		}
 	}
 
 	return response(kid)
@@ -227,8 +1358,97 @@ func txVer(stub shim.ChaincodeStubInterface, params []string) peer.Response {
 	return shim.Success([]byte("Kiesnet ID v1.3.2 created by Key Inside Co., Ltd."))
 }
 
+// for dependent chaincodes (InvokeChaincode)
+// It doesn't fail with the revoked or not locked certificate, but reports it.
+func txVerify(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	ib, err := NewIdentityStub(stub)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+
+	kid, err := ib.ReadKID()
+	if err != nil {
+		return responseError(err, "failed to get the invoker's KID")
+	}
+
+	cert, err := ib.GetCertificate(kid.DOCTYPEID, "")
+	if err != nil {
+		return responseError(err, "failed to get the invoker's certificate")
+	}
+
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return responseError(err, "failed to get the timestamp")
+	}
+
+	return response(NewVerification(kid, cert, ts))
+}
+
+// params[0] : DID (did:kiesnet:<kid>) or KID
+// params[1] : Serial Number or "any" (any active certificate)
+// params[2] : hex digest (SHA-256, SHA-384 or SHA-512)
+// params[3] : base64 signature
+func txVerifySig(stub shim.ChaincodeStubInterface, params []string) peer.Response {
+	if len(params) != 4 {
+		return responseError(InvalidParameterError{Reason: "incorrect number of parameters. expecting 4"}, "")
+	}
+	id := ParseDID(params[0])
+	if strings.HasPrefix(id, "did:") {
+		return responseError(InvalidParameterError{Reason: "invalid DID. expecting " + DIDPrefix + "<kid>"}, "")
+	}
+	if "" == params[1] {
+		return responseError(InvalidParameterError{Reason: "invalid serial number. expecting the SN or \"" + SignatureAnyActive + "\""}, "")
+	}
+	digest, err := ParseDigest(params[2])
+	if err != nil {
+		return responseError(InvalidParameterError{Reason: err.Error()}, "")
+	}
+	sig, err := ParseSignature(params[3])
+	if err != nil {
+		return responseError(InvalidParameterError{Reason: err.Error()}, "")
+	}
+
+	ib, err := NewIdentityStub(stub)
+	if err != nil {
+		return responseError(err, "failed to get the invoker's identity")
+	}
+
+	kid, err := ib.GetKIDByID(id)
+	if err != nil {
+		return responseError(err, "failed to get the KID")
+	}
+	sv, err := ib.VerifySignature(kid, params[1], digest, sig)
+	if err != nil {
+		return responseError(err, "failed to verify the signature")
+	}
+
+	return response(sv)
+}
+
 // helpers
 
+// returns the IdentityStub of the administrator.
+// The attribute is honoured only in the admin MSPs configured by Init, as any CA can issue it.
+func getAdminIdentityStub(stub shim.ChaincodeStubInterface) (*IdentityStub, error) {
+	ib, err := NewIdentityStub(stub)
+	if err != nil {
+		return nil, err
+	}
+	if !ib.admin {
+		return nil, NotAdminError{}
+	}
+	msps, err := GetAdminMSPs(stub)
+	if err != nil {
+		return nil, err
+	}
+	for _, mspID := range msps {
+		if mspID == ib.mspID {
+			return ib, nil
+		}
+	}
+	return nil, NotAdminError{}
+}
+
 // returns invoker's Identity and IdentityStub
 func getInvokerAndIdentityStub(stub shim.ChaincodeStubInterface, migr bool) (*Identity, *IdentityStub, error) {
 	ib, err := NewIdentityStub(stub)
@@ -245,13 +1465,40 @@ func getInvokerAndIdentityStub(stub shim.ChaincodeStubInterface, migr bool) (*Id
 	if err != nil {
 		return nil, ib, err
 	}
-	if err = cert.Validate(); err != nil {
+	ts, err := txtime.GetTime(stub)
+	if err != nil {
+		return nil, ib, errors.Wrap(err, "failed to get the timestamp")
+	}
+	if err = cert.Validate(ts); err != nil {
 		return nil, ib, err
 	}
 
 	return NewIdentity(kid, cert), ib, nil
 }
 
+// parses the lock duration seconds or RFC3339 expiry time
+func parseLockExpiry(param string, ts *txtime.Time) (*txtime.Time, error) {
+	var expiry *txtime.Time
+	if seconds, err := strconv.ParseInt(param, 10, 64); err == nil {
+		// bounded before the conversion, time.Duration overflows
+		if seconds <= 0 {
+			return nil, errors.New("lock expiry must be after the transaction time")
+		}
+		if seconds > LockMaxSeconds {
+			return nil, errors.Errorf("invalid lock expiry. expecting seconds up to %d or RFC3339 time", LockMaxSeconds)
+		}
+		expiry = txtime.New(ts.Add(time.Duration(seconds) * time.Second))
+	} else if t, err := time.Parse(time.RFC3339, param); err == nil {
+		expiry = txtime.New(t)
+	} else {
+		return nil, errors.New("invalid lock expiry. expecting seconds or RFC3339 time")
+	}
+	if expiry.Cmp(ts) <= 0 {
+		return nil, errors.New("lock expiry must be after the transaction time")
+	}
+	return expiry, nil
+}
+
 func response(payload Payload) peer.Response {
 	data, err := payload.MarshalPayload()
 	if err != nil {
@@ -262,7 +1509,10 @@ func response(payload Payload) peer.Response {
 }
 
 // If 'err' is ResponsibleError, it will add err's message to the 'msg'.
+// The recorded PIN mismatch responds with PINFailureStatus to commit the record.
+// The payload is the error payload, formatted by formatErrorResponse.
 func responseError(err error, msg string) peer.Response {
+	status := int32(shim.ERROR)
 	if nil != err {
 		logger.Debug(err.Error())
 		if _, ok := err.(ResponsibleError); ok {
@@ -272,8 +1522,12 @@ func responseError(err error, msg string) peer.Response {
 				msg = err.Error()
 			}
 		}
+		if e, ok := err.(MismatchedPINError); ok && e.Failures > 0 {
+			status = PINFailureStatus
+		}
 	}
-	return shim.Error(msg)
+	data, _ := NewErrorPayload(err, msg).MarshalPayload()
+	return peer.Response{Status: status, Message: msg, Payload: data}
 }
 
 func main() {
@@ -0,0 +1,2488 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/payprotocol/kiesnet-cc-id/client"
+	"github.com/payprotocol/kiesnet-cc-id/event"
+	"github.com/payprotocol/kiesnet-cc-id/verifier"
+	"github.com/pkg/errors"
+)
+
+// KIDs not registered
+const (
+	unknownKID   = "0123456789abcdef0123456789abcdef01234567"
+	injectionKID = `x","@kid":{"$gt":"`
+)
+
+// testEnv is a chaincode instance on the in-memory ledger
+type testEnv struct {
+	t    *testing.T
+	stub *testStub
+	ca   *testCA
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	env := &testEnv{
+		t:    t,
+		stub: newTestStub(),
+		ca:   newTestCA(t, "ca.org1"),
+	}
+	if res := env.stub.initialize("", `["`+testMSPID+`"]`); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	return env
+}
+
+func (env *testEnv) invoke(id *testIdentity, transient map[string]string, fn string, params ...string) peer.Response {
+	var trs map[string][]byte
+	if transient != nil {
+		trs = map[string][]byte{}
+		for k, v := range transient {
+			trs[k] = []byte(v)
+		}
+	}
+	return env.stub.invoke(id.creator, trs, fn, params...)
+}
+
+// mustInvoke fails the test if the transaction fails, and unmarshals the payload into 'v' if not nil.
+func (env *testEnv) mustInvoke(id *testIdentity, transient map[string]string, v interface{}, fn string, params ...string) []byte {
+	env.t.Helper()
+	res := env.invoke(id, transient, fn, params...)
+	if res.Status != shim.OK {
+		env.t.Fatalf("%s: unexpected error: %s", fn, res.Message)
+	}
+	if v != nil {
+		if err := json.Unmarshal(res.Payload, v); err != nil {
+			env.t.Fatalf("%s: failed to unmarshal payload: %s", fn, err)
+		}
+	}
+	return res.Payload
+}
+
+func (env *testEnv) register(id *testIdentity, transient map[string]string) *identityPayload {
+	env.t.Helper()
+	p := &identityPayload{}
+	env.mustInvoke(id, transient, p, "register")
+	return p
+}
+
+func (env *testEnv) kid(id string) *KID {
+	env.t.Helper()
+	for _, data := range env.stub.state {
+		kid := &KID{}
+		if err := json.Unmarshal(data, kid); err == nil && kid.DOCTYPEID == id {
+			return kid
+		}
+	}
+	return nil
+}
+
+var force = map[string]string{"kiesnet-id/force": "true"}
+
+type identityPayload struct {
+	ID string `json:"id"`
+	SN string `json:"sn"`
+}
+
+type listPayload struct {
+	Meta struct {
+		FetchedRecordsCount int32  `json:"fetched_records_count"`
+		Bookmark            string `json:"bookmark"`
+	} `json:"meta"`
+	Records []*Certificate `json:"records"`
+}
+
+// txTest is a step of a table-driven scenario
+type txTest struct {
+	name      string
+	id        *testIdentity
+	transient map[string]string
+	fn        string
+	params    []string
+	err       string // expected error message, "" means success
+}
+
+func runTxTests(t *testing.T, env *testEnv, tests []txTest) {
+	t.Helper()
+	for _, tt := range tests {
+		res := env.invoke(tt.id, tt.transient, tt.fn, tt.params...)
+		if tt.err == "" {
+			if res.Status != shim.OK {
+				t.Errorf("%s: unexpected error: %s", tt.name, res.Message)
+			}
+		} else {
+			if res.Status == shim.OK {
+				t.Errorf("%s: expected error [%s], but succeeded", tt.name, tt.err)
+			} else if res.Message != tt.err {
+				t.Errorf("%s: expected error [%s], but [%s]", tt.name, tt.err, res.Message)
+			}
+		}
+	}
+}
+
+func TestInvokeUnknownFunction(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	runTxTests(t, env, []txTest{
+		{name: "unknown", id: alice, fn: "unknown", err: "unknown function: [unknown]"},
+		{name: "empty", id: alice, fn: "", err: "unknown function: []"},
+	})
+}
+
+func TestVer(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	ver := env.mustInvoke(alice, nil, nil, "ver")
+	if !strings.HasPrefix(string(ver), "Kiesnet ID v") {
+		t.Errorf("unexpected version: %s", ver)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	env := newTestEnv(t)
+
+	alice := env.ca.enroll(t, "alice", nil)
+	p := env.register(alice, nil)
+	if p.ID == "" || p.SN != alice.SN() {
+		t.Fatalf("unexpected identity: %+v", p)
+	}
+	if kid := env.kid(p.ID); kid == nil || kid.Pin != nil {
+		t.Fatalf("new-style KID must be in the public state without PIN: %+v", kid)
+	}
+	if env.stub.state[keyStub(env).CreateCertificateKey(p.ID, alice.SN())] == nil {
+		t.Fatal("certificate is not in the state")
+	}
+
+	// client-id base: re-enrolled certificate has same client-id
+	alice2 := env.ca.reenroll(t, "alice", alice.key, nil)
+	if p2 := env.register(alice2, nil); p2.ID != p.ID || p2.SN != alice2.SN() {
+		t.Errorf("re-enrolled certificate must share the KID: %+v, %+v", p, p2)
+	}
+
+	// public-key base
+	bob := env.ca.enroll(t, "bob", pubkeyAttrs)
+	pb := env.register(bob, nil)
+	if pb.ID == p.ID {
+		t.Error("different client must have different KID")
+	}
+	bob2 := env.ca.reenroll(t, "bob2", bob.key, pubkeyAttrs) // different CN, same public-key
+	if p2 := env.register(bob2, nil); p2.ID != pb.ID {
+		t.Errorf("same public-key must share the KID: %+v, %+v", pb, p2)
+	}
+	bob3 := env.ca.enroll(t, "bob", pubkeyAttrs) // same CN, different public-key
+	if p3 := env.register(bob3, nil); p3.ID == pb.ID {
+		t.Error("different public-key must have different KID")
+	}
+
+	runTxTests(t, env, []txTest{
+		{name: "already registered", id: alice, fn: "register", err: "already registered certificate"},
+		{name: "revoke", id: alice2, fn: "revoke", params: []string{alice.SN()}},
+		{name: "re-register revoked", id: alice, fn: "register", err: "failed to reactivate the certificate|reactivation must be approved by an active certificate"},
+	})
+}
+
+func TestRegisterOldStyle(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+
+	p := env.register(alice, map[string]string{"kiesnet-id/pin": "1234"})
+	if env.kid(p.ID) != nil {
+		t.Fatal("old-style KID must not be in the public state")
+	}
+	if len(env.stub.private[collectionName]) != 1 {
+		t.Fatal("old-style KID must be in the private collection")
+	}
+	for _, data := range env.stub.private[collectionName] {
+		kid := &KID{}
+		if err := json.Unmarshal(data, kid); err != nil {
+			t.Fatal(err)
+		}
+		if kid.DOCTYPEID != p.ID || kid.Pin == nil || !kid.Pin.Match("1234") {
+			t.Errorf("unexpected old-style KID: %+v", kid)
+		}
+	}
+
+	// registering another certificate requires the PIN
+	alice2 := env.ca.reenroll(t, "alice", alice.key, nil)
+	runTxTests(t, env, []txTest{
+		{name: "without PIN", id: alice2, fn: "register", err: "failed to get the invoker's KID|mismatched PIN"},
+		{name: "wrong PIN", id: alice2, transient: map[string]string{"kiesnet-id/pin": "0000"}, fn: "register", err: "failed to get the invoker's KID|mismatched PIN"},
+		{name: "right PIN", id: alice2, transient: map[string]string{"kiesnet-id/pin": "1234"}, fn: "register"},
+	})
+}
+
+func TestGet(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+
+	runTxTests(t, env, []txTest{
+		{name: "not registered", id: alice, fn: "get", err: "failed to get the invoker's identity|not registrated certificate"},
+	})
+
+	p := env.register(alice, nil)
+	got := &identityPayload{}
+	env.mustInvoke(alice, nil, got, "get")
+	if *got != *p {
+		t.Errorf("expected %+v, but %+v", p, got)
+	}
+
+	// old-style KID doesn't need the PIN to get
+	bob := env.ca.enroll(t, "bob", nil)
+	env.register(bob, map[string]string{"kiesnet-id/pin": "1234"})
+	env.mustInvoke(bob, nil, nil, "get")
+}
+
+func TestKid(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	bob := env.ca.enroll(t, "bob", nil)
+	charlie := env.ca.enroll(t, "charlie", nil)
+
+	pa := env.register(alice, nil)
+	if id := env.mustInvoke(alice, nil, nil, "kid"); string(id) != pa.ID {
+		t.Errorf("expected %s, but %s", pa.ID, id)
+	}
+	if id := env.mustInvoke(alice, nil, nil, "kid", "true"); string(id) != pa.ID {
+		t.Errorf("expected %s, but %s", pa.ID, id)
+	}
+
+	pin := map[string]string{"kiesnet-id/pin": "1234"}
+	pb := env.register(bob, pin)
+	if id := env.mustInvoke(bob, pin, nil, "kid", "true"); string(id) != pb.ID {
+		t.Errorf("expected %s, but %s", pb.ID, id)
+	}
+
+	runTxTests(t, env, []txTest{
+		{name: "not registered", id: charlie, fn: "kid", err: "failed to get the invoker's identity|not registrated certificate"},
+		{name: "old-style without migr", id: bob, fn: "kid"},
+		{name: "old-style without PIN", id: bob, fn: "kid", params: []string{"true"}, err: "failed to get the invoker's identity|mismatched PIN"},
+		{name: "old-style wrong PIN", id: bob, transient: map[string]string{"kiesnet-id/pin": "4321"}, fn: "kid", params: []string{"true"}, err: "failed to get the invoker's identity|mismatched PIN"},
+	})
+}
+
+func TestMigration(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+
+	pin := map[string]string{"kiesnet-id/pin": "1234"}
+	p := env.register(alice, pin)
+
+	// clear the PIN, then the KID will be migrated by migr=true functions
+	env.mustInvoke(alice, map[string]string{"kiesnet-id/pin": "1234", "kiesnet-id/new_pin": ""}, nil, "pin")
+	if len(env.stub.private[collectionName]) != 1 {
+		t.Fatal("KID must not be migrated by clearing the PIN")
+	}
+
+	// migr=false doesn't migrate
+	env.mustInvoke(alice, nil, nil, "kid")
+	if env.kid(p.ID) != nil {
+		t.Fatal("KID must not be migrated without migr")
+	}
+
+	if id := env.mustInvoke(alice, nil, nil, "kid", "true"); string(id) != p.ID {
+		t.Fatalf("expected %s, but %s", p.ID, id)
+	}
+	kid := env.kid(p.ID)
+	if kid == nil || kid.Pin != nil {
+		t.Fatalf("KID must be migrated into the public state without PIN: %+v", kid)
+	}
+	if len(env.stub.private[collectionName]) != 0 {
+		t.Fatal("migrated KID must be deleted from the private collection")
+	}
+
+	// new-style now
+	runTxTests(t, env, []txTest{
+		{name: "pin", id: alice, fn: "pin", err: "not supported KID"},
+		{name: "lock", id: alice, fn: "lock"},
+	})
+}
+
+func TestAdminMSPs(t *testing.T) {
+	env := newTestEnv(t)
+	admin := env.ca.enroll(t, "admin", map[string]string{"kiesnet-id.admin": "true"})
+	foreign := env.ca.enroll(t, "admin", map[string]string{"kiesnet-id.admin": "true"}).withMSP(t, "ORG2")
+
+	env.mustInvoke(admin, nil, nil, "admin_kids_count")
+	runTxTests(t, env, []txTest{
+		{name: "foreign MSP", id: foreign, fn: "admin_kids_count", err: "failed to get the administrator's identity|not an administrator"},
+		{name: "foreign MSP", id: foreign, fn: "admin_claim_issuer", params: []string{"kyc", "ORG2"}, err: "failed to get the administrator's identity|not an administrator"},
+	})
+
+	if res := env.stub.initialize("", `["ORG1",""]`); res.Status == shim.OK {
+		t.Fatal("expected invalid MSP ID error")
+	}
+	if res := env.stub.initialize(); res.Status != shim.OK { // keeps the MSP IDs
+		t.Fatal(res.Message)
+	}
+	env.mustInvoke(admin, nil, nil, "admin_kids_count")
+	if res := env.stub.initialize("", `["ORG2"]`); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	env.mustInvoke(foreign, nil, nil, "admin_kids_count")
+	runTxTests(t, env, []txTest{
+		{name: "removed MSP", id: admin, fn: "admin_kids_count", err: "failed to get the administrator's identity|not an administrator"},
+	})
+
+	// not configured
+	env = newTestEnv(t)
+	delete(env.stub.state, AdminMSPsKey)
+	runTxTests(t, env, []txTest{
+		{name: "no admin MSPs", id: admin, fn: "admin_kids_count", err: "failed to get the administrator's identity|not an administrator"},
+	})
+}
+
+func TestAdminMigration(t *testing.T) {
+	env := newTestEnv(t)
+	admin := env.ca.enroll(t, "admin", map[string]string{"kiesnet-id.admin": "true"})
+	alice := env.ca.enroll(t, "alice", nil)
+	bob := env.ca.enroll(t, "bob", nil)
+	carol := env.ca.enroll(t, "carol", nil)
+	pa := env.register(alice, map[string]string{"kiesnet-id/pin": "1234"})
+	pb := env.register(bob, map[string]string{"kiesnet-id/pin": "1234"})
+	// bob is PIN-less
+	env.mustInvoke(bob, map[string]string{"kiesnet-id/pin": "1234", "kiesnet-id/new_pin": ""}, nil, "pin")
+	env.register(carol, nil) // new-style
+	if string(env.stub.state[keyStub(env).CreateKIDIDKey(pb.ID)]) != PrivateKIDMarker {
+		t.Fatal("the uuid of the private KID must not be public")
+	}
+	runTxTests(t, env, []txTest{
+		{name: "private KID by ID", id: carol, fn: "did", params: []string{pb.ID}, err: "failed to get the KID of the DID|not registered KID"},
+	})
+	// PIN-less KIDs of the very old version
+	for i := 0; i < PrivateKIDsFetchSize; i++ {
+		env.stub.private[collectionName][fmt.Sprintf("KID_old%02d", i)] = []byte(fmt.Sprintf(`{"@kid":"old%02d"}`, i))
+	}
+
+	runTxTests(t, env, []txTest{
+		{name: "not admin", id: alice, fn: "admin_kids", err: "failed to get the administrator's identity|not an administrator"},
+		{name: "not admin", id: alice, fn: "admin_kids_count", err: "failed to get the administrator's identity|not an administrator"},
+		{name: "not admin", id: alice, fn: "admin_migrate", params: []string{"KID_old00"}, err: "failed to get the administrator's identity|not an administrator"},
+		{name: "not admin", id: alice, fn: "admin_migration_deadline", params: []string{""}, err: "failed to get the administrator's identity|not an administrator"},
+		{name: "no keys", id: admin, fn: "admin_migrate", err: fmt.Sprintf("incorrect number of parameters. expecting 1 ~ %d", MigrationMaxBatchSize)},
+		{name: "invalid deadline", id: admin, fn: "admin_migration_deadline", params: []string{"tomorrow"}, err: "invalid deadline. expecting RFC3339 time"},
+	})
+
+	mc := &MigrationCount{}
+	env.mustInvoke(admin, nil, mc, "admin_kids_count")
+	if mc.Total != PrivateKIDsFetchSize+2 || mc.WithPIN != 1 {
+		t.Fatalf("unexpected count: %+v", mc)
+	}
+
+	// paging
+	type kidsPayload struct {
+		Meta struct {
+			FetchedRecordsCount int32  `json:"fetched_records_count"`
+			Bookmark            string `json:"bookmark"`
+		} `json:"meta"`
+		Records []*PrivateKID `json:"records"`
+	}
+	keys := map[string]*PrivateKID{}
+	for bookmark, pages := "", 0; pages == 0 || bookmark != ""; pages++ {
+		if pages > 1 {
+			t.Fatal("too many pages")
+		}
+		page := &kidsPayload{}
+		if data := env.mustInvoke(admin, nil, page, "admin_kids", bookmark); strings.Contains(string(data), "salt") {
+			t.Fatal("the PIN must not be listed")
+		}
+		if int(page.Meta.FetchedRecordsCount) != len(page.Records) {
+			t.Fatalf("unexpected page: %+v", page.Meta)
+		}
+		for _, record := range page.Records {
+			keys[record.KID] = record
+		}
+		bookmark = page.Meta.Bookmark
+	}
+	if len(keys) != mc.Total || !keys[pa.ID].HasPIN || keys[pb.ID].HasPIN {
+		t.Fatalf("unexpected KIDs: %d", len(keys))
+	}
+
+	mr := &MigrationResult{}
+	attemptKey := keyStub(env).CreatePINAttemptKey(pa.ID)
+	env.stub.private[collectionName][attemptKey] = []byte(`{"@pin_attempt":"` + pa.ID + `","failures":1}`)
+	env.stub.private[collectionName]["KID_empty"] = []byte(`{"@kid":""}`)
+	env.mustInvoke(admin, nil, mr, "admin_migrate", keys[pa.ID].Key, keys[pb.ID].Key, "KID_none", attemptKey, "KID_empty")
+	if len(mr.Migrated) != 1 || mr.Migrated[0] != pb.ID || len(mr.Skipped) != 4 {
+		t.Fatalf("unexpected result: %+v", mr)
+	}
+	if string(env.stub.state[keyStub(env).CreateKIDIDKey(pb.ID)]) != strings.TrimPrefix(keys[pb.ID].Key, "KID_") {
+		t.Error("reverse-lookup key is not stored")
+	}
+	if _, ok := env.stub.state[keyStub(env).CreateKIDIDKey("")]; ok {
+		t.Error("not a KID is migrated")
+	}
+	v := &Verification{}
+	env.mustInvoke(bob, nil, v, "verify")
+	if v.KID != pb.ID || v.OldStyle {
+		t.Errorf("expected migrated KID, but %+v", v)
+	}
+
+	// deadline
+	md := &MigrationDeadline{}
+	env.mustInvoke(admin, nil, md, "admin_migration_deadline", time.Now().Add(-time.Minute).UTC().Format(time.RFC3339))
+	if md.Deadline == nil {
+		t.Fatal("expected the deadline")
+	}
+	runTxTests(t, env, []txTest{
+		{name: "deadline", id: alice, transient: map[string]string{"kiesnet-id/pin": "1234"}, fn: "get", err: "failed to get the invoker's identity|old-style KID is no longer supported. migration required"},
+		{name: "new-style", id: bob, fn: "get"},
+		{name: "mismatched", id: alice, transient: map[string]string{"kiesnet-id/pin": "0000"}, fn: "kid", params: []string{"true"}, err: "failed to get the invoker's identity|mismatched PIN"},
+		{name: "forced migration", id: alice, transient: map[string]string{"kiesnet-id/pin": "1234"}, fn: "kid", params: []string{"true"}},
+		{name: "migrated", id: alice, fn: "get"},
+		{name: "no deadline", id: admin, fn: "admin_migration_deadline", params: []string{""}},
+	})
+	if _, ok := env.stub.state[MigrationDeadlineKey]; ok {
+		t.Error("expected no deadline")
+	}
+	mc = &MigrationCount{}
+	env.mustInvoke(admin, nil, mc, "admin_kids_count")
+	if mc.Total != PrivateKIDsFetchSize || mc.WithPIN != 0 {
+		t.Fatalf("unexpected count: %+v", mc)
+	}
+}
+
+func TestList(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	p := env.register(alice, nil)
+
+	// another identity's certificates must not be listed
+	env.register(env.ca.enroll(t, "bob", nil), nil)
+
+	total := CertificatesFetchSize + 5
+	sns := map[string]bool{alice.SN(): true}
+	for i := 1; i < total; i++ {
+		id := env.ca.reenroll(t, "alice", alice.key, nil)
+		env.register(id, nil)
+		sns[id.SN()] = true
+	}
+
+	page1 := &listPayload{}
+	env.mustInvoke(alice, nil, page1, "list")
+	if len(page1.Records) != CertificatesFetchSize || page1.Meta.FetchedRecordsCount != CertificatesFetchSize {
+		t.Fatalf("expected %d records, but %d", CertificatesFetchSize, len(page1.Records))
+	}
+	page2 := &listPayload{}
+	env.mustInvoke(alice, nil, page2, "list", page1.Meta.Bookmark)
+	if len(page2.Records) != total-CertificatesFetchSize {
+		t.Fatalf("expected %d records, but %d", total-CertificatesFetchSize, len(page2.Records))
+	}
+
+	for _, cert := range append(page1.Records, page2.Records...) {
+		if cert.DOCTYPEID != p.ID || !sns[cert.SN] {
+			t.Errorf("unexpected certificate: %+v", cert)
+		}
+		delete(sns, cert.SN)
+	}
+	if len(sns) > 0 {
+		t.Errorf("missing certificates: %v", sns)
+	}
+
+	runTxTests(t, env, []txTest{
+		{name: "not registered", id: env.ca.enroll(t, "charlie", nil), fn: "list", err: "failed to get the invoker's identity|not registrated certificate"},
+	})
+}
+
+func TestListOptions(t *testing.T) {
+	env := newTestEnv(t)
+	ids := []*testIdentity{env.ca.enroll(t, "alice", nil)}
+	for i := 1; i < 4; i++ {
+		ids = append(ids, env.ca.reenroll(t, "alice", ids[0].key, nil))
+	}
+	for _, id := range ids {
+		env.register(id, nil)
+	}
+	env.mustInvoke(ids[0], nil, nil, "revoke", ids[3].SN())
+	env.mustInvoke(ids[1], nil, nil, "lock")
+
+	type recordsPayload struct {
+		Meta struct {
+			Bookmark string `json:"bookmark"`
+		} `json:"meta"`
+		Records []*CertificateRecord `json:"records"`
+	}
+	list := func(bookmark, opts string) *recordsPayload {
+		t.Helper()
+		p := &recordsPayload{}
+		env.mustInvoke(ids[1], nil, p, "list", bookmark, opts)
+		return p
+	}
+	sns := func(p *recordsPayload) string {
+		sns := []string{}
+		for _, r := range p.Records {
+			for i, id := range ids {
+				if r.SN == id.SN() {
+					sns = append(sns, fmt.Sprint(i))
+				}
+			}
+		}
+		return strings.Join(sns, ",")
+	}
+
+	p := list("", "")
+	if got := sns(p); got != "0,1,2" {
+		t.Fatalf("expected 0,1,2, but %s", got)
+	}
+	for i, r := range p.Records {
+		if r.IsCurrent != (i == 1) || r.IsLocking != (i == 1) {
+			t.Errorf("unexpected flags of %d: %+v", i, r)
+		}
+	}
+
+	// the test CA issues the sequential serial numbers, so the index order is the created order
+	from := p.Records[1].CreatedTime.Time.UTC().Format(time.RFC3339Nano)
+	to := p.Records[2].CreatedTime.Time.UTC().Format(time.RFC3339Nano)
+	tests := []struct {
+		opts     string
+		expected string
+	}{
+		{`{}`, "0,1,2"},
+		{`{"revoked":"include"}`, "0,1,2,3"},
+		{`{"revoked":"only"}`, "3"},
+		{`{"revoked":"include","sort":"asc"}`, "0,1,2,3"},
+		{`{"revoked":"include","sort":"desc"}`, "3,2,1,0"},
+		{`{"revoked":"include","from":"` + from + `"}`, "1,2,3"},
+		{`{"revoked":"include","to":"` + to + `"}`, "0,1"},
+		{`{"revoked":"include","from":"` + from + `","to":"` + to + `"}`, "1"},
+		{`{"page_size":2,"sort":"desc"}`, "2,1"},
+	}
+	for _, tt := range tests {
+		if got := sns(list("", tt.opts)); got != tt.expected {
+			t.Errorf("%s: expected %s, but %s", tt.opts, tt.expected, got)
+		}
+	}
+
+	// paging
+	p = list("", `{"page_size":1,"revoked":"include","sort":"desc"}`)
+	got := sns(p)
+	for p.Meta.Bookmark != "" && len(p.Records) > 0 {
+		p = list(p.Meta.Bookmark, `{"page_size":1,"revoked":"include","sort":"desc"}`)
+		if len(p.Records) > 0 {
+			got += "," + sns(p)
+		}
+	}
+	if got != "3,2,1,0" {
+		t.Errorf("expected 3,2,1,0, but %s", got)
+	}
+
+	runTxTests(t, env, []txTest{
+		{name: "page size", id: ids[1], fn: "list", params: []string{"", `{"page_size":101}`}, err: "invalid page size. expecting 1 ~ 100"},
+		{name: "page size", id: ids[1], fn: "list", params: []string{"", `{"page_size":0}`}, err: "invalid page size. expecting 1 ~ 100"},
+		{name: "revoked", id: ids[1], fn: "list", params: []string{"", `{"revoked":"all"}`}, err: "invalid revoked filter [all]"},
+		{name: "sort", id: ids[1], fn: "list", params: []string{"", `{"sort":"up"}`}, err: "invalid sort order [up]"},
+		{name: "time", id: ids[1], fn: "list", params: []string{"", `{"from":"yesterday"}`}, err: "invalid time [yesterday]. expecting RFC3339 time"},
+		{name: "range", id: ids[1], fn: "list", params: []string{"", `{"from":"` + to + `","to":"` + from + `"}`}, err: "invalid time range. 'from' must be before 'to'"},
+		{name: "JSON", id: ids[1], fn: "list", params: []string{"", `{`}, err: "failed to unmarshal the list options: unexpected end of JSON input"},
+	})
+}
+
+func TestCertificateIndex(t *testing.T) {
+	env := newTestEnv(t)
+	admin := env.ca.enroll(t, "admin", map[string]string{"kiesnet-id.admin": "true"})
+	alice := env.ca.enroll(t, "alice", nil)
+	alice2 := env.ca.reenroll(t, "alice", alice.key, nil)
+	p := env.register(alice, nil)
+	env.register(alice2, nil)
+
+	indexed := func(status, sn string) bool {
+		key, _ := env.stub.CreateCompositeKey(CertificateIndex, []string{p.ID, status, sn})
+		_, ok := env.stub.state[key]
+		return ok
+	}
+	if !indexed(CertificateActive, alice2.SN()) || indexed(CertificateRevoked, alice2.SN()) {
+		t.Fatal("expected the active index")
+	}
+	env.mustInvoke(alice, nil, nil, "revoke", alice2.SN())
+	if indexed(CertificateActive, alice2.SN()) || !indexed(CertificateRevoked, alice2.SN()) {
+		t.Fatal("expected the revoked index")
+	}
+	env.mustInvoke(alice, nil, nil, "reactivate", alice2.SN())
+	if !indexed(CertificateActive, alice2.SN()) || indexed(CertificateRevoked, alice2.SN()) {
+		t.Fatal("expected the active index")
+	}
+
+	// LevelDB
+	env.stub.levelDB = true
+	env.mustInvoke(alice, nil, nil, "revoke", alice2.SN())
+	l := &listPayload{}
+	env.mustInvoke(alice, nil, l, "list")
+	if len(l.Records) != 1 || l.Records[0].SN != alice.SN() {
+		t.Fatalf("expected only the active certificate, but %+v", l.Records)
+	}
+	l = &listPayload{}
+	env.mustInvoke(alice, nil, l, "list", "", `{"revoked":"only"}`)
+	if len(l.Records) != 1 || l.Records[0].SN != alice2.SN() {
+		t.Fatalf("expected only the revoked certificate, but %+v", l.Records)
+	}
+	runTxTests(t, env, []txTest{
+		{name: "rich query", id: alice, fn: "list", params: []string{"", `{"sort":"desc"}`}, err: "failed to get certificate list"},
+	})
+	env.stub.levelDB = false
+
+	// backfill the index of the certificates created before the index (upgrade)
+	for key := range env.stub.state {
+		if strings.HasPrefix(key, "\x00"+CertificateIndex) {
+			delete(env.stub.state, key)
+		}
+	}
+	delete(env.stub.state, CertificateIndexCompleteKey)
+	env.stub.initialize()
+	if env.stub.state[CertificateIndexCompleteKey] != nil {
+		t.Fatal("the upgrade must not mark the index complete")
+	}
+	bob := env.ca.enroll(t, "bob", nil)
+	env.register(bob, nil)
+	// listed without the index
+	l = &listPayload{}
+	env.mustInvoke(alice, nil, l, "list", "", `{"revoked":"include"}`)
+	if len(l.Records) != 2 {
+		t.Fatalf("expected the certificates before the index, but %+v", l.Records)
+	}
+	// the incomplete index isn't trusted
+	notApproved := txTest{name: "other active", id: alice2, fn: "register", err: "failed to reactivate the certificate|reactivation must be approved by an active certificate"}
+	runTxTests(t, env, []txTest{notApproved})
+	rr := &ReindexResult{}
+	env.mustInvoke(admin, nil, rr, "admin_reindex", "", "2")
+	if rr.Indexed != 2 || rr.Bookmark == "" || env.stub.state[CertificateIndexCompleteKey] != nil {
+		t.Fatalf("unexpected result: %+v", rr)
+	}
+	env.mustInvoke(admin, nil, rr, "admin_reindex", rr.Bookmark)
+	if rr.Indexed != 1 || rr.Bookmark != "" {
+		t.Fatalf("unexpected result: %+v", rr)
+	}
+	if !indexed(CertificateActive, alice.SN()) || !indexed(CertificateRevoked, alice2.SN()) || env.stub.state[CertificateIndexCompleteKey] == nil {
+		t.Fatal("expected the backfilled index")
+	}
+	env.stub.levelDB = true
+	l = &listPayload{}
+	env.mustInvoke(alice, nil, l, "list", "", `{"revoked":"include"}`)
+	if len(l.Records) != 2 {
+		t.Fatalf("expected the reindexed certificates, but %+v", l.Records)
+	}
+	env.stub.levelDB = false
+	runTxTests(t, env, []txTest{
+		notApproved,
+		{name: "not admin", id: alice, fn: "admin_reindex", err: "failed to get the administrator's identity|not an administrator"},
+		{name: "limit", id: admin, fn: "admin_reindex", params: []string{"", "0"}, err: "invalid limit. expecting 1 ~ 1000"},
+	})
+}
+
+func TestCertificateDetails(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	alice2 := env.ca.reenroll(t, "alice", alice.key, nil)
+	p := env.register(alice, nil)
+	env.register(alice2, nil)
+
+	l := &listPayload{}
+	env.mustInvoke(alice, nil, l, "list")
+	if len(l.Records) != 2 {
+		t.Fatalf("expected 2 certificates, but %d", len(l.Records))
+	}
+	fp := sha256.Sum256(alice.cert.Raw)
+	for _, cert := range l.Records {
+		if cert.SN != alice.SN() {
+			continue
+		}
+		if cert.SubjectCN != "alice" || cert.Issuer != env.ca.cert.Subject.String() ||
+			cert.AuthorityKeyID != hex.EncodeToString(env.ca.cert.SubjectKeyId) || cert.AuthorityKeyID == "" ||
+			cert.NotBefore.Unix() != alice.cert.NotBefore.Unix() || cert.NotAfter.Unix() != alice.cert.NotAfter.Unix() ||
+			cert.PublicKeyAlgo != "ECDSA" || cert.Curve != "P-256" || cert.Fingerprint != hex.EncodeToString(fp[:]) {
+			t.Errorf("unexpected details: %+v", cert)
+		}
+	}
+
+	// the certificate registered before the details
+	key := keyStub(env).CreateCertificateKey(p.ID, alice2.SN())
+	legacy := NewCertificate(p.ID, alice2.SN())
+	legacy.CreatedTime = txtime.New(time.Now())
+	env.stub.state[key], _ = json.Marshal(legacy)
+	// reactivated by another certificate, no details
+	env.mustInvoke(alice, nil, nil, "revoke", alice2.SN())
+	cert := &Certificate{}
+	env.mustInvoke(alice, nil, cert, "reactivate", alice2.SN())
+	if cert.HasDetails() || cert.SubjectCN != "" {
+		t.Errorf("expected no details, but %+v", cert)
+	}
+	// re-registered by itself
+	env.mustInvoke(alice, nil, nil, "revoke", alice2.SN())
+	env.mustInvoke(alice, force, nil, "revoke", alice.SN())
+	env.mustInvoke(alice2, nil, nil, "register")
+	cert = &Certificate{}
+	if err := json.Unmarshal(env.stub.state[key], cert); err != nil {
+		t.Fatal(err)
+	}
+	if !cert.HasDetails() || cert.SubjectCN != "alice" || cert.ReactivatedCount != 2 {
+		t.Errorf("expected the backfilled details, but %+v", cert)
+	}
+}
+
+func TestCertificateExpiry(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	alice2 := env.ca.reenroll(t, "alice", alice.key, nil)
+	alice3 := env.ca.reenroll(t, "alice", alice.key, nil)
+	p := env.register(alice, nil)
+	env.register(alice2, nil)
+	env.register(alice3, nil)
+
+	// sets the stored validity window
+	setValidity := func(sn string, notBefore, notAfter time.Time) {
+		t.Helper()
+		key := keyStub(env).CreateCertificateKey(p.ID, sn)
+		cert := &Certificate{}
+		if err := json.Unmarshal(env.stub.state[key], cert); err != nil {
+			t.Fatal(err)
+		}
+		cert.NotBefore = txtime.New(notBefore)
+		cert.NotAfter = txtime.New(notAfter)
+		env.stub.state[key], _ = json.Marshal(cert)
+	}
+	setValidity(alice.SN(), time.Now().Add(-time.Hour), time.Now().Add(10*24*time.Hour))
+	setValidity(alice2.SN(), time.Now().Add(-time.Hour), time.Now().Add(-time.Second))
+	setValidity(alice3.SN(), time.Now().Add(time.Hour), time.Now().Add(400*24*time.Hour))
+
+	runTxTests(t, env, []txTest{
+		{name: "expired", id: alice2, fn: "get", err: "failed to get the invoker's identity|expired certificate"},
+		{name: "not yet valid", id: alice3, fn: "get", err: "failed to get the invoker's identity|not yet valid certificate"},
+		{name: "valid", id: alice, fn: "get"},
+		{name: "zero days", id: alice, fn: "expiring", params: []string{"0"}, err: "invalid days. expecting 1 ~ 365"},
+		{name: "too many days", id: alice, fn: "expiring", params: []string{"366"}, err: "invalid days. expecting 1 ~ 365"},
+		{name: "overflow", id: alice, fn: "expiring", params: []string{"9223372036854775807"}, err: "invalid days. expecting 1 ~ 365"},
+		{name: "negative overflow", id: alice, fn: "expiring", params: []string{"-9223372036854775807"}, err: "invalid days. expecting 1 ~ 365"},
+	})
+
+	env.stub.creator = alice2.creator
+	if r, err := verifier.Verify(env.stub); err != nil || !r.Expired || r.Revoked || r.Active() {
+		t.Errorf("expected the expired certificate, but %+v, %v", r, err)
+	}
+
+	expiring := func(days string) []*CertificateRecord {
+		t.Helper()
+		l := &struct {
+			Records []*CertificateRecord `json:"records"`
+		}{}
+		env.mustInvoke(alice, nil, l, "expiring", days)
+		return l.Records
+	}
+	if records := expiring("1"); len(records) != 1 || records[0].SN != alice2.SN() || !records[0].IsExpired {
+		t.Errorf("expected the expired certificate, but %+v", records)
+	}
+	if records := expiring(""); len(records) != 2 || records[0].SN != alice2.SN() || records[1].SN != alice.SN() || records[1].IsExpired || !records[1].IsCurrent {
+		t.Errorf("expected 2 expiring certificates, but %+v", records)
+	}
+
+	// the expired certificate is not active for the safeguards, and can't be reactivated
+	setValidity(alice3.SN(), time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+	runTxTests(t, env, []txTest{
+		{name: "revoke", id: alice, fn: "revoke", params: []string{alice3.SN()}},
+		{name: "revoke self", id: alice, transient: force, fn: "revoke", params: []string{alice.SN()}},
+		{name: "re-register without active", id: alice, fn: "register"},
+		{name: "revoke expired", id: alice, fn: "revoke", params: []string{alice2.SN()}},
+		{name: "reactivate expired", id: alice, fn: "reactivate", params: []string{alice2.SN()}, err: "failed to reactivate the certificate|expired certificate"},
+	})
+}
+
+func TestImportCRL(t *testing.T) {
+	env := newTestEnv(t)
+	admin := env.ca.enroll(t, "admin", map[string]string{"kiesnet-id.admin": "true"})
+	alice := env.ca.enroll(t, "alice", nil)
+	alice2 := env.ca.reenroll(t, "alice", alice.key, nil)
+	bob := env.ca.enroll(t, "bob", nil)
+	bob2 := env.ca.reenroll(t, "bob", bob.key, nil)
+	other := newTestCA(t, "ca.org2")
+	other.serial = alice2.cert.SerialNumber.Int64() - 1
+	carol := other.enroll(t, "carol", nil) // same SN of another issuer
+	pa := env.register(alice, nil)
+	env.register(alice2, nil)
+	pb := env.register(bob, nil)
+	env.register(bob2, nil)
+	pc := env.register(carol, nil)
+	if carol.SN() != alice2.SN() {
+		t.Fatal("expected the same SN")
+	}
+
+	// the certificate registered before the details
+	key := keyStub(env).CreateCertificateKey(pb.ID, bob2.SN())
+	legacy := NewCertificate(pb.ID, bob2.SN())
+	legacy.CreatedTime = txtime.New(time.Now())
+	env.stub.state[key], _ = json.Marshal(legacy)
+
+	revokedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	crl := env.ca.crl(t, revokedAt, map[int64]int{
+		alice2.cert.SerialNumber.Int64(): 1,
+		bob2.cert.SerialNumber.Int64():   -1,
+		9999:                             4, // not registered
+	})
+	cr := &CRLImportResult{}
+	env.mustInvoke(admin, nil, cr, "admin_import_crl", string(crl))
+	if cr.Issuer != env.ca.cert.Subject.String() || cr.Entries != 3 || len(cr.Revoked) != 2 || len(cr.AlreadyRevoked) != 0 || len(cr.Mismatched) != 1 {
+		t.Fatalf("unexpected result: %+v", cr)
+	}
+	for _, m := range cr.Revoked {
+		if !(m.KID == pa.ID && m.SN == alice2.SN() && m.Reason == "keyCompromise") && !(m.KID == pb.ID && m.SN == bob2.SN() && m.Reason == "unspecified") {
+			t.Errorf("unexpected revoked: %+v", m)
+		}
+	}
+	if m := cr.Mismatched[0]; m.KID != pc.ID || m.SN != carol.SN() {
+		t.Errorf("unexpected mismatched: %+v", m)
+	}
+
+	cert := &Certificate{}
+	if err := json.Unmarshal(env.stub.state[keyStub(env).CreateCertificateKey(pa.ID, alice2.SN())], cert); err != nil {
+		t.Fatal(err)
+	}
+	if cert.RevokedTime == nil || cert.RevokedTime.Unix() != revokedAt.Unix() || cert.RevocationReason != "keyCompromise" {
+		t.Errorf("unexpected revocation: %+v", cert)
+	}
+	runTxTests(t, env, []txTest{
+		{name: "revoked", id: alice2, fn: "get", err: "failed to get the invoker's identity|revoked certificate"},
+		{name: "revoked without the details", id: bob2, fn: "get", err: "failed to get the invoker's identity|revoked certificate"},
+		{name: "another issuer", id: carol, fn: "get"},
+	})
+
+	// base64 DER, already revoked
+	block, _ := pem.Decode(crl)
+	cr = &CRLImportResult{}
+	env.mustInvoke(admin, nil, cr, "admin_import_crl", base64.StdEncoding.EncodeToString(block.Bytes))
+	if len(cr.Revoked) != 0 || len(cr.AlreadyRevoked) != 2 || len(cr.Mismatched) != 1 {
+		t.Fatalf("unexpected result: %+v", cr)
+	}
+
+	// the certificate revoked by the CA can't be reactivated
+	runTxTests(t, env, []txTest{
+		{name: "reactivate", id: alice, fn: "reactivate", params: []string{alice2.SN()}, err: "failed to reactivate the certificate|the certificate revoked by the CA can't be reactivated"},
+		{name: "re-register", id: alice2, fn: "register", err: "failed to reactivate the certificate|the certificate revoked by the CA can't be reactivated"},
+		{name: "not admin", id: alice, fn: "admin_import_crl", params: []string{string(crl)}, err: "failed to get the administrator's identity|not an administrator"},
+		{name: "invalid", id: admin, fn: "admin_import_crl", params: []string{"abc!"}, err: "invalid CRL. expecting PEM or base64 DER"},
+		{name: "no CRL", id: admin, fn: "admin_import_crl", err: "incorrect number of parameters. expecting 1"},
+	})
+
+	// revoked by the user before the CRL
+	alice3 := env.ca.reenroll(t, "alice", alice.key, nil)
+	env.register(alice3, nil)
+	env.mustInvoke(alice, nil, nil, "revoke", alice3.SN())
+	cr = &CRLImportResult{}
+	env.mustInvoke(admin, nil, cr, "admin_import_crl", string(env.ca.crl(t, revokedAt, map[int64]int{alice3.cert.SerialNumber.Int64(): 1})))
+	if len(cr.AlreadyRevoked) != 1 || cr.AlreadyRevoked[0].SN != alice3.SN() {
+		t.Fatalf("unexpected result: %+v", cr)
+	}
+	runTxTests(t, env, []txTest{
+		{name: "reactivate revoked by both", id: alice, fn: "reactivate", params: []string{alice3.SN()}, err: "failed to reactivate the certificate|the certificate revoked by the CA can't be reactivated"},
+	})
+
+	// the locking certificate
+	alice4 := env.ca.reenroll(t, "alice", alice.key, nil)
+	env.register(alice4, nil)
+	env.mustInvoke(alice4, nil, nil, "lock", "3600")
+	runTxTests(t, env, []txTest{
+		{name: "locked", id: alice, fn: "get", err: "failed to get the invoker's identity|not locked certificate"},
+	})
+	cr = &CRLImportResult{}
+	env.mustInvoke(admin, nil, cr, "admin_import_crl", string(env.ca.crl(t, revokedAt, map[int64]int{alice4.cert.SerialNumber.Int64(): 1})))
+	if len(cr.Revoked) != 1 || len(cr.Unlocked) != 1 || cr.Unlocked[0].KID != pa.ID || cr.Unlocked[0].SN != alice4.SN() {
+		t.Fatalf("unexpected result: %+v", cr)
+	}
+	kid := &KID{}
+	env.mustInvoke(alice, nil, kid, "unlock")
+	if kid.Lock != "" || kid.LockExpiryTime != nil {
+		t.Errorf("expected the unlocked KID, but %+v", kid)
+	}
+	runTxTests(t, env, []txTest{
+		{name: "unlocked", id: alice, fn: "get"},
+		{name: "revoked locking", id: alice4, fn: "unlock", err: "failed to get the invoker's identity|revoked certificate"},
+	})
+}
+
+func TestParseCRL(t *testing.T) {
+	ca := newTestCA(t, "ca.org1")
+	for i := 0; i < 1000; i++ { // the DER ending with a space byte
+		block, _ := pem.Decode(ca.crl(t, time.Now(), map[int64]int{int64(i): 1}))
+		if !bytes.Equal(block.Bytes, bytes.TrimSpace(block.Bytes)) {
+			if _, err := ParseCRL(base64.StdEncoding.EncodeToString(block.Bytes)); err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+	}
+	t.Fatal("expected the DER ending with a space byte")
+}
+
+func TestLabel(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	alice2 := env.ca.reenroll(t, "alice", alice.key, nil)
+	bob := env.ca.enroll(t, "bob", nil)
+	env.register(alice, nil)
+	env.register(alice2, nil)
+	env.register(bob, nil)
+
+	cert := &Certificate{}
+	env.mustInvoke(alice, nil, cert, "label", "", "Alice's phone (work)", `{"os":"android 9","app_version":"1.2.0"}`)
+	if cert.SN != alice.SN() || cert.Label != "Alice's phone (work)" || cert.Metadata["os"] != "android 9" || len(cert.Metadata) != 2 {
+		t.Fatalf("unexpected certificate: %+v", cert)
+	}
+	// another certificate of the KID, keeps the metadata
+	env.mustInvoke(alice, nil, nil, "label", alice2.SN(), "태블릿", `{"os":"ios 12"}`)
+	cert = &Certificate{}
+	env.mustInvoke(alice, nil, cert, "label", alice2.SN(), "tablet")
+	if cert.Label != "tablet" || cert.Metadata["os"] != "ios 12" {
+		t.Fatalf("unexpected certificate: %+v", cert)
+	}
+
+	l := &listPayload{}
+	env.mustInvoke(alice2, nil, l, "list")
+	for _, c := range l.Records {
+		if (c.SN == alice.SN() && c.Label != "Alice's phone (work)") || (c.SN == alice2.SN() && c.Label != "tablet") {
+			t.Errorf("unexpected label: %+v", c)
+		}
+	}
+	p := &struct {
+		Label    string            `json:"label"`
+		Metadata map[string]string `json:"metadata"`
+	}{}
+	env.mustInvoke(alice2, nil, p, "get")
+	if p.Label != "tablet" || p.Metadata["os"] != "ios 12" {
+		t.Errorf("unexpected identity: %+v", p)
+	}
+
+	// removes
+	cert = &Certificate{}
+	env.mustInvoke(alice, nil, cert, "label", alice2.SN(), "", "{}")
+	if cert.Label != "" || cert.Metadata != nil {
+		t.Errorf("expected no label, but %+v", cert)
+	}
+
+	runTxTests(t, env, []txTest{
+		{name: "another KID", id: bob, fn: "label", params: []string{alice.SN(), "phone"}, err: "failed to get the certificate to be labeled|not registrated certificate"},
+		{name: "no label", id: alice, fn: "label", params: []string{""}, err: "incorrect number of parameters. expecting 2 ~ 3"},
+		{name: "long label", id: alice, fn: "label", params: []string{"", strings.Repeat("a", 33)}, err: "invalid label. expecting up to 32 characters"},
+		{name: "charset", id: alice, fn: "label", params: []string{"", "phone<script>"}, err: "invalid label. expecting letters, digits, spaces or -_.'()"},
+		{name: "spaces", id: alice, fn: "label", params: []string{"", " phone"}, err: "invalid label. expecting no leading or trailing spaces"},
+		{name: "metadata", id: alice, fn: "label", params: []string{"", "phone", `["ios"]`}, err: "invalid metadata. expecting JSON object of strings"},
+		{name: "metadata key", id: alice, fn: "label", params: []string{"", "phone", `{"OS":"ios"}`}, err: "invalid metadata key [OS]"},
+		{name: "metadata value", id: alice, fn: "label", params: []string{"", "phone", `{"os":"` + strings.Repeat("a", 65) + `"}`}, err: "invalid metadata [os]. expecting up to 64 characters"},
+		{name: "metadata control", id: alice, fn: "label", params: []string{"", "phone", `{"os":"a\nb"}`}, err: "invalid metadata [os]. expecting printable characters"},
+		{name: "metadata size", id: alice, fn: "label", params: []string{"", "phone", `{"a":"","b":"","c":"","d":"","e":"","f":"","g":"","h":"","i":""}`}, err: "invalid metadata. expecting up to 8 entries"},
+	})
+}
+
+func TestAlias(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	bob := env.ca.enroll(t, "bob", nil)
+	carol := env.ca.enroll(t, "carol", nil)
+	pa := env.register(alice, nil)
+	pb := env.register(bob, nil)
+	pc := env.register(carol, nil)
+
+	a := &Alias{}
+	env.mustInvoke(alice, nil, a, "alias_claim", " Alice.Kim ")
+	if a.DOCTYPEID != "alice.kim" || a.KID != pa.ID || a.CreatedTime == nil {
+		t.Fatalf("unexpected alias: %+v", a)
+	}
+	a = &Alias{}
+	env.mustInvoke(carol, nil, a, "resolve", "ALICE.KIM")
+	if a.KID != pa.ID {
+		t.Fatalf("unexpected alias: %+v", a)
+	}
+	p := &struct {
+		Alias string `json:"alias"`
+	}{}
+	env.mustInvoke(alice, nil, p, "get")
+	if p.Alias != "alice.kim" {
+		t.Errorf("expected the alias, but %+v", p)
+	}
+
+	env.mustInvoke(carol, nil, nil, "alias_claim", "carol")
+	runTxTests(t, env, []txTest{
+		{name: "taken", id: bob, fn: "alias_claim", params: []string{"alice.KIM"}, err: "failed to claim the alias|already registered alias"},
+		{name: "second alias", id: alice, fn: "alias_claim", params: []string{"alice2"}, err: "failed to claim the alias|the KID already has an alias"},
+		{name: "short", id: bob, fn: "alias_claim", params: []string{"bo"}, err: "invalid alias. expecting 3 ~ 32 characters"},
+		{name: "long", id: bob, fn: "alias_claim", params: []string{strings.Repeat("b", 33)}, err: "invalid alias. expecting 3 ~ 32 characters"},
+		{name: "charset", id: bob, fn: "alias_claim", params: []string{"bob kim"}, err: "invalid alias. expecting letters and digits separated by '.', '_' or '-', starting with a letter"},
+		{name: "separators", id: bob, fn: "alias_claim", params: []string{"bob..kim"}, err: "invalid alias. expecting letters and digits separated by '.', '_' or '-', starting with a letter"},
+		{name: "digit", id: bob, fn: "alias_claim", params: []string{"1bob"}, err: "invalid alias. expecting letters and digits separated by '.', '_' or '-', starting with a letter"},
+		{name: "reserved", id: bob, fn: "alias_claim", params: []string{"Admin"}, err: "invalid alias. reserved word [admin]"},
+		{name: "not registered", id: bob, fn: "resolve", params: []string{"bob"}, err: "failed to resolve the alias|not registered alias"},
+		{name: "release not owner", id: bob, fn: "alias_release", params: []string{"alice.kim"}, err: "failed to release the alias|not the owner of the alias"},
+		{name: "transfer not owner", id: bob, fn: "alias_transfer", params: []string{"alice.kim", pb.ID}, err: "failed to transfer the alias|not the owner of the alias"},
+		{name: "transfer to aliased", id: alice, fn: "alias_transfer", params: []string{"alice.kim", pc.ID}, err: "failed to transfer the alias|the KID already has an alias"},
+		{name: "transfer to unknown", id: alice, fn: "alias_transfer", params: []string{"alice.kim", unknownKID}, err: "failed to get the KID to receive the alias|not registered KID"},
+		{name: "transfer to injection", id: alice, fn: "alias_transfer", params: []string{"alice.kim", injectionKID}, err: "failed to get the KID to receive the alias|invalid KID. expecting 40 lowercase hex characters"},
+	})
+
+	// transfer
+	a = &Alias{}
+	env.mustInvoke(alice, nil, a, "alias_transfer", "alice.kim", pb.ID)
+	if a.KID != pb.ID || env.kid(pa.ID).Alias != "" || env.kid(pb.ID).Alias != "alice.kim" {
+		t.Fatalf("unexpected transfer: %+v", a)
+	}
+	a = &Alias{}
+	env.mustInvoke(carol, nil, a, "resolve", "alice.kim")
+	if a.KID != pb.ID {
+		t.Fatalf("unexpected alias: %+v", a)
+	}
+
+	// release
+	env.mustInvoke(bob, nil, nil, "alias_release", "alice.kim")
+	if env.kid(pb.ID).Alias != "" {
+		t.Fatal("expected no alias")
+	}
+	runTxTests(t, env, []txTest{
+		{name: "released", id: carol, fn: "resolve", params: []string{"alice.kim"}, err: "failed to resolve the alias|not registered alias"},
+		{name: "claim released", id: alice, fn: "alias_claim", params: []string{"alice.kim"}},
+	})
+}
+
+func TestClaims(t *testing.T) {
+	env := newTestEnv(t)
+	admin := env.ca.enroll(t, "admin", map[string]string{"kiesnet-id.admin": "true"})
+	kyc := env.ca.enroll(t, "kyc", map[string]string{ClaimIssuerAttribute: "kyc"})
+	other := env.ca.enroll(t, "other", map[string]string{ClaimIssuerAttribute: "other"})
+	alice := env.ca.enroll(t, "alice", nil)
+	pa := env.register(alice, nil)
+
+	ci := &ClaimIssuer{}
+	env.mustInvoke(admin, nil, ci, "admin_claim_issuer", "kyc", testMSPID)
+	if ci.DOCTYPEID != "kyc" || ci.MSPID != testMSPID || ci.UpdatedTime == nil {
+		t.Fatalf("unexpected issuer: %+v", ci)
+	}
+	env.mustInvoke(admin, nil, nil, "admin_claim_issuer", "other", "ORG2") // MSP ID mismatch
+
+	expiry := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	c := &Claim{}
+	env.mustInvoke(kyc, nil, c, "claim_set", pa.ID, "adult")
+	if c.DOCTYPEID != pa.ID || c.Type != "adult" || c.Value != "" || c.Issuer != "kyc" || c.IssuerMSP != testMSPID || c.IssuerSN != kyc.SN() || c.CreatedTime == nil || c.ExpiryTime != nil {
+		t.Fatalf("unexpected claim: %+v", c)
+	}
+	env.mustInvoke(kyc, nil, nil, "claim_set", pa.ID, "country", "KR", expiry)
+
+	hasClaim := func(params ...string) bool {
+		t.Helper()
+		cc := &ClaimCheck{}
+		env.mustInvoke(admin, nil, cc, "has_claim", params...)
+		return cc.HasClaim
+	}
+	if !hasClaim(pa.ID, "adult") || !hasClaim(pa.ID, "country", "KR") || !hasClaim(pa.ID, "country", "", "kyc") {
+		t.Error("expected the claims")
+	}
+	if hasClaim(pa.ID, "country", "US") || hasClaim(pa.ID, "country", "", "other") || hasClaim(pa.ID, "email") {
+		t.Error("expected no claim")
+	}
+
+	// update
+	c = &Claim{}
+	env.mustInvoke(kyc, nil, c, "claim_set", pa.ID, "country", "JP")
+	if c.Value != "JP" || c.ExpiryTime != nil || c.CreatedTime.Cmp(c.UpdatedTime) > 0 {
+		t.Errorf("unexpected claim: %+v", c)
+	}
+	if hasClaim(pa.ID, "country", "KR") || !hasClaim(pa.ID, "country", "JP") {
+		t.Error("expected the updated claim")
+	}
+
+	// revoke
+	c = &Claim{}
+	env.mustInvoke(kyc, nil, c, "claim_revoke", pa.ID, "adult")
+	if c.RevokedTime == nil || hasClaim(pa.ID, "adult") {
+		t.Errorf("expected the revoked claim, but %+v", c)
+	}
+
+	// expired
+	key, _ := keyStub(env).CreateClaimKey(pa.ID, "country", "kyc")
+	c = &Claim{}
+	if err := json.Unmarshal(env.stub.state[key], c); err != nil {
+		t.Fatal(err)
+	}
+	c.ExpiryTime = txtime.New(time.Now().Add(-time.Second))
+	env.stub.state[key], _ = json.Marshal(c)
+	if hasClaim(pa.ID, "country") {
+		t.Error("expected the expired claim")
+	}
+
+	l := &ClaimList{}
+	env.mustInvoke(alice, nil, l, "claims")
+	if len(l.Records) != 2 || l.Records[0].IsValid || l.Records[1].IsValid {
+		t.Errorf("expected 2 invalid claims, but %+v", l.Records)
+	}
+	env.mustInvoke(kyc, nil, nil, "claim_set", pa.ID, "adult") // reissue
+	if !hasClaim(pa.ID, "adult") {
+		t.Error("expected the reissued claim")
+	}
+
+	runTxTests(t, env, []txTest{
+		{name: "not issuer", id: alice, fn: "claim_set", params: []string{pa.ID, "adult"}, err: "failed to get the claim issuer|not a claim issuer"},
+		{name: "MSP mismatch", id: other, fn: "claim_set", params: []string{pa.ID, "adult"}, err: "failed to get the claim issuer|not a claim issuer"},
+		{name: "not registered KID", id: kyc, fn: "claim_set", params: []string{unknownKID, "adult"}, err: "failed to get the KID of the claim|not registered KID"},
+		{name: "injection KID", id: kyc, fn: "claim_set", params: []string{injectionKID, "adult"}, err: "failed to get the KID of the claim|invalid KID. expecting 40 lowercase hex characters"},
+		{name: "type", id: kyc, fn: "claim_set", params: []string{pa.ID, "Adult"}, err: "invalid claim type. expecting 1 ~ 32 lowercase letters, digits or _.- starting with a letter"},
+		{name: "value", id: kyc, fn: "claim_set", params: []string{pa.ID, "country", strings.Repeat("a", 129)}, err: "invalid claim value. expecting up to 128 characters"},
+		{name: "expiry", id: kyc, fn: "claim_set", params: []string{pa.ID, "country", "KR", "tomorrow"}, err: "invalid claim expiry. expecting RFC3339 time"},
+		{name: "past expiry", id: kyc, fn: "claim_set", params: []string{pa.ID, "country", "KR", "2018-01-01T00:00:00Z"}, err: "claim expiry must be after the transaction time"},
+		{name: "no claim", id: kyc, fn: "claim_revoke", params: []string{pa.ID, "email"}, err: "failed to get the claim|no claim"},
+		{name: "other's claim", id: other, fn: "claim_revoke", params: []string{pa.ID, "adult"}, err: "failed to get the claim issuer|not a claim issuer"},
+		{name: "revoke revoked", id: kyc, fn: "claim_revoke", params: []string{pa.ID, "country"}},
+		{name: "already revoked", id: kyc, fn: "claim_revoke", params: []string{pa.ID, "country"}, err: "failed to revoke the claim|already revoked claim"},
+		{name: "not admin", id: kyc, fn: "admin_claim_issuer", params: []string{"kyc", ""}, err: "failed to get the administrator's identity|not an administrator"},
+		{name: "issuer name", id: admin, fn: "admin_claim_issuer", params: []string{"KYC", testMSPID}, err: "invalid issuer. expecting 1 ~ 32 lowercase letters, digits or _.- starting with a letter"},
+		{name: "remove issuer", id: admin, fn: "admin_claim_issuer", params: []string{"kyc", ""}},
+		{name: "removed issuer", id: kyc, fn: "claim_set", params: []string{pa.ID, "adult"}, err: "failed to get the claim issuer|not a claim issuer"},
+	})
+	if hasClaim(pa.ID, "adult") {
+		t.Error("expected no claim of the removed issuer")
+	}
+
+	// the released name re-registered under another MSP
+	env.mustInvoke(admin, nil, nil, "admin_claim_issuer", "kyc", "ORG2")
+	if hasClaim(pa.ID, "adult") || hasClaim(pa.ID, "adult", "", "kyc") {
+		t.Error("expected no claim of the former registration")
+	}
+	c = &Claim{}
+	env.mustInvoke(kyc.withMSP(t, "ORG2"), nil, c, "claim_set", pa.ID, "adult")
+	if c.IssuerMSP != "ORG2" || !hasClaim(pa.ID, "adult") {
+		t.Errorf("expected the claim of the new registration, but %+v", c)
+	}
+}
+
+func TestDID(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	alice2 := env.ca.reenroll(t, "alice", alice.key, nil)
+	bob := env.ca.enroll(t, "bob", nil)
+	p := env.register(alice, nil)
+	env.register(alice2, nil)
+	env.register(bob, nil)
+	env.mustInvoke(alice, nil, nil, "revoke", alice2.SN())
+
+	did := DIDPrefix + p.ID
+	resolve := func(id string) *DIDDocument {
+		t.Helper()
+		doc := &DIDDocument{}
+		env.mustInvoke(bob, nil, doc, "did", id)
+		return doc
+	}
+	doc := resolve(did)
+	if doc.ID != did || len(doc.Context) != 2 || len(doc.VerificationMethod) != 2 || len(doc.Service) != 0 {
+		t.Fatalf("unexpected document: %+v", doc)
+	}
+	vm := doc.VerificationMethod[0]
+	x := make([]byte, 32)
+	alice.key.X.FillBytes(x)
+	if vm.ID != did+"#"+alice.SN() || vm.Type != "JsonWebKey2020" || vm.Controller != did || vm.Revoked != nil || vm.Expires == nil ||
+		vm.PublicKeyJwk.Kty != "EC" || vm.PublicKeyJwk.Crv != "P-256" || vm.PublicKeyJwk.X != base64.RawURLEncoding.EncodeToString(x) {
+		t.Errorf("unexpected verification method: %+v, %+v", vm, vm.PublicKeyJwk)
+	}
+	if vm := doc.VerificationMethod[1]; vm.ID != did+"#"+alice2.SN() || vm.Revoked == nil {
+		t.Errorf("expected the revoked key, but %+v", vm)
+	}
+	if len(doc.Authentication) != 1 || doc.Authentication[0] != did+"#"+alice.SN() || len(doc.AssertionMethod) != 1 {
+		t.Errorf("expected the active key only, but %v, %v", doc.Authentication, doc.AssertionMethod)
+	}
+	if doc := resolve(p.ID); doc.ID != did {
+		t.Errorf("expected the document of the KID, but %+v", doc)
+	}
+
+	// services
+	ds := &DIDServices{}
+	env.mustInvoke(alice, nil, ds, "did_service", "hub", "IdentityHub", "https://hub.example.com/alice")
+	env.mustInvoke(alice, nil, ds, "did_service", "pay", "LinkedDomains", "https://pay.example.com")
+	env.mustInvoke(alice, nil, ds, "did_service", "hub", "IdentityHub", "https://hub2.example.com/alice")
+	if len(ds.Services) != 2 || ds.Services[0].ServiceEndpoint != "https://hub2.example.com/alice" {
+		t.Fatalf("unexpected services: %+v", ds.Services)
+	}
+	doc = resolve(did)
+	if len(doc.Service) != 2 || doc.Service[0].ID != did+"#hub" || doc.Service[1].Type != "LinkedDomains" {
+		t.Errorf("unexpected services: %+v", doc.Service)
+	}
+	env.mustInvoke(alice, nil, ds, "did_service", "pay")
+	if doc = resolve(did); len(doc.Service) != 1 || doc.Service[0].ID != did+"#hub" {
+		t.Errorf("expected the removed service, but %+v", doc.Service)
+	}
+	for i := 0; i < DIDServiceMaxCount-1; i++ {
+		env.mustInvoke(alice, nil, nil, "did_service", fmt.Sprintf("s%d", i), "LinkedDomains", "https://example.com")
+	}
+	runTxTests(t, env, []txTest{
+		{name: "too many", id: alice, fn: "did_service", params: []string{"s10", "LinkedDomains", "https://example.com"}, err: "too many services. expecting up to 10"},
+	})
+
+	// the certificate registered before the public keys
+	key := keyStub(env).CreateCertificateKey(p.ID, alice.SN())
+	cert := &Certificate{}
+	if err := json.Unmarshal(env.stub.state[key], cert); err != nil {
+		t.Fatal(err)
+	}
+	cert.PublicKey = ""
+	env.stub.state[key], _ = json.Marshal(cert)
+	if doc = resolve(did); len(doc.VerificationMethod) != 1 || len(doc.Authentication) != 0 {
+		t.Errorf("expected no public key, but %+v", doc.VerificationMethod)
+	}
+	env.mustInvoke(alice, nil, nil, "did_service", "s0")
+	if doc = resolve(did); len(doc.VerificationMethod) != 2 || len(doc.Authentication) != 1 {
+		t.Errorf("expected the published public key, but %+v", doc.VerificationMethod)
+	}
+
+	runTxTests(t, env, []txTest{
+		{name: "service ID", id: alice, fn: "did_service", params: []string{"a#b", "LinkedDomains", "https://example.com"}, err: "invalid service ID. expecting 1 ~ 32 letters, digits, _ or -"},
+		{name: "service type", id: alice, fn: "did_service", params: []string{"hub", "Identity Hub", "https://example.com"}, err: "invalid service type. expecting printable ASCII without spaces"},
+		{name: "endpoint", id: alice, fn: "did_service", params: []string{"hub", "IdentityHub", "example.com/alice"}, err: "invalid service endpoint. expecting absolute URI"},
+		{name: "parameters", id: alice, fn: "did_service", params: []string{"hub", "IdentityHub"}, err: "incorrect number of parameters. expecting 1 or 3"},
+		{name: "other method", id: bob, fn: "did", params: []string{"did:web:example.com"}, err: "invalid DID. expecting did:kiesnet:<kid>"},
+		{name: "not registered", id: bob, fn: "did", params: []string{DIDPrefix + unknownKID}, err: "failed to get the KID of the DID|not registered KID"},
+		{name: "injection", id: bob, fn: "did", params: []string{DIDPrefix + injectionKID}, err: "failed to get the KID of the DID|invalid KID. expecting 40 lowercase hex characters"},
+	})
+}
+
+func TestVerifySig(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	key2, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice2 := env.ca.reenroll(t, "alice", key2, nil)
+	key3, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice3 := env.ca.reenroll(t, "alice", key3, nil)
+	bob := env.ca.enroll(t, "bob", nil)
+	p := env.register(alice, nil)
+	env.register(alice2, nil)
+	env.register(alice3, nil)
+	q := env.register(bob, nil)
+
+	h := sha256.Sum256([]byte("login nonce"))
+	digest := hex.EncodeToString(h[:])
+	sign := func(key *ecdsa.PrivateKey, digest []byte) string {
+		t.Helper()
+		sig, err := ecdsa.SignASN1(rand.Reader, key, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(sig)
+	}
+	sig1, sig2, sig3 := sign(alice.key, h[:]), sign(key2, h[:]), sign(key3, h[:])
+	verify := func(kid, sn, digest, sig string) *SignatureVerification {
+		t.Helper()
+		sv := &SignatureVerification{}
+		env.mustInvoke(bob, nil, sv, "verify_sig", kid, sn, digest, sig)
+		return sv
+	}
+
+	if sv := verify(p.ID, "any", digest, sig1); !sv.Verified || sv.KID != p.ID || sv.SN != alice.SN() {
+		t.Errorf("expected verified by alice, but %+v", sv)
+	}
+	if sv := verify(DIDPrefix+p.ID, "any", digest, sig2); !sv.Verified || sv.SN != alice2.SN() {
+		t.Errorf("expected verified by alice2, but %+v", sv)
+	}
+	if sv := verify(p.ID, alice2.SN(), digest, sig2); !sv.Verified || sv.SN != alice2.SN() {
+		t.Errorf("expected verified by the SN, but %+v", sv)
+	}
+	if sv := verify(p.ID, alice.SN(), digest, sig2); sv.Verified || sv.SN != "" {
+		t.Errorf("expected the other key not verified, but %+v", sv)
+	}
+	if sv := verify(q.ID, "any", digest, sig1); sv.Verified {
+		t.Errorf("expected the other KID not verified, but %+v", sv)
+	}
+	h2 := sha256.Sum256([]byte("another nonce"))
+	if sv := verify(p.ID, "any", hex.EncodeToString(h2[:]), sig1); sv.Verified {
+		t.Errorf("expected the other digest not verified, but %+v", sv)
+	}
+	h384 := sha512.Sum384([]byte("login nonce"))
+	if sv := verify(p.ID, "any", hex.EncodeToString(h384[:]), sign(alice.key, h384[:])); !sv.Verified {
+		t.Errorf("expected SHA-384 verified, but %+v", sv)
+	}
+
+	// revoked
+	env.mustInvoke(alice, nil, nil, "revoke", alice2.SN())
+	if sv := verify(p.ID, "any", digest, sig2); sv.Verified {
+		t.Errorf("expected the revoked key not verified, but %+v", sv)
+	}
+	if sv := verify(p.ID, alice2.SN(), digest, sig2); sv.Verified {
+		t.Errorf("expected the revoked key not verified by the SN, but %+v", sv)
+	}
+
+	// locked with alice
+	env.mustInvoke(alice, nil, nil, "lock")
+	if sv := verify(p.ID, "any", digest, sig3); sv.Verified {
+		t.Errorf("expected the key not verified while locked, but %+v", sv)
+	}
+	if sv := verify(p.ID, "any", digest, sig1); !sv.Verified {
+		t.Errorf("expected the locking key verified, but %+v", sv)
+	}
+	env.mustInvoke(alice, nil, nil, "unlock")
+	if sv := verify(p.ID, "any", digest, sig3); !sv.Verified || sv.SN != alice3.SN() {
+		t.Errorf("expected verified after the unlock, but %+v", sv)
+	}
+
+	runTxTests(t, env, []txTest{
+		{name: "parameters", id: bob, fn: "verify_sig", params: []string{p.ID, "any", digest}, err: "incorrect number of parameters. expecting 4"},
+		{name: "empty SN", id: bob, fn: "verify_sig", params: []string{p.ID, "", digest, sig1}, err: `invalid serial number. expecting the SN or "any"`},
+		{name: "digest", id: bob, fn: "verify_sig", params: []string{p.ID, "any", "abcd", sig1}, err: "invalid digest. expecting hex SHA-256, SHA-384 or SHA-512"},
+		{name: "signature", id: bob, fn: "verify_sig", params: []string{p.ID, "any", digest, "!"}, err: "invalid signature. expecting base64"},
+		{name: "other method", id: bob, fn: "verify_sig", params: []string{"did:web:example.com", "any", digest, sig1}, err: "invalid DID. expecting did:kiesnet:<kid>"},
+		{name: "not registered KID", id: bob, fn: "verify_sig", params: []string{unknownKID, "any", digest, sig1}, err: "failed to get the KID|not registered KID"},
+		{name: "injection KID", id: bob, fn: "verify_sig", params: []string{injectionKID, "any", digest, sig1}, err: "failed to get the KID|invalid KID. expecting 40 lowercase hex characters"},
+		{name: "not registered SN", id: bob, fn: "verify_sig", params: []string{p.ID, "ff", digest, sig1}, err: "failed to verify the signature|not registrated certificate"},
+	})
+}
+
+func TestVerifySignatureRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := base64.StdEncoding.EncodeToString(der)
+	h := sha512.Sum512([]byte("login nonce"))
+	pkcs1, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA512, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pss, err := rsa.SignPSS(rand.Reader, key, crypto.SHA512, h[:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, sig := range map[string][]byte{"PKCS#1 v1.5": pkcs1, "PSS": pss} {
+		if ok, err := VerifySignature(pub, h[:], sig); err != nil || !ok {
+			t.Errorf("%s: expected verified, but %v, %v", name, ok, err)
+		}
+	}
+	h[0]++
+	if ok, err := VerifySignature(pub, h[:], pkcs1); err != nil || ok {
+		t.Errorf("expected the other digest not verified, but %v, %v", ok, err)
+	}
+}
+
+func TestLockAndUnlock(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	alice2 := env.ca.reenroll(t, "alice", alice.key, nil)
+	p := env.register(alice, nil)
+	env.register(alice2, nil)
+
+	kid := &KID{}
+	env.mustInvoke(alice, nil, kid, "lock")
+	if kid.Lock != alice.SN() {
+		t.Fatalf("expected lock %s, but %s", alice.SN(), kid.Lock)
+	}
+	if stored := env.kid(p.ID); stored.Lock != alice.SN() {
+		t.Fatalf("lock is not stored: %+v", stored)
+	}
+
+	runTxTests(t, env, []txTest{
+		{name: "already locked", id: alice, fn: "lock", err: "already locked with the certificate"},
+		{name: "get by other", id: alice2, fn: "get", err: "failed to get the invoker's identity|not locked certificate"},
+		{name: "kid by other", id: alice2, fn: "kid", err: "failed to get the invoker's identity|not locked certificate"},
+		{name: "lock by other", id: alice2, fn: "lock", err: "failed to get the invoker's identity|not locked certificate"},
+		{name: "unlock by other", id: alice2, fn: "unlock", err: "failed to get the invoker's identity|not locked certificate"},
+		{name: "revoke by other", id: alice2, fn: "revoke", params: []string{alice.SN()}, err: "failed to get the invoker's identity|not locked certificate"},
+		{name: "get by locker", id: alice, fn: "get"},
+		{name: "unlock", id: alice, fn: "unlock"},
+		{name: "get by other after unlock", id: alice2, fn: "get"},
+		{name: "unlock not locked", id: alice2, fn: "unlock"},
+	})
+	if stored := env.kid(p.ID); stored.Lock != "" {
+		t.Fatalf("lock is not cleared: %+v", stored)
+	}
+
+	// old-style
+	bob := env.ca.enroll(t, "bob", nil)
+	pin := map[string]string{"kiesnet-id/pin": "1234"}
+	env.register(bob, pin)
+	runTxTests(t, env, []txTest{
+		{name: "lock old-style", id: bob, transient: pin, fn: "lock", err: "not supported KID"},
+		{name: "unlock old-style", id: bob, transient: pin, fn: "unlock", err: "not supported KID"},
+		{name: "lock old-style without PIN", id: bob, fn: "lock", err: "failed to get the invoker's identity|mismatched PIN"},
+	})
+}
+
+func TestPin(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	env.register(alice, map[string]string{"kiesnet-id/pin": "1234"})
+
+	runTxTests(t, env, []txTest{
+		{name: "without PIN", id: alice, transient: map[string]string{"kiesnet-id/new_pin": "5678"}, fn: "pin", err: "failed to get the invoker's identity|mismatched PIN"},
+		{name: "update", id: alice, transient: map[string]string{"kiesnet-id/pin": "1234", "kiesnet-id/new_pin": "5678"}, fn: "pin"},
+		{name: "old PIN", id: alice, transient: map[string]string{"kiesnet-id/pin": "1234"}, fn: "kid", params: []string{"true"}, err: "failed to get the invoker's identity|mismatched PIN"},
+		{name: "new PIN", id: alice, transient: map[string]string{"kiesnet-id/pin": "5678"}, fn: "kid", params: []string{"true"}},
+	})
+
+	bob := env.ca.enroll(t, "bob", nil)
+	env.register(bob, nil)
+	runTxTests(t, env, []txTest{
+		{name: "new-style", id: bob, transient: map[string]string{"kiesnet-id/new_pin": "5678"}, fn: "pin", err: "not supported KID"},
+	})
+}
+
+func TestPINAttempts(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	p := env.register(alice, map[string]string{"kiesnet-id/pin": "1234"})
+	key := keyStub(env).CreatePINAttemptKey(p.ID)
+	right := map[string]string{"kiesnet-id/pin": "1234"}
+	wrong := map[string]string{"kiesnet-id/pin": "0000"}
+
+	attempt := func() *PINAttempt {
+		t.Helper()
+		data := env.stub.private[collectionName][key]
+		if nil == data {
+			return nil
+		}
+		pa := &PINAttempt{}
+		if err := json.Unmarshal(data, pa); err != nil {
+			t.Fatal(err)
+		}
+		return pa
+	}
+	mismatch := func(failures int) {
+		t.Helper()
+		res := env.invoke(alice, wrong, "kid", "true")
+		if res.Status != PINFailureStatus || res.Message != "failed to get the invoker's identity|mismatched PIN" {
+			t.Fatalf("unexpected response: %d %s", res.Status, res.Message)
+		}
+		if pa := attempt(); nil == pa || pa.Failures != failures {
+			t.Fatalf("expected %d failures, but %+v", failures, pa)
+		}
+	}
+
+	for i := 1; i < PINMaxFailures; i++ {
+		mismatch(i)
+	}
+	if pa := attempt(); pa.CooldownEndTime != nil {
+		t.Fatalf("unexpected cooldown: %+v", pa)
+	}
+	env.mustInvoke(alice, right, nil, "kid", "true")
+	if pa := attempt(); pa != nil {
+		t.Fatalf("expected reset, but %+v", pa)
+	}
+
+	// not an attempt
+	res := env.invoke(alice, nil, "kid", "true")
+	if res.Status != shim.ERROR || attempt() != nil {
+		t.Fatalf("unexpected response: %d %s", res.Status, res.Message)
+	}
+
+	for i := 1; i <= PINMaxFailures; i++ {
+		mismatch(i)
+	}
+	pa := attempt()
+	if nil == pa.CooldownEndTime || pa.CooldownEndTime.Sub(time.Now()) < (PINCooldown-60)*time.Second {
+		t.Fatalf("unexpected cooldown: %+v", pa)
+	}
+	runTxTests(t, env, []txTest{
+		{name: "cooldown", id: alice, transient: right, fn: "kid", params: []string{"true"}, err: "failed to get the invoker's identity|too many mismatched PINs. try again later"},
+		{name: "cooldown", id: alice, transient: right, fn: "pin", err: "failed to get the invoker's identity|too many mismatched PINs. try again later"},
+		{name: "new-style", id: alice, fn: "get"}, // PIN isn't checked
+	})
+
+	// the cooldown ended
+	pa.CooldownEndTime = txtime.New(time.Now().Add(-time.Second))
+	env.stub.private[collectionName][key], _ = json.Marshal(pa)
+	mismatch(1)
+	env.mustInvoke(alice, right, nil, "kid", "true")
+	if pa := attempt(); pa != nil {
+		t.Fatalf("expected reset, but %+v", pa)
+	}
+}
+
+func TestPINEmpty(t *testing.T) {
+	for code, empty := range map[string]bool{"": true, "1234": false} {
+		pin, err := NewPIN(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pin.Empty != empty || pin.IsEmpty() != empty || (&KID{Pin: pin}).HasPIN() == empty {
+			t.Errorf("[%s]: unexpected PIN: %+v", code, pin)
+		}
+		// the marker, not the hash
+		pin.Hash = ""
+		if pin.IsEmpty() != empty {
+			t.Errorf("[%s]: expected checked by the marker", code)
+		}
+	}
+
+	// legacy hash of the empty code
+	legacy := &PIN{Salt: "salt"}
+	legacy.Hash = legacy.CreateHash("")
+	if !legacy.IsEmpty() || (&KID{Pin: legacy}).HasPIN() {
+		t.Errorf("expected the empty legacy PIN: %+v", legacy)
+	}
+	legacy.Rehash("")
+	if legacy.Algo != PINAlgo || !legacy.Empty {
+		t.Errorf("expected the marker after the rehash: %+v", legacy)
+	}
+	if (&KID{}).HasPIN() {
+		t.Error("expected no PIN")
+	}
+}
+
+func TestPINRehash(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	p := env.register(alice, map[string]string{"kiesnet-id/pin": "1234"})
+
+	// storedKID finds the private KID
+	storedKID := func() (string, *KID) {
+		t.Helper()
+		for key, data := range env.stub.private[collectionName] {
+			kid := &KID{}
+			if err := json.Unmarshal(data, kid); err == nil && kid.DOCTYPEID == p.ID {
+				return key, kid
+			}
+		}
+		t.Fatal("no private KID")
+		return "", nil
+	}
+
+	key, kid := storedKID()
+	if kid.Pin.Algo != PINAlgo || !kid.Pin.Match("1234") || kid.Pin.Match("0000") {
+		t.Fatalf("unexpected PIN: %+v", kid.Pin)
+	}
+
+	// legacy hash
+	legacy := &PIN{Salt: kid.Pin.Salt, UpdatedTime: kid.Pin.UpdatedTime}
+	legacy.Hash = legacy.CreateHash("1234")
+	if legacy.Hash == kid.Pin.Hash || !legacy.Match("1234") || !legacy.NeedsRehash() {
+		t.Fatalf("unexpected legacy PIN: %+v", legacy)
+	}
+	kid.Pin = legacy
+	env.stub.private[collectionName][key], _ = json.Marshal(kid)
+
+	runTxTests(t, env, []txTest{
+		{name: "mismatched", id: alice, transient: map[string]string{"kiesnet-id/pin": "0000"}, fn: "kid", params: []string{"true"}, err: "failed to get the invoker's identity|mismatched PIN"},
+	})
+	if _, kid = storedKID(); kid.Pin.Algo != PINAlgoSHAKE256 {
+		t.Fatalf("unexpected rehash: %+v", kid.Pin)
+	}
+	env.mustInvoke(alice, map[string]string{"kiesnet-id/pin": "1234"}, nil, "kid", "true")
+	if _, kid = storedKID(); kid.Pin.Algo != PINAlgo || kid.Pin.Salt != legacy.Salt || !kid.Pin.Match("1234") || kid.Pin.UpdatedTime.Cmp(legacy.UpdatedTime) != 0 {
+		t.Fatalf("unexpected rehash: %+v", kid.Pin)
+	}
+
+	unknown := &PIN{Algo: "unknown", Salt: legacy.Salt}
+	if unknown.Match("1234") || unknown.Match("") {
+		t.Error("unknown algorithm must not match")
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	alice2 := env.ca.reenroll(t, "alice", alice.key, nil)
+	bob := env.ca.enroll(t, "bob", nil)
+	p := env.register(alice, nil)
+	env.register(alice2, nil)
+	env.register(bob, nil)
+
+	cert := &Certificate{}
+	env.mustInvoke(alice, nil, cert, "revoke", alice2.SN())
+	if cert.DOCTYPEID != p.ID || cert.SN != alice2.SN() || cert.RevokedTime == nil {
+		t.Fatalf("unexpected revoked certificate: %+v", cert)
+	}
+
+	runTxTests(t, env, []txTest{
+		{name: "no params", id: alice, fn: "revoke", err: "incorrect number of parameters. expecting 1"},
+		{name: "too many params", id: alice, fn: "revoke", params: []string{alice2.SN(), alice.SN()}, err: "incorrect number of parameters. expecting 1"},
+		{name: "already revoked", id: alice, fn: "revoke", params: []string{alice2.SN()}, err: "already revoked certificate"},
+		{name: "other's certificate", id: alice, fn: "revoke", params: []string{bob.SN()}, err: "failed to get the certificate to be revoked|not registrated certificate"},
+		{name: "unknown certificate", id: alice, fn: "revoke", params: []string{"ffff"}, err: "failed to get the certificate to be revoked|not registrated certificate"},
+		{name: "get by revoked", id: alice2, fn: "get", err: "failed to get the invoker's identity|revoked certificate"},
+		{name: "revoke by revoked", id: alice2, fn: "revoke", params: []string{alice.SN()}, err: "failed to get the invoker's identity|revoked certificate"},
+		{name: "not registered", id: env.ca.enroll(t, "charlie", nil), fn: "revoke", params: []string{alice.SN()}, err: "failed to get the invoker's identity|not registrated certificate"},
+		{name: "self-revoke of the last", id: alice, fn: "revoke", params: []string{alice.SN()}, err: "failed to revoke the certificate|revoking the last active certificate requires the force"},
+		{name: "self-revoke with force", id: alice, transient: force, fn: "revoke", params: []string{alice.SN()}},
+		{name: "get after self-revoke", id: alice, fn: "get", err: "failed to get the invoker's identity|revoked certificate"},
+	})
+}
+
+func TestResponseError(t *testing.T) {
+	tests := []struct {
+		err error
+		msg string
+	}{
+		{NotRegisteredCertificateError{}, "prefix|not registrated certificate"},
+		{RevokedCertificateError{}, "prefix|revoked certificate"},
+		{ExpiredCertificateError{}, "prefix|expired certificate"},
+		{MismatchedPINError{}, "prefix|mismatched PIN"},
+		{MigrationRequiredError{}, "prefix|old-style KID is no longer supported. migration required"},
+		{NotAdminError{}, "prefix|not an administrator"},
+		{PINCooldownError{}, "prefix|too many mismatched PINs. try again later"},
+		{NotLockedCertificateError{}, "prefix|not locked certificate"},
+		{KIDCollisionError{}, "prefix|no available KID"},
+		{InvalidLinkCodeError{}, "prefix|invalid link code"},
+		{ExpiredLinkCodeError{}, "prefix|expired link code"},
+		{NotRegisteredKIDError{}, "prefix|not registered KID"},
+		{NoGuardianError{}, "prefix|no guardian"},
+		{NoRecoveryError{}, "prefix|no recovery request"},
+		{NotApprovedReactivationError{}, "prefix|reactivation must be approved by an active certificate"},
+		{SelfRevocationError{Forcible: true}, "prefix|revoking the invoker's certificate requires the force"},
+		{SelfRevocationError{}, "prefix|revoking the invoker's certificate is not allowed"},
+		{LockingCertificateRevocationError{Forcible: true}, "prefix|revoking the locking certificate requires the force"},
+		{LockingCertificateRevocationError{}, "prefix|revoking the locking certificate is not allowed"},
+		{LastCertificateRevocationError{Forcible: true}, "prefix|revoking the last active certificate requires the force"},
+		{LastCertificateRevocationError{}, "prefix|revoking the last active certificate is not allowed"},
+		{NotSupportedKIDError{}, "prefix|not supported KID"},
+		{AlreadyLockedError{}, "prefix|already locked with the certificate"},
+		{AlreadyRegisteredKIDError{}, "prefix|already registered KID"},
+		{InvalidParameterError{Reason: "invalid threshold"}, "prefix|invalid threshold"},
+		{UnknownFunctionError{Function: "fn"}, "prefix|unknown function: [fn]"},
+		{nil, "prefix"},
+		{errors.New("internal error"), "prefix"}, // hidden
+	}
+	for _, tt := range tests {
+		if res := responseError(tt.err, "prefix"); res.Status != shim.ERROR || res.Message != tt.msg {
+			t.Errorf("%T: expected [%s], but [%s]", tt.err, tt.msg, res.Message)
+		}
+	}
+	if res := responseError(RevokedCertificateError{}, ""); res.Message != "revoked certificate" {
+		t.Errorf("expected [revoked certificate], but [%s]", res.Message)
+	}
+	if res := responseError(MismatchedPINError{Failures: 1}, "prefix"); res.Status != PINFailureStatus || res.Message != "prefix|mismatched PIN" {
+		t.Errorf("expected the recorded mismatch, but %d [%s]", res.Status, res.Message)
+	}
+}
+
+func TestErrorPayload(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	alice2 := env.ca.reenroll(t, "alice", alice.key, nil)
+	p := env.register(alice, nil)
+	env.register(alice2, nil)
+	env.mustInvoke(alice, nil, nil, "lock")
+
+	jsonFormat := map[string]string{"kiesnet-id/error_format": ErrorFormatJSON}
+	tests := []struct {
+		name   string
+		id     *testIdentity
+		fn     string
+		params []string
+		ep     ErrorPayload
+	}{
+		{"responsible", alice2, "get", nil, ErrorPayload{CodeNotLockedCertificate, "failed to get the invoker's identity|not locked certificate", p.ID, alice2.SN()}},
+		{"typed", alice, "lock", nil, ErrorPayload{CodeAlreadyLocked, "already locked with the certificate", p.ID, alice.SN()}},
+		{"parameter", alice, "revoke", nil, ErrorPayload{CodeInvalidParameter, "incorrect number of parameters. expecting 1", "", ""}},
+		{"unknown function", alice, "unknown", nil, ErrorPayload{CodeUnknownFunction, "unknown function: [unknown]", "", ""}},
+		{"invalid options", alice, "list", []string{"", "{"}, ErrorPayload{CodeInvalidParameter, "", "", ""}},
+	}
+	for _, tt := range tests {
+		// default: the string form
+		res := env.invoke(tt.id, nil, tt.fn, tt.params...)
+		if res.Status != shim.ERROR || res.Payload != nil {
+			t.Errorf("%s: expected the error without payload, but %d %s", tt.name, res.Status, res.Payload)
+			continue
+		}
+		msg := res.Message
+		if tt.ep.Message != "" && msg != tt.ep.Message {
+			t.Errorf("%s: expected [%s], but [%s]", tt.name, tt.ep.Message, msg)
+		}
+
+		res = env.invoke(tt.id, jsonFormat, tt.fn, tt.params...)
+		ep := ErrorPayload{}
+		if err := json.Unmarshal([]byte(res.Message), &ep); err != nil {
+			t.Errorf("%s: expected the JSON error, but [%s]", tt.name, res.Message)
+			continue
+		}
+		tt.ep.Message = msg
+		if ep != tt.ep {
+			t.Errorf("%s: expected %+v, but %+v", tt.name, tt.ep, ep)
+		}
+	}
+
+	// the recorded PIN mismatch keeps the status
+	bob := env.ca.enroll(t, "bob", nil)
+	bp := env.register(bob, map[string]string{"kiesnet-id/pin": "1234"})
+	res := env.invoke(bob, map[string]string{"kiesnet-id/pin": "0000", "kiesnet-id/error_format": ErrorFormatJSON}, "kid", "true")
+	ep := ErrorPayload{}
+	if err := json.Unmarshal([]byte(res.Message), &ep); err != nil || res.Status != PINFailureStatus || ep.Code != CodeMismatchedPIN || ep.KID != bp.ID {
+		t.Errorf("expected the recorded mismatch, but %d [%s]", res.Status, res.Message)
+	}
+
+	// the hidden internal error
+	res = responseError(errors.New("internal error"), "prefix")
+	if err := json.Unmarshal(res.Payload, &ep); err != nil || ep.Code != CodeInternal || ep.Message != "prefix" {
+		t.Errorf("expected the internal error, but %s", res.Payload)
+	}
+}
+
+func TestClient(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	alice2 := env.ca.reenroll(t, "alice", alice.key, nil)
+	call := func(id *testIdentity, req *client.Request, v interface{}) error {
+		return client.Decode(env.stub.invoke(id.creator, req.Transient, req.Fn, req.Params...), v)
+	}
+	must := func(id *testIdentity, req *client.Request, v interface{}) {
+		t.Helper()
+		if err := call(id, req, v); err != nil {
+			t.Fatalf("%s: unexpected error: %s", req.Fn, err)
+		}
+	}
+
+	identity := &client.Identity{}
+	must(alice, client.Register(), identity)
+	if identity.ID == "" || identity.SN != alice.SN() {
+		t.Fatalf("unexpected identity: %+v", identity)
+	}
+	must(alice2, client.Register(), nil)
+	kid := &client.Identity{}
+	must(alice2, client.GetKID(false), kid)
+	if kid.ID != identity.ID || kid.SN != "" {
+		t.Fatalf("unexpected KID: %+v", kid)
+	}
+
+	locked := &client.KID{}
+	must(alice, client.Lock(""), locked)
+	if locked.ID != identity.ID || locked.Lock != alice.SN() {
+		t.Fatalf("unexpected KID: %+v", locked)
+	}
+	err := call(alice2, client.Get(), nil)
+	if !client.IsCode(err, client.CodeNotLockedCertificate) {
+		t.Fatalf("expected the not locked certificate, but %v", err)
+	}
+	err = call(alice2, client.Get().WithJSONError(), nil)
+	if e, ok := err.(*client.Error); !ok || e.Code != client.CodeNotLockedCertificate || e.KID != identity.ID || e.SN != alice2.SN() || e.Cause() != "not locked certificate" {
+		t.Fatalf("expected the JSON error, but %+v", err)
+	}
+	unlocked := &client.KID{}
+	must(alice, client.Unlock(), unlocked)
+	if unlocked.ID != identity.ID || unlocked.Lock != "" {
+		t.Fatalf("unexpected KID: %+v", unlocked)
+	}
+
+	revoked := &client.Certificate{}
+	must(alice, client.Revoke(alice2.SN()), revoked)
+	if revoked.SN != alice2.SN() || !revoked.Revoked() {
+		t.Fatalf("unexpected certificate: %+v", revoked)
+	}
+	l := &client.CertificateList{}
+	must(alice, client.List("", &client.ListOptions{Revoked: client.RevokedInclude, PageSize: 1}), l)
+	if len(l.Records) != 1 || l.Meta.Bookmark == "" {
+		t.Fatalf("unexpected list: %+v", l)
+	}
+	next := &client.CertificateList{}
+	must(alice, client.List(l.Meta.Bookmark, &client.ListOptions{Revoked: client.RevokedInclude, PageSize: 1}), next)
+	if len(next.Records) != 1 || next.Records[0].SN == l.Records[0].SN || next.Meta.Bookmark != "" {
+		t.Fatalf("unexpected list: %+v", next)
+	}
+	h := &client.HistoryList{}
+	must(alice, client.GetHistory(alice2.SN(), ""), h)
+	if len(h.Records) != 2 {
+		t.Fatalf("expected 2 histories, but %d", len(h.Records))
+	}
+	if err = call(alice, client.Revoke(alice2.SN()), nil); !client.IsCode(err, client.CodeAlreadyRevokedCertificate) {
+		t.Fatalf("expected the already revoked certificate, but %v", err)
+	}
+
+	// old-style
+	bob := env.ca.enroll(t, "bob", nil)
+	must(bob, client.Register().WithPIN("1234"), nil)
+	err = call(bob, client.PIN().WithPIN("0000").WithNewPIN("5678"), nil)
+	if e, ok := err.(*client.Error); !ok || e.Code != client.CodeMismatchedPIN || e.Status != client.PINFailureStatus {
+		t.Fatalf("expected the recorded mismatch, but %+v", err)
+	}
+
+	// the string forms map to the codes
+	for _, err := range []ResponsibleError{
+		NotRegisteredCertificateError{}, RevokedCertificateError{}, ExpiredCertificateError{}, NotYetValidCertificateError{},
+		NotRegisteredKIDError{}, InvalidLinkCodeError{},
+		ExpiredLinkCodeError{}, KIDCollisionError{}, MismatchedPINError{}, NoGuardianError{}, NoRecoveryError{},
+		PINCooldownError{}, MigrationRequiredError{}, NotAdminError{}, NotApprovedReactivationError{},
+		SelfRevocationError{}, LockingCertificateRevocationError{Forcible: true}, LastCertificateRevocationError{},
+		NotLockedCertificateError{}, InvalidParameterError{Reason: "invalid threshold"}, UnknownFunctionError{},
+		NotSupportedKIDError{}, AlreadyRegisteredKIDError{}, AlreadyRegisteredCertificateError{},
+		AlreadyRevokedCertificateError{}, NotRevokedCertificateError{}, AlreadyLockedError{}, NotGuardianError{},
+		AlreadyRequestedRecoveryError{}, ExpiredRecoveryError{}, AlreadyApprovedRecoveryError{},
+		NotApprovedRecoveryError{}, NotRecoveringCertificateError{}, RecoveryWaitingPeriodError{},
+		NotRegisteredAliasError{}, AlreadyRegisteredAliasError{}, AlreadyAliasedKIDError{}, NotAliasOwnerError{},
+		NotClaimIssuerError{}, NoClaimError{}, AlreadyRevokedClaimError{}, RevokedByCAError{},
+	} {
+		res := responseError(err.(error), "prefix")
+		if e := client.ParseError(res.Message); e.Code != err.Code() {
+			t.Errorf("%T: expected %s, but %s", err, err.Code(), e.Code)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	alice2 := env.ca.reenroll(t, "alice", alice.key, nil)
+	alice3 := env.ca.reenroll(t, "alice", alice.key, nil)
+	p := env.register(alice, nil)
+	env.register(alice2, nil)
+	env.register(alice3, nil)
+
+	verify := func(id *testIdentity) *verifier.Result {
+		t.Helper()
+		env.stub.creator = id.creator
+		r, err := verifier.Verify(env.stub)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return r
+	}
+
+	if r := verify(alice); r.KID != p.ID || r.SN != alice.SN() || !r.Active() || r.OldStyle || r.CreatedTime == nil || r.KIDCreatedTime == nil {
+		t.Errorf("unexpected verification: %+v", r)
+	}
+
+	env.mustInvoke(alice, nil, nil, "revoke", alice3.SN())
+	env.mustInvoke(alice, nil, nil, "lock")
+	if r := verify(alice); !r.Active() {
+		t.Errorf("the locker must be active: %+v", r)
+	}
+	if r := verify(alice2); r.KID != p.ID || !r.Locked || r.Revoked || r.Active() {
+		t.Errorf("expected locked, but %+v", r)
+	}
+	if r := verify(alice3); !r.Revoked || r.RevokedTime == nil || r.Active() {
+		t.Errorf("expected revoked, but %+v", r)
+	}
+	if _, err := verifier.GetActiveKID(env.stub); err == nil || err.Error() != "revoked certificate" {
+		t.Errorf("expected revoked certificate error, but %v", err)
+	}
+
+	bob := env.ca.enroll(t, "bob", nil)
+	env.register(bob, map[string]string{"kiesnet-id/pin": "1234"})
+	if r := verify(bob); !r.OldStyle || !r.Active() {
+		t.Errorf("expected old-style, but %+v", r)
+	}
+
+	runTxTests(t, env, []txTest{
+		{name: "not registered", id: env.ca.enroll(t, "charlie", nil), fn: "verify", err: "failed to get the invoker's KID|not registrated certificate"},
+	})
+}
+
+type historyPayload struct {
+	Meta struct {
+		FetchedRecordsCount int32  `json:"fetched_records_count"`
+		Bookmark            string `json:"bookmark"`
+	} `json:"meta"`
+	Records []*History `json:"records"`
+}
+
+func TestHistory(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	alice2 := env.ca.reenroll(t, "alice", alice.key, nil)
+	p := env.register(alice, nil)
+	env.register(alice2, nil)
+
+	// KID: created + (locked + unlocked) * 11
+	for i := 0; i < 11; i++ {
+		env.mustInvoke(alice, nil, nil, "lock")
+		env.mustInvoke(alice, nil, nil, "unlock")
+	}
+	page1 := &historyPayload{}
+	env.mustInvoke(alice, nil, page1, "history")
+	if len(page1.Records) != HistoryFetchSize || page1.Meta.Bookmark == "" {
+		t.Fatalf("expected %d records with bookmark, but %d, [%s]", HistoryFetchSize, len(page1.Records), page1.Meta.Bookmark)
+	}
+	page2 := &historyPayload{}
+	env.mustInvoke(alice, nil, page2, "history", "", page1.Meta.Bookmark)
+	if len(page2.Records) != 23-HistoryFetchSize || page2.Meta.Bookmark != "" {
+		t.Fatalf("expected %d records without bookmark, but %d, [%s]", 23-HistoryFetchSize, len(page2.Records), page2.Meta.Bookmark)
+	}
+	records := append(page1.Records, page2.Records...)
+	for i, h := range records {
+		kid := &KID{}
+		if h.TxID == "" || h.Timestamp == nil || h.IsDelete {
+			t.Fatalf("unexpected history: %+v", h)
+		}
+		if err := json.Unmarshal(h.Value, kid); err != nil || kid.DOCTYPEID != p.ID {
+			t.Fatalf("unexpected KID value: %s", h.Value)
+		}
+		if locked := kid.Lock != ""; locked != (i%2 == 1) {
+			t.Errorf("history %d: unexpected lock [%s]", i, kid.Lock)
+		}
+	}
+
+	// certificate
+	env.mustInvoke(alice, nil, nil, "revoke", alice2.SN())
+	ch := &historyPayload{}
+	env.mustInvoke(alice, nil, ch, "history", alice2.SN())
+	if len(ch.Records) != 2 {
+		t.Fatalf("expected 2 records, but %d", len(ch.Records))
+	}
+	for i, h := range ch.Records {
+		cert := &Certificate{}
+		if err := json.Unmarshal(h.Value, cert); err != nil || cert.SN != alice2.SN() {
+			t.Fatalf("unexpected certificate value: %s", h.Value)
+		}
+		if revoked := cert.RevokedTime != nil; revoked != (i == 1) {
+			t.Errorf("history %d: unexpected revoked time %v", i, cert.RevokedTime)
+		}
+	}
+
+	// delete marker
+	key := keyStub(env).CreateCertificateKey(p.ID, alice2.SN())
+	env.stub.history[key] = append(env.stub.history[key], &queryresult.KeyModification{TxId: "deleted", IsDelete: true})
+	env.mustInvoke(alice, nil, ch, "history", alice2.SN())
+	if h := ch.Records[2]; !h.IsDelete || h.Value != nil {
+		t.Errorf("expected delete marker, but %+v", h)
+	}
+
+	bob := env.ca.enroll(t, "bob", nil)
+	env.register(bob, nil)
+	runTxTests(t, env, []txTest{
+		{name: "other's certificate", id: alice, fn: "history", params: []string{bob.SN()}, err: "failed to get the certificate|not registrated certificate"},
+		{name: "not registered", id: env.ca.enroll(t, "charlie", nil), fn: "history", err: "failed to get the invoker's identity|not registrated certificate"},
+	})
+}
+
+// keyStub returns an IdentityStub for key helpers
+func keyStub(env *testEnv) *IdentityStub {
+	return &IdentityStub{stub: env.stub}
+}
+
+func TestEvents(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	alice2 := env.ca.reenroll(t, "alice", alice.key, nil)
+	bob := env.ca.enroll(t, "bob", nil)
+
+	// expectEvents checks the event of the last transaction
+	expectEvents := func(kid string, expected ...[2]string) {
+		t.Helper()
+		if env.stub.event == nil || env.stub.event.EventName != event.Name {
+			t.Fatalf("expected %v, but no event: %+v", expected, env.stub.event)
+		}
+		p, err := event.Decode(env.stub.event.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Events) != len(expected) {
+			t.Fatalf("expected %v, but %d events", expected, len(p.Events))
+		}
+		for i, e := range p.Events {
+			if e.Type != expected[i][0] || e.KID != kid || e.SN != expected[i][1] || e.TxTime == nil {
+				t.Errorf("expected %v, but %+v", expected[i], e)
+			}
+		}
+	}
+
+	p := env.register(alice, nil)
+	expectEvents(p.ID, [2]string{event.KIDRegistered, alice.SN()}, [2]string{event.CertRegistered, alice.SN()})
+	env.register(alice2, nil)
+	expectEvents(p.ID, [2]string{event.CertRegistered, alice2.SN()})
+	env.mustInvoke(alice, nil, nil, "lock")
+	expectEvents(p.ID, [2]string{event.KIDLocked, alice.SN()})
+	env.mustInvoke(alice, nil, nil, "unlock")
+	expectEvents(p.ID, [2]string{event.KIDUnlocked, alice.SN()})
+	env.mustInvoke(alice, nil, nil, "unlock") // not locked, nothing changed
+	if env.stub.event != nil {
+		t.Errorf("unexpected event: %+v", env.stub.event)
+	}
+	env.mustInvoke(alice, nil, nil, "revoke", alice2.SN())
+	expectEvents(p.ID, [2]string{event.CertRevoked, alice2.SN()})
+
+	// old-style
+	pb := env.register(bob, map[string]string{"kiesnet-id/pin": "1234"})
+	env.mustInvoke(bob, map[string]string{"kiesnet-id/pin": "1234", "kiesnet-id/new_pin": ""}, nil, "pin")
+	expectEvents(pb.ID, [2]string{event.PINUpdated, bob.SN()})
+	env.mustInvoke(bob, nil, nil, "lock") // migrate and lock
+	expectEvents(pb.ID, [2]string{event.KIDMigrated, bob.SN()}, [2]string{event.KIDLocked, bob.SN()})
+
+	// failed transaction
+	runTxTests(t, env, []txTest{
+		{name: "already registered", id: alice, fn: "register", err: "already registered certificate"},
+	})
+	if env.stub.event != nil {
+		t.Errorf("unexpected event: %+v", env.stub.event)
+	}
+}
+
+func TestReactivate(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	alice2 := env.ca.reenroll(t, "alice", alice.key, nil)
+	p := env.register(alice, nil)
+	env.register(alice2, nil)
+	env.mustInvoke(alice, nil, nil, "revoke", alice2.SN())
+
+	runTxTests(t, env, []txTest{
+		{name: "not approved", id: alice2, fn: "register", err: "failed to reactivate the certificate|reactivation must be approved by an active certificate"},
+		{name: "no params", id: alice, fn: "reactivate", err: "incorrect number of parameters. expecting 1"},
+		{name: "not revoked", id: alice, fn: "reactivate", params: []string{alice.SN()}, err: "not revoked certificate"},
+		{name: "unknown", id: alice, fn: "reactivate", params: []string{"ffff"}, err: "failed to get the certificate to be reactivated|not registrated certificate"},
+		{name: "by revoked", id: alice2, fn: "reactivate", params: []string{alice2.SN()}, err: "failed to get the invoker's identity|revoked certificate"},
+	})
+
+	// approved by an active certificate
+	cert := &Certificate{}
+	env.mustInvoke(alice, nil, cert, "reactivate", alice2.SN())
+	if cert.RevokedTime != nil || cert.ReactivatedTime == nil || cert.ReactivatedCount != 1 {
+		t.Fatalf("unexpected reactivated certificate: %+v", cert)
+	}
+	env.mustInvoke(alice2, nil, nil, "get")
+
+	// the revocation remains in the history
+	h := &historyPayload{}
+	env.mustInvoke(alice, nil, h, "history", alice2.SN())
+	if len(h.Records) != 3 {
+		t.Fatalf("expected 3 records, but %d", len(h.Records))
+	}
+	revoked := &Certificate{}
+	if err := json.Unmarshal(h.Records[1].Value, revoked); err != nil || revoked.RevokedTime == nil {
+		t.Errorf("expected revoked certificate, but %s", h.Records[1].Value)
+	}
+
+	// re-register, the KID has no other active certificate
+	env.mustInvoke(alice, nil, nil, "revoke", alice2.SN())
+	env.mustInvoke(alice, force, nil, "revoke", alice.SN()) // self-revoke
+	got := env.register(alice, nil)
+	if got.ID != p.ID || got.SN != alice.SN() {
+		t.Errorf("unexpected identity: %+v", got)
+	}
+	cert = &Certificate{}
+	if err := json.Unmarshal(env.stub.state[keyStub(env).CreateCertificateKey(p.ID, alice.SN())], cert); err != nil {
+		t.Fatal(err)
+	}
+	if cert.RevokedTime != nil || cert.ReactivatedCount != 1 {
+		t.Errorf("unexpected reactivated certificate: %+v", cert)
+	}
+	runTxTests(t, env, []txTest{
+		{name: "already registered", id: alice, fn: "register", err: "already registered certificate"},
+		{name: "other is still revoked", id: alice2, fn: "get", err: "failed to get the invoker's identity|revoked certificate"},
+	})
+
+	// old-style requires the PIN
+	bob := env.ca.enroll(t, "bob", nil)
+	pin := map[string]string{"kiesnet-id/pin": "1234"}
+	env.register(bob, pin)
+	env.mustInvoke(bob, map[string]string{"kiesnet-id/pin": "1234", "kiesnet-id/force": "true"}, nil, "revoke", bob.SN())
+	runTxTests(t, env, []txTest{
+		{name: "old-style without PIN", id: bob, fn: "register", err: "failed to get the invoker's KID|mismatched PIN"},
+		{name: "old-style", id: bob, transient: pin, fn: "register"},
+	})
+}
+
+func TestRevocationPolicy(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	alice2 := env.ca.reenroll(t, "alice", alice.key, nil)
+	alice3 := env.ca.reenroll(t, "alice", alice.key, nil)
+	env.register(alice, nil)
+	env.register(alice2, nil)
+	env.register(alice3, nil)
+
+	// default policy: self allow, lock and last force
+	env.mustInvoke(alice, nil, nil, "lock")
+	runTxTests(t, env, []txTest{
+		{name: "locking", id: alice, fn: "revoke", params: []string{alice.SN()}, err: "failed to revoke the certificate|revoking the locking certificate requires the force"},
+		{name: "other", id: alice, fn: "revoke", params: []string{alice3.SN()}},
+		{name: "unlock", id: alice, fn: "unlock"},
+	})
+
+	// instantiate or upgrade with the policy
+	if res := env.stub.initialize(`{"self":"force","lock":"force"}`); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	if res := env.stub.initialize(`{"self":"never"}`); res.Status == shim.OK {
+		t.Fatal("expected invalid rule error")
+	}
+	if res := env.stub.initialize(); res.Status != shim.OK { // keeps the policy
+		t.Fatal(res.Message)
+	}
+	runTxTests(t, env, []txTest{
+		{name: "self", id: alice, fn: "revoke", params: []string{alice.SN()}, err: "failed to revoke the certificate|revoking the invoker's certificate requires the force"},
+		{name: "force is not true", id: alice, transient: map[string]string{"kiesnet-id/force": "yes"}, fn: "revoke", params: []string{alice.SN()}, err: "failed to revoke the certificate|revoking the invoker's certificate requires the force"},
+		{name: "forced self", id: alice, transient: force, fn: "revoke", params: []string{alice.SN()}},
+	})
+
+	if res := env.stub.initialize(`{"last":"deny"}`); res.Status != shim.OK {
+		t.Fatal(res.Message)
+	}
+	runTxTests(t, env, []txTest{
+		{name: "self is allowed again, last denied", id: alice2, fn: "revoke", params: []string{alice2.SN()}, err: "failed to revoke the certificate|revoking the last active certificate is not allowed"},
+		{name: "last denied", id: alice2, transient: force, fn: "revoke", params: []string{alice2.SN()}, err: "failed to revoke the certificate|revoking the last active certificate is not allowed"},
+	})
+}
+
+func TestQueries(t *testing.T) {
+	for _, query := range []string{CreateQueryKIDByID(injectionKID), CreateQueryOriginKIDByID(injectionKID), CreateQueryPrivateKIDs(injectionKID, 10)} {
+		q := &struct {
+			Selector map[string]interface{} `json:"selector"`
+		}{}
+		if err := json.Unmarshal([]byte(query), q); err != nil {
+			t.Fatalf("%s: %s", query, err)
+		}
+		id := q.Selector["@kid"]
+		if m, ok := id.(map[string]interface{}); ok {
+			id = m["$gt"]
+		}
+		if id != injectionKID {
+			t.Errorf("expected the escaped KID, but %s", query)
+		}
+	}
+}
+
+func TestKIDCollision(t *testing.T) {
+	env := newTestEnv(t)
+
+	// uuid returns the client's uuid as the chaincode does
+	uuid := func(id *testIdentity) string {
+		t.Helper()
+		env.stub.creator = id.creator
+		ib, err := NewIdentityStub(env.stub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ib.uuid
+	}
+	// candidate returns the i-th KID candidate of the next transaction
+	candidate := func(id *testIdentity, i int) string {
+		nonce := env.stub.nextTxID()
+		if i > 0 {
+			nonce = fmt.Sprintf("%s#%d", nonce, i)
+		}
+		return NewKID(uuid(id), nonce).DOCTYPEID
+	}
+
+	// no collision
+	alice := env.ca.enroll(t, "alice", nil)
+	expected := candidate(alice, 0)
+	if p := env.register(alice, nil); p.ID != expected {
+		t.Fatalf("expected %s, but %s", expected, p.ID)
+	}
+	if string(env.stub.state[keyStub(env).CreateKIDIDKey(expected)]) != uuid(alice) {
+		t.Fatal("reverse-lookup key is not stored")
+	}
+
+	// collision with reverse-lookup key
+	bob := env.ca.enroll(t, "bob", nil)
+	env.stub.state[keyStub(env).CreateKIDIDKey(candidate(bob, 0))] = []byte("other")
+	expected = candidate(bob, 1)
+	if p := env.register(bob, nil); p.ID != expected {
+		t.Fatalf("expected %s, but %s", expected, p.ID)
+	}
+
+	// the KIDs created before the reverse-lookup key get it by the backfill
+	// (old-style KIDs get the reverse-lookup key at the migration)
+	admin := env.ca.enroll(t, "admin", map[string]string{"kiesnet-id.admin": "true"})
+	env.stub.state["KID_public"] = []byte(`{"@kid":"oldkid"}`)
+	env.stub.state["KID_linked"] = []byte(`{"@kid":"oldkid","link":"KID_public"}`)
+	if exists, _ := keyStub(env).ExistsKID("oldkid"); exists {
+		t.Fatal("expected no reverse-lookup key")
+	}
+	indexed, pages := 0, 0
+	for bookmark := ""; 0 == pages || bookmark != ""; pages++ {
+		rr := &ReindexResult{}
+		env.mustInvoke(admin, nil, rr, "admin_reindex_kids", bookmark, "1")
+		indexed += rr.Indexed
+		bookmark = rr.Bookmark
+	}
+	if indexed != 1 || pages != 4 { // alice, bob, public (linked is skipped)
+		t.Fatalf("unexpected backfill: %d indexed in %d pages", indexed, pages)
+	}
+	if string(env.stub.state[keyStub(env).CreateKIDIDKey("oldkid")]) != "public" {
+		t.Fatal("reverse-lookup key is not backfilled")
+	}
+
+	// no available KID
+	dave := env.ca.enroll(t, "dave", nil)
+	for i := 0; i <= MaxKIDRetries; i++ {
+		env.stub.state[keyStub(env).CreateKIDIDKey(candidate(dave, i))] = []byte("other")
+	}
+	runTxTests(t, env, []txTest{
+		{name: "no available KID", id: dave, fn: "register", err: "failed to create new KID|no available KID"},
+	})
+}
+
+func TestLink(t *testing.T) {
+	env := newTestEnv(t)
+	phone := env.ca.enroll(t, "alice-phone", pubkeyAttrs)
+	laptop := env.ca.enroll(t, "alice-laptop", pubkeyAttrs)
+	tablet := env.ca.enroll(t, "alice-tablet", pubkeyAttrs)
+	p := env.register(phone, nil)
+
+	code := map[string]string{"kiesnet-id/link_code": "0123456789ab"}
+	link := &struct {
+		KID         string       `json:"kid"`
+		SN          string       `json:"sn"`
+		Fingerprint string       `json:"fingerprint"`
+		ExpiryTime  *txtime.Time `json:"expiry_time"`
+	}{}
+	env.mustInvoke(phone, code, link, "link_begin", laptop.Fingerprint())
+	if link.KID != p.ID || link.SN != phone.SN() || link.Fingerprint != laptop.Fingerprint() || link.ExpiryTime == nil {
+		t.Fatalf("unexpected link: %+v", link)
+	}
+	for _, data := range env.stub.state {
+		if strings.Contains(string(data), code["kiesnet-id/link_code"]) {
+			t.Fatal("the link code must be hashed")
+		}
+	}
+
+	// the new device's first register, the code doesn't link others
+	runTxTests(t, env, []txTest{
+		{name: "other device", id: tablet, transient: code, fn: "register", err: "failed to link the KID|invalid link code"},
+	})
+	if pl := env.register(laptop, code); pl.ID != p.ID || pl.SN != laptop.SN() {
+		t.Fatalf("expected linked KID %s, but %+v", p.ID, pl)
+	}
+	l := &listPayload{}
+	env.mustInvoke(laptop, nil, l, "list")
+	if len(l.Records) != 2 {
+		t.Fatalf("expected 2 certificates, but %d", len(l.Records))
+	}
+
+	runTxTests(t, env, []txTest{
+		{name: "one-time", id: tablet, transient: code, fn: "register", err: "failed to link the KID|invalid link code"},
+		{name: "already registered", id: laptop, transient: code, fn: "register", err: "already registered KID"},
+		{name: "short code", id: phone, transient: map[string]string{"kiesnet-id/link_code": "0123"}, fn: "link_begin", params: []string{tablet.Fingerprint()}, err: "link code must be at least 12 characters"},
+		{name: "invalid TTL", id: phone, transient: code, fn: "link_begin", params: []string{tablet.Fingerprint(), "3601"}, err: "invalid TTL. expecting 1 ~ 3600"},
+		{name: "no fingerprint", id: phone, transient: code, fn: "link_begin", err: "incorrect number of parameters. expecting 1+"},
+		{name: "invalid fingerprint", id: phone, transient: code, fn: "link_begin", params: []string{tablet.SN()}, err: "invalid fingerprint. expecting hex SHA-256 of the certificate"},
+		// the lock is shared
+		{name: "lock", id: laptop, fn: "lock"},
+		{name: "locked", id: phone, fn: "get", err: "failed to get the invoker's identity|not locked certificate"},
+		{name: "unlock", id: laptop, fn: "unlock"},
+		{name: "unlocked", id: phone, fn: "get"},
+	})
+
+	// expired
+	env.mustInvoke(phone, code, nil, "link_begin", tablet.Fingerprint(), "60")
+	key := keyStub(env).CreateLinkKey(CreateLinkHash(code["kiesnet-id/link_code"]))
+	expired := &Link{}
+	if err := json.Unmarshal(env.stub.state[key], expired); err != nil {
+		t.Fatal(err)
+	}
+	expired.ExpiryTime = txtime.New(time.Now().Add(-time.Second))
+	env.stub.state[key], _ = json.Marshal(expired)
+	runTxTests(t, env, []txTest{
+		{name: "expired", id: tablet, transient: code, fn: "register", err: "failed to link the KID|expired link code"},
+	})
+
+	// the certificate which began the link is revoked
+	env.mustInvoke(laptop, code, nil, "link_begin", tablet.Fingerprint())
+	env.mustInvoke(phone, nil, nil, "revoke", laptop.SN())
+	runTxTests(t, env, []txTest{
+		{name: "revoked origin", id: tablet, transient: code, fn: "register", err: "failed to link the KID|revoked certificate"},
+	})
+
+	// old-style
+	bob := env.ca.enroll(t, "bob", nil)
+	pin := map[string]string{"kiesnet-id/pin": "1234", "kiesnet-id/link_code": "0123456789ab"}
+	env.register(bob, map[string]string{"kiesnet-id/pin": "1234"})
+	runTxTests(t, env, []txTest{
+		{name: "old-style", id: bob, transient: pin, fn: "link_begin", params: []string{tablet.Fingerprint()}, err: "not supported KID"},
+	})
+}
+
+func TestLockExpiry(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.ca.enroll(t, "alice", nil)
+	alice2 := env.ca.reenroll(t, "alice", alice.key, nil)
+	p := env.register(alice, nil)
+	env.register(alice2, nil)
+
+	// expire sets the stored lock expiry to the past
+	expire := func() {
+		t.Helper()
+		kid := env.kid(p.ID)
+		kid.LockExpiryTime = txtime.New(time.Now().Add(-time.Second))
+		data, err := json.Marshal(kid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key, value := range env.stub.state {
+			if strings.HasPrefix(key, "KID_") && strings.Contains(string(value), p.ID) {
+				env.stub.state[key] = data
+			}
+		}
+	}
+
+	kid := &KID{}
+	env.mustInvoke(alice, nil, kid, "lock", "60")
+	if kid.LockExpiryTime == nil || kid.LockExpiryTime.Sub(time.Now()) > time.Minute || kid.LockExpiryTime.Sub(time.Now()) < 55*time.Second {
+		t.Fatalf("unexpected lock expiry: %v", kid.LockExpiryTime)
+	}
+	got := &struct {
+		ID             string       `json:"id"`
+		LockExpiryTime *txtime.Time `json:"lock_expiry_time"`
+	}{}
+	env.mustInvoke(alice, nil, got, "get")
+	if got.ID != p.ID || got.LockExpiryTime == nil || got.LockExpiryTime.Cmp(kid.LockExpiryTime) != 0 {
+		t.Errorf("unexpected get payload: %+v", got)
+	}
+	got.LockExpiryTime = nil
+	env.mustInvoke(alice, nil, got, "kid", "", "json")
+	if got.ID != p.ID || got.LockExpiryTime == nil || got.LockExpiryTime.Cmp(kid.LockExpiryTime) != 0 {
+		t.Errorf("unexpected kid payload: %+v", got)
+	}
+	if id := env.mustInvoke(alice, nil, nil, "kid"); string(id) != p.ID {
+		t.Errorf("expected %s, but %s", p.ID, id)
+	}
+
+	runTxTests(t, env, []txTest{
+		{name: "locked", id: alice2, fn: "get", err: "failed to get the invoker's identity|not locked certificate"},
+	})
+	expire()
+	runTxTests(t, env, []txTest{
+		{name: "expired", id: alice2, fn: "get"},
+		{name: "re-lock", id: alice2, fn: "lock", params: []string{time.Now().Add(time.Hour).UTC().Format(time.RFC3339)}},
+		{name: "locked", id: alice, fn: "get", err: "failed to get the invoker's identity|not locked certificate"},
+		{name: "unlock", id: alice2, fn: "unlock"},
+		{name: "invalid", id: alice, fn: "lock", params: []string{"an hour"}, err: "invalid lock expiry. expecting seconds or RFC3339 time"},
+		{name: "negative", id: alice, fn: "lock", params: []string{"-60"}, err: "lock expiry must be after the transaction time"},
+		{name: "negative overflow", id: alice, fn: "lock", params: []string{"-9223372036854775807"}, err: "lock expiry must be after the transaction time"},
+		{name: "too long", id: alice, fn: "lock", params: []string{"315360001"}, err: "invalid lock expiry. expecting seconds up to 315360000 or RFC3339 time"},
+		{name: "overflow", id: alice, fn: "lock", params: []string{"9223372036854775807"}, err: "invalid lock expiry. expecting seconds up to 315360000 or RFC3339 time"},
+		{name: "past", id: alice, fn: "lock", params: []string{"2018-12-01T00:00:00Z"}, err: "lock expiry must be after the transaction time"},
+		{name: "forever", id: alice, fn: "lock"},
+	})
+	if stored := env.kid(p.ID); stored.Lock != alice.SN() || stored.LockExpiryTime != nil {
+		t.Errorf("unexpected lock: %+v", stored)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	env := newTestEnv(t)
+	phone := env.ca.enroll(t, "alice-phone", pubkeyAttrs)
+	laptop := env.ca.enroll(t, "alice-laptop", pubkeyAttrs)
+	recovering := env.ca.enroll(t, "alice-new", pubkeyAttrs)
+	thief := env.ca.enroll(t, "mallory", pubkeyAttrs)
+	bob := env.ca.enroll(t, "bob", nil)
+	carol := env.ca.enroll(t, "carol", nil)
+	dave := env.ca.enroll(t, "dave", nil)
+	p := env.register(phone, nil)
+	env.mustInvoke(phone, map[string]string{"kiesnet-id/link_code": "0123456789ab"}, nil, "link_begin", laptop.Fingerprint())
+	env.register(laptop, map[string]string{"kiesnet-id/link_code": "0123456789ab"})
+	guardians := []string{env.register(bob, nil).ID, env.register(carol, nil).ID, env.register(dave, nil).ID}
+	env.mustInvoke(phone, nil, nil, "lock")
+
+	runTxTests(t, env, []txTest{
+		{name: "no guardian", id: recovering, fn: "recovery_request", params: []string{p.ID}, err: "failed to get the guardians|no guardian"},
+		{name: "threshold", id: phone, fn: "guardian_set", params: append([]string{"4", ""}, guardians...), err: "invalid threshold. expecting 1 ~ 3"},
+		{name: "waiting period", id: phone, fn: "guardian_set", params: append([]string{"2", "60"}, guardians...), err: "invalid waiting period. expecting 3600 ~ 2592000"},
+		{name: "self", id: phone, fn: "guardian_set", params: []string{"1", "", p.ID}, err: "the KID can't be its own guardian"},
+		{name: "duplicated", id: phone, fn: "guardian_set", params: []string{"1", "", guardians[0], guardians[0]}, err: "duplicated guardian [" + guardians[0] + "]"},
+		{name: "unknown", id: phone, fn: "guardian_set", params: []string{"1", "", unknownKID}, err: "failed to get the guardian KID|not registered KID"},
+		{name: "injection", id: phone, fn: "guardian_set", params: []string{"1", "", injectionKID}, err: "failed to get the guardian KID|invalid KID. expecting 40 lowercase hex characters"},
+		{name: "locked", id: laptop, fn: "guardian_set", params: append([]string{"2", "3600"}, guardians...), err: "failed to get the invoker's identity|not locked certificate"},
+		{name: "set", id: phone, fn: "guardian_set", params: append([]string{"2", "3600"}, guardians...)},
+	})
+	gs := &GuardianSet{}
+	env.mustInvoke(phone, nil, gs, "guardians")
+	if gs.DOCTYPEID != p.ID || gs.Threshold != 2 || gs.Delay != 3600 || len(gs.Guardians) != 3 {
+		t.Fatalf("unexpected guardians: %+v", gs)
+	}
+
+	r := &struct {
+		KID           string       `json:"kid"`
+		SN            string       `json:"sn"`
+		Revoke        bool         `json:"revoke"`
+		Approvals     []string     `json:"approvals"`
+		EffectiveTime *txtime.Time `json:"effective_time"`
+	}{}
+	env.mustInvoke(recovering, nil, r, "recovery_request", p.ID, "true")
+	if r.KID != p.ID || r.SN != recovering.SN() || !r.Revoke || len(r.Approvals) != 0 {
+		t.Fatalf("unexpected recovery: %+v", r)
+	}
+	runTxTests(t, env, []txTest{
+		{name: "unknown KID", id: thief, fn: "recovery_request", params: []string{unknownKID}, err: "failed to get the KID|not registered KID"},
+		{name: "pending", id: thief, fn: "recovery_request", params: []string{p.ID}, err: "already requested recovery"},
+		{name: "registered", id: bob, fn: "recovery_request", params: []string{p.ID}, err: "already registered KID"},
+		{name: "not guardian", id: phone, fn: "recovery_approve", params: []string{p.ID}, err: "not a guardian of the KID"},
+		{name: "approve", id: bob, fn: "recovery_approve", params: []string{p.ID}},
+		{name: "twice", id: bob, fn: "recovery_approve", params: []string{p.ID}, err: "already approved recovery"},
+		{name: "not approved", id: recovering, fn: "recovery_complete", params: []string{p.ID}, err: "not approved recovery"},
+		{name: "approve", id: carol, fn: "recovery_approve", params: []string{p.ID}},
+		{name: "not recovering", id: thief, fn: "recovery_complete", params: []string{p.ID}, err: "not the recovering certificate"},
+		{name: "waiting", id: recovering, fn: "recovery_complete", params: []string{p.ID}, err: "recovery is in the waiting period"},
+		// any active certificate can cancel, even if locked with another
+		{name: "cancel", id: laptop, fn: "recovery_cancel"},
+		{name: "cancelled", id: carol, fn: "recovery", params: []string{p.ID}, err: "failed to get the recovery|no recovery request"},
+		{name: "no recovery", id: laptop, fn: "recovery_cancel", err: "failed to get the recovery|no recovery request"},
+		// the guardian rejects the unknown request occupying the KID
+		{name: "squat", id: thief, fn: "recovery_request", params: []string{p.ID}},
+		{name: "squatted", id: recovering, fn: "recovery_request", params: []string{p.ID}, err: "already requested recovery"},
+		{name: "reject by non-guardian", id: thief, fn: "recovery_reject", params: []string{p.ID}, err: "failed to get the invoker's identity|not registrated certificate"},
+		{name: "reject by owner", id: laptop, fn: "recovery_reject", params: []string{p.ID}, err: "failed to get the invoker's identity|not locked certificate"},
+		{name: "reject", id: bob, fn: "recovery_reject", params: []string{p.ID}},
+		{name: "rejected", id: carol, fn: "recovery_reject", params: []string{p.ID}, err: "failed to get the recovery|no recovery request"},
+		{name: "request after rejection", id: recovering, fn: "recovery_request", params: []string{p.ID}},
+		{name: "approve", id: bob, fn: "recovery_approve", params: []string{p.ID}},
+		{name: "approve", id: carol, fn: "recovery_approve", params: []string{p.ID}},
+		{name: "reject approved", id: dave, fn: "recovery_reject", params: []string{p.ID}, err: "already approved recovery"},
+		{name: "cancel approved", id: laptop, fn: "recovery_cancel"},
+	})
+
+	// modify overwrites the stored recovery
+	key := keyStub(env).CreateRecoveryKey(p.ID)
+	modify := func(fn func(*Recovery)) {
+		t.Helper()
+		stored := &Recovery{}
+		if err := json.Unmarshal(env.stub.state[key], stored); err != nil {
+			t.Fatal(err)
+		}
+		fn(stored)
+		env.stub.state[key], _ = json.Marshal(stored)
+	}
+
+	// expired request can be replaced
+	env.mustInvoke(thief, nil, nil, "recovery_request", p.ID)
+	modify(func(stored *Recovery) { stored.ExpiryTime = txtime.New(time.Now().Add(-time.Second)) })
+	runTxTests(t, env, []txTest{
+		{name: "expired", id: bob, fn: "recovery_approve", params: []string{p.ID}, err: "expired recovery request"},
+		{name: "replace", id: recovering, fn: "recovery_request", params: []string{p.ID, "true"}},
+		{name: "approve", id: carol, fn: "recovery_approve", params: []string{p.ID}},
+		{name: "approve", id: dave, fn: "recovery_approve", params: []string{p.ID}},
+	})
+	env.mustInvoke(recovering, nil, r, "recovery", p.ID)
+	if len(r.Approvals) != 2 || r.EffectiveTime == nil || r.EffectiveTime.Sub(time.Now()) < 59*time.Minute {
+		t.Fatalf("unexpected recovery: %+v", r)
+	}
+
+	modify(func(stored *Recovery) { stored.EffectiveTime = txtime.New(time.Now().Add(-time.Second)) })
+	id := &identityPayload{}
+	env.mustInvoke(recovering, nil, id, "recovery_complete", p.ID)
+	if id.ID != p.ID || id.SN != recovering.SN() {
+		t.Fatalf("unexpected identity: %+v", id)
+	}
+	if kid := env.kid(p.ID); kid.Lock != "" {
+		t.Errorf("expected unlocked, but %+v", kid)
+	}
+	p2, err := event.Decode(env.stub.event.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p2.Filter(event.CertRevoked)) != 2 || len(p2.Filter(event.KIDRecovered)) != 1 {
+		t.Errorf("unexpected events: %+v", p2.Events)
+	}
+	runTxTests(t, env, []txTest{
+		{name: "recovered", id: recovering, fn: "get"},
+		{name: "consumed", id: recovering, fn: "recovery_complete", params: []string{p.ID}, err: "failed to get the recovery|no recovery request"},
+		{name: "revoked", id: phone, fn: "get", err: "failed to get the invoker's identity|revoked certificate"},
+		{name: "revoked", id: laptop, fn: "get", err: "failed to get the invoker's identity|revoked certificate"},
+		{name: "remove", id: recovering, fn: "guardian_set", params: []string{"0"}},
+		{name: "removed", id: recovering, fn: "guardians", err: "failed to get the guardians|no guardian"},
+	})
+}
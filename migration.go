@@ -0,0 +1,110 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
+)
+
+// MigrationDeadlineKey is the state key of the migration deadline
+const MigrationDeadlineKey = "CONFIG_MIGRATION_DEADLINE"
+
+// PrivateKIDsFetchSize _
+const PrivateKIDsFetchSize = 20
+
+// MigrationMaxBatchSize is the max number of KIDs migrated in a transaction
+const MigrationMaxBatchSize = 50
+
+// PrivateKID is the summary of the old-style KID, without the PIN
+type PrivateKID struct {
+	KID         string       `json:"kid"`
+	Key         string       `json:"key"` // state key to migrate
+	HasPIN      bool         `json:"has_pin"`
+	CreatedTime *txtime.Time `json:"created_time,omitempty"`
+	UpdatedTime *txtime.Time `json:"updated_time,omitempty"`
+}
+
+// NewPrivateKID _
+func NewPrivateKID(kid *KID) *PrivateKID {
+	return &PrivateKID{
+		KID:         kid.DOCTYPEID,
+		Key:         kid.key,
+		HasPIN:      kid.HasPIN(),
+		CreatedTime: kid.CreatedTime,
+		UpdatedTime: kid.UpdatedTime,
+	}
+}
+
+// MigrationResult is the result of the batch migration
+type MigrationResult struct {
+	Migrated []string `json:"migrated"` // KIDs
+	Skipped  []string `json:"skipped"`  // state keys of the KIDs with the PIN or not in the private collection, or not KIDs
+}
+
+// MarshalPayload _
+func (mr *MigrationResult) MarshalPayload() ([]byte, error) {
+	return json.Marshal(mr)
+}
+
+// MigrationCount is the number of the old-style KIDs
+type MigrationCount struct {
+	Total   int `json:"total"`
+	WithPIN int `json:"with_pin"` // can't be migrated by the administrator
+}
+
+// MarshalPayload _
+func (mc *MigrationCount) MarshalPayload() ([]byte, error) {
+	return json.Marshal(mc)
+}
+
+// MigrationDeadline _
+type MigrationDeadline struct {
+	Deadline *txtime.Time `json:"deadline,omitempty"` // nil: no deadline
+}
+
+// IsOver returns whether the old-style access is refused at the time
+func (md *MigrationDeadline) IsOver(ts *txtime.Time) bool {
+	return md.Deadline != nil && md.Deadline.Cmp(ts) <= 0
+}
+
+// MarshalPayload _
+func (md *MigrationDeadline) MarshalPayload() ([]byte, error) {
+	return json.Marshal(md)
+}
+
+// GetMigrationDeadline retrieves the deadline from the ledger
+func GetMigrationDeadline(stub shim.ChaincodeStubInterface) (*MigrationDeadline, error) {
+	md := &MigrationDeadline{}
+	data, err := stub.GetState(MigrationDeadlineKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the migration deadline state")
+	}
+	if data != nil {
+		if err = json.Unmarshal(data, md); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal the migration deadline")
+		}
+	}
+	return md, nil
+}
+
+// PutMigrationDeadline writes the deadline into the ledger, or removes it if the deadline is nil
+func PutMigrationDeadline(stub shim.ChaincodeStubInterface, md *MigrationDeadline) error {
+	if nil == md.Deadline {
+		if err := stub.DelState(MigrationDeadlineKey); err != nil {
+			return errors.Wrap(err, "failed to delete the migration deadline state")
+		}
+		return nil
+	}
+	data, err := json.Marshal(md)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the migration deadline")
+	}
+	if err = stub.PutState(MigrationDeadlineKey, data); err != nil {
+		return errors.Wrap(err, "failed to put the migration deadline state")
+	}
+	return nil
+}
@@ -9,13 +9,25 @@ import (
 
 	"github.com/key-inside/kiesnet-ccpkg/txtime"
 	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
 	"golang.org/x/crypto/sha3"
 )
 
+// PIN hash algorithms
+const (
+	PINAlgoSHAKE256 = ""         // legacy, SHAKE256 of salt|code
+	PINAlgoScrypt1  = "scrypt-1" // scrypt N=32768, r=8, p=1
+)
+
+// PINAlgo is the algorithm of the new PIN hash
+const PINAlgo = PINAlgoScrypt1
+
 // PIN _
 type PIN struct {
+	Algo        string       `json:"algo,omitempty"`
 	Hash        string       `json:"hash"`
 	Salt        string       `json:"salt"`
+	Empty       bool         `json:"empty,omitempty"` // the empty code, to check without hashing
 	UpdatedTime *txtime.Time `json:"updated_time,omitempty"`
 }
 
@@ -28,20 +40,56 @@ func NewPIN(code string) (*PIN, error) {
 	}
 
 	pin := &PIN{}
+	pin.Algo = PINAlgo
 	pin.Salt = base64.RawURLEncoding.EncodeToString(salt)
 	pin.Hash = pin.CreateHash(code)
+	pin.Empty = ("" == code)
 
 	return pin, nil
 }
 
 // CreateHash _
+// The parameters of each algorithm are fixed, so the hash is deterministic for the endorsement.
 func (pin *PIN) CreateHash(code string) string {
-	h := make([]byte, 32)
-	sha3.ShakeSum256(h, []byte(pin.Salt+"|"+code))
-	return hex.EncodeToString(h)
+	switch pin.Algo {
+	case PINAlgoSHAKE256:
+		h := make([]byte, 32)
+		sha3.ShakeSum256(h, []byte(pin.Salt+"|"+code))
+		return hex.EncodeToString(h)
+	case PINAlgoScrypt1:
+		h, err := scrypt.Key([]byte(code), []byte(pin.Salt), 32768, 8, 1, 32)
+		if err != nil { // never, with the fixed parameters
+			return ""
+		}
+		return hex.EncodeToString(h)
+	}
+	return "" // unknown algorithm never matches
 }
 
 // Match _
 func (pin *PIN) Match(code string) bool {
-	return (pin.CreateHash(code) == pin.Hash)
-}
\ No newline at end of file
+	h := pin.CreateHash(code)
+	return (h != "" && h == pin.Hash)
+}
+
+// IsEmpty returns whether the code is empty.
+// The legacy hash (cheap SHAKE256) has no marker, so it is checked by hashing.
+func (pin *PIN) IsEmpty() bool {
+	if PINAlgoSHAKE256 == pin.Algo {
+		return pin.Match("")
+	}
+	return pin.Empty
+}
+
+// NeedsRehash returns whether the hash is not the algorithm of the new PIN hash
+func (pin *PIN) NeedsRehash() bool {
+	return pin.Algo != PINAlgo
+}
+
+// Rehash re-creates the hash of the matched code with the algorithm of the new PIN hash.
+// It keeps the salt and the updated time.
+func (pin *PIN) Rehash(code string) {
+	pin.Algo = PINAlgo
+	pin.Hash = pin.CreateHash(code)
+	pin.Empty = ("" == code)
+}
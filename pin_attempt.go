@@ -0,0 +1,50 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"time"
+
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+)
+
+// PINMaxFailures is the number of failures which puts the KID into the cooldown
+const PINMaxFailures = 5
+
+// PINCooldown is the seconds of the cooldown
+const PINCooldown = 900
+
+// PINFailureStatus is the status of the response of the mismatched PIN.
+// It is in the success range of the endorsement, so the failure is committed.
+const PINFailureStatus = 299
+
+// PINAttempt is the failed PIN attempts of the old-style KID
+type PINAttempt struct {
+	DOCTYPEID       string       `json:"@pin_attempt"` // KID
+	Failures        int          `json:"failures"`
+	LastFailedTime  *txtime.Time `json:"last_failed_time,omitempty"`
+	CooldownEndTime *txtime.Time `json:"cooldown_end_time,omitempty"`
+}
+
+// NewPINAttempt _
+func NewPINAttempt(kid string) *PINAttempt {
+	return &PINAttempt{DOCTYPEID: kid}
+}
+
+// IsCoolingDown returns whether PIN checks are blocked at the time
+func (pa *PINAttempt) IsCoolingDown(ts *txtime.Time) bool {
+	return pa.CooldownEndTime != nil && pa.CooldownEndTime.Cmp(ts) > 0
+}
+
+// Fail records the failure. The failures after the cooldown start over.
+func (pa *PINAttempt) Fail(ts *txtime.Time) {
+	if pa.CooldownEndTime != nil {
+		pa.Failures = 0
+		pa.CooldownEndTime = nil
+	}
+	pa.Failures++
+	pa.LastFailedTime = ts
+	if pa.Failures >= PINMaxFailures {
+		pa.CooldownEndTime = txtime.New(ts.Add(PINCooldown * time.Second))
+	}
+}
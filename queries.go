@@ -2,28 +2,61 @@
 
 package main
 
-import "fmt"
+import (
+	"encoding/json"
+)
 
-// QueryNotRevokedCertificates _
+// CreateQueryCertificates returns the query of the KID's certificates with the list options
 /*
 {
 	"selector": {
 		"@certificate": "%s",
-		"revoke_time": {
-			"$exists": false
+		"revoked_time": {
+			"$exists": false // "exclude", true: "only", none: "include"
+		},
+		"created_time": {
+			"$gte": "from",
+			"$lt": "to"
 		}
 	},
-	"use_index": ["certificate", "not-revoked"]
+	"sort": [{"@certificate": "asc"}, {"created_time": "asc"}],
+	"use_index": ["certificate", "not-revoked-created"] // "revoked-created", "created"
 }
 */
-const QueryNotRevokedCertificates = `{"selector":{"@certificate":"%s","revoke_time":{"$exists":false}},"use_index":["certificate","not-revoked"]}`
-
-// CreateQueryNotRevokedCertificates _
-func CreateQueryNotRevokedCertificates(kid string) string {
-	return fmt.Sprintf(QueryNotRevokedCertificates, kid)
+func CreateQueryCertificates(kid string, opts *ListOptions) string {
+	selector := map[string]interface{}{"@certificate": kid}
+	index := "created"
+	switch opts.Revoked {
+	case RevokedExclude:
+		selector["revoked_time"] = map[string]bool{"$exists": false}
+		index = "not-revoked-created"
+	case RevokedOnly:
+		selector["revoked_time"] = map[string]bool{"$exists": true}
+		index = "revoked-created"
+	}
+	if opts.from != nil || opts.to != nil {
+		created := map[string]string{}
+		if opts.from != nil {
+			created["$gte"] = opts.from.String()
+		}
+		if opts.to != nil {
+			created["$lt"] = opts.to.String()
+		}
+		selector["created_time"] = created
+	}
+	order := opts.Sort
+	if "" == order {
+		order = SortAsc
+	}
+	query, _ := json.Marshal(map[string]interface{}{ // never fails
+		"selector":  selector,
+		"sort":      []map[string]string{{"@certificate": order}, {"created_time": order}},
+		"use_index": []string{"certificate", index},
+	})
+	return string(query)
 }
 
-// QueryKIDByID _
+// CreateQueryKIDByID _
 /*
 {
 	"selector": {
@@ -33,9 +66,56 @@ func CreateQueryNotRevokedCertificates(kid string) string {
 	"use_index": ["kid", "id"]
 }
 */
-const QueryKIDByID = `{"selector":{"@kid":"%s"},"limit":1,"use_index":["kid","id"]}`
-
-// CreateQueryKIDByID _
 func CreateQueryKIDByID(kid string) string {
-	return fmt.Sprintf(QueryKIDByID, kid)
+	query, _ := json.Marshal(map[string]interface{}{ // never fails
+		"selector":  map[string]interface{}{"@kid": kid},
+		"limit":     1,
+		"use_index": []string{"kid", "id"},
+	})
+	return string(query)
+}
+
+// CreateQueryOriginKIDByID excludes the pointers of the linked devices
+/*
+{
+	"selector": {
+		"@kid": "%s",
+		"link": {
+			"$exists": false
+		}
+	},
+	"limit": 1,
+	"use_index": ["kid", "id"]
+}
+*/
+func CreateQueryOriginKIDByID(kid string) string {
+	query, _ := json.Marshal(map[string]interface{}{ // never fails
+		"selector":  map[string]interface{}{"@kid": kid, "link": map[string]bool{"$exists": false}},
+		"limit":     1,
+		"use_index": []string{"kid", "id"},
+	})
+	return string(query)
+}
+
+// CreateQueryPrivateKIDs _
+/*
+{
+	"selector": {
+		"@kid": {
+			"$gt": "%s"
+		}
+	},
+	"sort": [{"@kid": "asc"}],
+	"limit": %d,
+	"use_index": ["kid", "id"]
+}
+*/
+func CreateQueryPrivateKIDs(bookmark string, limit int) string {
+	query, _ := json.Marshal(map[string]interface{}{ // never fails
+		"selector":  map[string]interface{}{"@kid": map[string]string{"$gt": bookmark}},
+		"sort":      []map[string]string{{"@kid": "asc"}},
+		"limit":     limit,
+		"use_index": []string{"kid", "id"},
+	})
+	return string(query)
 }
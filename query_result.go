@@ -47,6 +47,38 @@ func NewQueryResult(meta *peer.QueryResponseMetadata, iter shim.StateQueryIterat
 	return result, nil
 }
 
+// NewHistoryQueryResult returns a page of the key's history.
+// The bookmark is the last tx ID of the previous page, and it is empty in the last page.
+func NewHistoryQueryResult(iter shim.HistoryQueryIteratorInterface, pageSize int, bookmark string) (*QueryResult, error) {
+	histories := []*History{}
+	skip := bookmark != ""
+	for iter.HasNext() && len(histories) < pageSize {
+		km, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		if skip {
+			skip = km.GetTxId() != bookmark
+			continue
+		}
+		histories = append(histories, NewHistory(km))
+	}
+
+	records, err := json.Marshal(histories)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &QueryResult{}
+	result.Meta = &peer.QueryResponseMetadata{FetchedRecordsCount: int32(len(histories))}
+	if len(histories) > 0 && iter.HasNext() {
+		result.Meta.Bookmark = histories[len(histories)-1].TxID
+	}
+	result.Records = records
+
+	return result, nil
+}
+
 // MarshalPayload _
 func (qr *QueryResult) MarshalPayload() ([]byte, error) {
 	var err error
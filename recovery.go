@@ -0,0 +1,88 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+)
+
+// RecoveryRequestTTL is the seconds until the recovery request is approved by the guardians
+const RecoveryRequestTTL = 604800 // 7 days
+
+// Recovery is the pending recovery of the KID with a new certificate
+type Recovery struct {
+	DOCTYPEID     string       `json:"@recovery"` // KID
+	Key           string       `json:"key"`       // state key of the KID
+	UUID          string       `json:"uuid"`      // new device
+	SN            string       `json:"sn"`        // new certificate
+	Revoke        bool         `json:"revoke"`    // revoke the other certificates
+	Approvals     []string     `json:"approvals"` // guardian KIDs
+	CreatedTime   *txtime.Time `json:"created_time,omitempty"`
+	ExpiryTime    *txtime.Time `json:"expiry_time,omitempty"`    // of the request, until approved
+	ApprovedTime  *txtime.Time `json:"approved_time,omitempty"`  // threshold is met
+	EffectiveTime *txtime.Time `json:"effective_time,omitempty"` // end of the waiting period
+}
+
+// NewRecovery _
+func NewRecovery(kid string) *Recovery {
+	return &Recovery{
+		DOCTYPEID: kid,
+		Approvals: []string{},
+	}
+}
+
+// IsExpired returns whether the request has been expired without the approval
+func (r *Recovery) IsExpired(ts *txtime.Time) bool {
+	return nil == r.ApprovedTime && r.ExpiryTime.Cmp(ts) <= 0
+}
+
+// IsEffective returns whether the waiting period of the approved recovery is over
+func (r *Recovery) IsEffective(ts *txtime.Time) bool {
+	return r.EffectiveTime != nil && r.EffectiveTime.Cmp(ts) <= 0
+}
+
+// HasApproval returns whether the guardian approved
+func (r *Recovery) HasApproval(kid string) bool {
+	for _, approval := range r.Approvals {
+		if approval == kid {
+			return true
+		}
+	}
+	return false
+}
+
+// CountApprovals returns the number of approvals by the current guardians
+func (r *Recovery) CountApprovals(gs *GuardianSet) int {
+	count := 0
+	for _, approval := range r.Approvals {
+		if gs.Has(approval) {
+			count++
+		}
+	}
+	return count
+}
+
+// MarshalPayload _
+func (r *Recovery) MarshalPayload() ([]byte, error) {
+	return json.Marshal(&struct {
+		KID           string       `json:"kid"`
+		SN            string       `json:"sn"`
+		Revoke        bool         `json:"revoke"`
+		Approvals     []string     `json:"approvals"`
+		CreatedTime   *txtime.Time `json:"created_time,omitempty"`
+		ExpiryTime    *txtime.Time `json:"expiry_time,omitempty"`
+		ApprovedTime  *txtime.Time `json:"approved_time,omitempty"`
+		EffectiveTime *txtime.Time `json:"effective_time,omitempty"`
+	}{
+		KID:           r.DOCTYPEID,
+		SN:            r.SN,
+		Revoke:        r.Revoke,
+		Approvals:     r.Approvals,
+		CreatedTime:   r.CreatedTime,
+		ExpiryTime:    r.ExpiryTime,
+		ApprovedTime:  r.ApprovedTime,
+		EffectiveTime: r.EffectiveTime,
+	})
+}
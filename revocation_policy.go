@@ -0,0 +1,105 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/pkg/errors"
+)
+
+// RevocationPolicyKey is the state key of the revocation policy
+const RevocationPolicyKey = "CONFIG_REVOCATION_POLICY"
+
+// revocation rules
+const (
+	RevocationAllow = "allow" // revoke
+	RevocationForce = "force" // revoke only with 'kiesnet-id/force' transient
+	RevocationDeny  = "deny"  // never revoke
+)
+
+// RevocationPolicy is the rules for the risky revocations
+type RevocationPolicy struct {
+	Self string `json:"self"` // revoking the invoker's certificate
+	Lock string `json:"lock"` // revoking the certificate locking the KID
+	Last string `json:"last"` // revoking the last active certificate of the KID
+}
+
+// NewRevocationPolicy returns the default policy.
+// Self-revocation is allowed as the baseline 'revoke', the operators opt in to the stricter rule by Init.
+func NewRevocationPolicy() *RevocationPolicy {
+	return &RevocationPolicy{
+		Self: RevocationAllow,
+		Lock: RevocationForce,
+		Last: RevocationForce,
+	}
+}
+
+// ParseRevocationPolicy parses JSON string. Omitted rules are default.
+func ParseRevocationPolicy(data string) (*RevocationPolicy, error) {
+	policy := NewRevocationPolicy()
+	if err := json.Unmarshal([]byte(data), policy); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the revocation policy")
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// Validate _
+func (policy *RevocationPolicy) Validate() error {
+	for _, rule := range []string{policy.Self, policy.Lock, policy.Last} {
+		switch rule {
+		case RevocationAllow, RevocationForce, RevocationDeny:
+		default:
+			return errors.Errorf("invalid revocation rule [%s]", rule)
+		}
+	}
+	return nil
+}
+
+// permitsRevocation returns whether the rule permits the revocation, and whether forcing can permit it.
+func permitsRevocation(rule string, force bool) (permitted, forcible bool) {
+	switch rule {
+	case RevocationAllow:
+		return true, false
+	case RevocationForce:
+		return force, true
+	}
+	return false, false
+}
+
+// MarshalPayload _
+func (policy *RevocationPolicy) MarshalPayload() ([]byte, error) {
+	return json.Marshal(policy)
+}
+
+// GetRevocationPolicy retrieves the policy from the ledger, or returns the default policy.
+func GetRevocationPolicy(stub shim.ChaincodeStubInterface) (*RevocationPolicy, error) {
+	data, err := stub.GetState(RevocationPolicyKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the revocation policy state")
+	}
+	if data == nil {
+		return NewRevocationPolicy(), nil
+	}
+	policy := NewRevocationPolicy()
+	if err = json.Unmarshal(data, policy); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the revocation policy")
+	}
+	return policy, nil
+}
+
+// PutRevocationPolicy writes the policy into the ledger
+func PutRevocationPolicy(stub shim.ChaincodeStubInterface, policy *RevocationPolicy) error {
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the revocation policy")
+	}
+	if err = stub.PutState(RevocationPolicyKey, data); err != nil {
+		return errors.Wrap(err, "failed to put the revocation policy state")
+	}
+	return nil
+}
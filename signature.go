@@ -0,0 +1,89 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// SignatureAnyActive is the SN parameter of 'verify_sig' to verify with any active certificate of the KID
+const SignatureAnyActive = "any"
+
+// hash functions of the digests, by the size
+var signatureHashes = map[int]crypto.Hash{
+	32: crypto.SHA256,
+	48: crypto.SHA384,
+	64: crypto.SHA512,
+}
+
+// SignatureVerification is the result of 'verify_sig'
+type SignatureVerification struct {
+	KID      string `json:"kid"`
+	SN       string `json:"sn,omitempty"` // SN of the verifying certificate
+	Verified bool   `json:"verified"`
+}
+
+// MarshalPayload _
+func (sv *SignatureVerification) MarshalPayload() ([]byte, error) {
+	return json.Marshal(sv)
+}
+
+// ParseDigest decodes the hex digest of SHA-256, SHA-384 or SHA-512
+func ParseDigest(digest string) ([]byte, error) {
+	b, err := hex.DecodeString(digest)
+	if err != nil || 0 == signatureHashes[len(b)] {
+		return nil, errors.New("invalid digest. expecting hex SHA-256, SHA-384 or SHA-512")
+	}
+	return b, nil
+}
+
+// ParseSignature decodes the base64 signature (ECDSA: ASN.1 DER, RSA: PKCS#1 v1.5 or PSS)
+func ParseSignature(sig string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil || 0 == len(b) {
+		return nil, errors.New("invalid signature. expecting base64")
+	}
+	return b, nil
+}
+
+// ecdsaSignature reflects the ASN.1 structure of an ECDSA signature.
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// VerifySignature verifies the signature of the digest with the base64 PKIX DER public key of the certificate
+func VerifySignature(publicKey string, digest, sig []byte) (bool, error) {
+	der, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to decode the public key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to parse the public key")
+	}
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		es := ecdsaSignature{}
+		if rest, err := asn1.Unmarshal(sig, &es); err != nil || len(rest) > 0 || nil == es.R || nil == es.S {
+			return false, nil
+		}
+		return ecdsa.Verify(pub, digest, es.R, es.S), nil
+	case *rsa.PublicKey:
+		hash := signatureHashes[len(digest)]
+		if nil == rsa.VerifyPKCS1v15(pub, hash, digest, sig) {
+			return true, nil
+		}
+		return nil == rsa.VerifyPSS(pub, hash, digest, sig, nil), nil
+	}
+	return false, nil
+}
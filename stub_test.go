@@ -0,0 +1,601 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+// testStub is an in-memory shim.ChaincodeStubInterface.
+// Writes are buffered during a transaction and committed only when the
+// transaction succeeds, and reads always see the committed state like a peer does.
+// Like the peer, a transaction can't both query the private data and write.
+// Methods not implemented here panic through the nil embedded interface.
+type testStub struct {
+	shim.ChaincodeStubInterface
+
+	args      [][]byte
+	txID      string
+	txTime    time.Time
+	txCount   int
+	creator   []byte
+	transient map[string][]byte
+	event     *peer.ChaincodeEvent // the event of the last transaction
+
+	state   map[string][]byte
+	private map[string]map[string][]byte
+	history map[string][]*queryresult.KeyModification
+
+	writes        map[string][]byte // nil value means delete
+	privateWrites map[string]map[string][]byte
+	privateQuery  bool // the transaction queried the private data
+
+	levelDB bool // the state database doesn't support the rich queries
+}
+
+func newTestStub() *testStub {
+	return &testStub{
+		state:   map[string][]byte{},
+		private: map[string]map[string][]byte{},
+		history: map[string][]*queryresult.KeyModification{},
+	}
+}
+
+// initialize runs Init of the chaincode like instantiate or upgrade.
+func (s *testStub) initialize(params ...string) peer.Response {
+	s.begin(nil, nil, "init", params)
+	res := new(Chaincode).Init(s)
+	s.end(res)
+	return res
+}
+
+// invoke runs the chaincode function as a single transaction.
+// The transients are only valid for this transaction.
+func (s *testStub) invoke(creator []byte, transient map[string][]byte, fn string, params ...string) peer.Response {
+	s.begin(creator, transient, fn, params)
+	res := new(Chaincode).Invoke(s)
+	s.end(res)
+	return res
+}
+
+func (s *testStub) begin(creator []byte, transient map[string][]byte, fn string, params []string) {
+	s.args = [][]byte{[]byte(fn)}
+	for _, p := range params {
+		s.args = append(s.args, []byte(p))
+	}
+	s.txID = s.nextTxID()
+	s.txCount++
+	s.txTime = time.Now()
+	s.creator = creator
+	s.transient = transient
+	s.event = nil
+	s.writes = map[string][]byte{}
+	s.privateWrites = map[string]map[string][]byte{}
+	s.privateQuery = false
+}
+
+// checkWrite fails the write after the private data query, like the peer's simulator
+func (s *testStub) checkWrite() error {
+	if s.privateQuery {
+		return fmt.Errorf("transaction has already performed queries on pvt data. writes are not allowed")
+	}
+	return nil
+}
+
+// nextTxID returns the tx ID of the next transaction
+func (s *testStub) nextTxID() string {
+	return fmt.Sprintf("tx%08d", s.txCount+1)
+}
+
+// end commits the writes if the response is endorsable, like the peer
+func (s *testStub) end(res peer.Response) {
+	if res.Status < shim.ERRORTHRESHOLD {
+		s.commit()
+	} else {
+		s.event = nil
+	}
+	s.writes = nil
+	s.privateWrites = nil
+}
+
+func (s *testStub) commit() {
+	ts, _ := s.GetTxTimestamp()
+	for key, value := range s.writes {
+		if value == nil {
+			delete(s.state, key)
+		} else {
+			s.state[key] = value
+		}
+		s.history[key] = append(s.history[key], &queryresult.KeyModification{
+			TxId:      s.txID,
+			Value:     value,
+			Timestamp: ts,
+			IsDelete:  value == nil,
+		})
+	}
+	for collection, writes := range s.privateWrites {
+		if s.private[collection] == nil {
+			s.private[collection] = map[string][]byte{}
+		}
+		for key, value := range writes {
+			if value == nil {
+				delete(s.private[collection], key)
+			} else {
+				s.private[collection][key] = value
+			}
+		}
+	}
+}
+
+// GetArgs _
+func (s *testStub) GetArgs() [][]byte {
+	return s.args
+}
+
+// GetStringArgs _
+func (s *testStub) GetStringArgs() []string {
+	strs := make([]string, 0, len(s.args))
+	for _, arg := range s.args {
+		strs = append(strs, string(arg))
+	}
+	return strs
+}
+
+// GetFunctionAndParameters _
+func (s *testStub) GetFunctionAndParameters() (string, []string) {
+	strs := s.GetStringArgs()
+	if len(strs) == 0 {
+		return "", []string{}
+	}
+	return strs[0], strs[1:]
+}
+
+// GetTxID _
+func (s *testStub) GetTxID() string {
+	return s.txID
+}
+
+// GetChannelID _
+func (s *testStub) GetChannelID() string {
+	return "kiesnet-test"
+}
+
+// InvokeChaincode calls this chaincode in the same transaction, whatever the name is.
+func (s *testStub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) peer.Response {
+	callerArgs := s.args
+	s.args = args
+	defer func() { s.args = callerArgs }()
+	return new(Chaincode).Invoke(s)
+}
+
+// GetTxTimestamp _
+func (s *testStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{
+		Seconds: s.txTime.Unix(),
+		Nanos:   int32(s.txTime.Nanosecond()),
+	}, nil
+}
+
+// GetCreator _
+func (s *testStub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+// GetTransient _
+func (s *testStub) GetTransient() (map[string][]byte, error) {
+	return s.transient, nil
+}
+
+// SetEvent _
+func (s *testStub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return fmt.Errorf("event name can not be empty string")
+	}
+	s.event = &peer.ChaincodeEvent{EventName: name, Payload: payload}
+	return nil
+}
+
+// GetState _
+func (s *testStub) GetState(key string) ([]byte, error) {
+	return s.state[key], nil
+}
+
+// PutState _
+func (s *testStub) PutState(key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("empty key")
+	}
+	if err := s.checkWrite(); err != nil {
+		return err
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	s.writes[key] = value
+	return nil
+}
+
+// DelState _
+func (s *testStub) DelState(key string) error {
+	if err := s.checkWrite(); err != nil {
+		return err
+	}
+	s.writes[key] = nil
+	return nil
+}
+
+// CreateCompositeKey _
+func (s *testStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	key := "\x00" + objectType + "\x00"
+	for _, attr := range attributes {
+		if strings.ContainsRune(attr, 0) {
+			return "", fmt.Errorf("invalid attribute: %q", attr)
+		}
+		key += attr + "\x00"
+	}
+	return key, nil
+}
+
+// SplitCompositeKey _
+func (s *testStub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	parts := strings.Split(strings.TrimPrefix(compositeKey, "\x00"), "\x00")
+	if len(parts) < 2 {
+		return "", nil, fmt.Errorf("invalid composite key: %q", compositeKey)
+	}
+	return parts[0], parts[1 : len(parts)-1], nil
+}
+
+// GetStateByRange _
+func (s *testStub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	kvs := []*queryresult.KV{}
+	for _, key := range sortedKeys(s.state) {
+		if key >= startKey && key < endKey {
+			kvs = append(kvs, &queryresult.KV{Key: key, Value: s.state[key]})
+		}
+	}
+	return &testStateIterator{kvs: kvs}, nil
+}
+
+// GetStateByPartialCompositeKey _
+func (s *testStub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	iter, _, err := s.GetStateByPartialCompositeKeyWithPagination(objectType, keys, 0, "")
+	return iter, err
+}
+
+// GetStateByPartialCompositeKeyWithPagination returns a page of the composite keys.
+// The bookmark is the start key of the next page, and it is empty in the last page.
+func (s *testStub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	prefix, err := s.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	kvs := []*queryresult.KV{}
+	meta := &peer.QueryResponseMetadata{}
+	for _, key := range sortedKeys(s.state) {
+		if !strings.HasPrefix(key, prefix) || key < bookmark {
+			continue
+		}
+		if pageSize > 0 && len(kvs) >= int(pageSize) {
+			meta.Bookmark = key
+			break
+		}
+		kvs = append(kvs, &queryresult.KV{Key: key, Value: s.state[key]})
+	}
+	meta.FetchedRecordsCount = int32(len(kvs))
+	return &testStateIterator{kvs: kvs}, meta, nil
+}
+
+// GetPrivateData _
+func (s *testStub) GetPrivateData(collection, key string) ([]byte, error) {
+	return s.private[collection][key], nil
+}
+
+// PutPrivateData _
+func (s *testStub) PutPrivateData(collection, key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("empty key")
+	}
+	if err := s.checkWrite(); err != nil {
+		return err
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	if s.privateWrites[collection] == nil {
+		s.privateWrites[collection] = map[string][]byte{}
+	}
+	s.privateWrites[collection][key] = value
+	return nil
+}
+
+// DelPrivateData _
+func (s *testStub) DelPrivateData(collection, key string) error {
+	if err := s.checkWrite(); err != nil {
+		return err
+	}
+	if s.privateWrites[collection] == nil {
+		s.privateWrites[collection] = map[string][]byte{}
+	}
+	s.privateWrites[collection][key] = nil
+	return nil
+}
+
+// GetQueryResult _
+func (s *testStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	iter, _, err := s.GetQueryResultWithPagination(query, 0, "")
+	return iter, err
+}
+
+// GetQueryResultWithPagination evaluates the CouchDB selector against the committed state.
+// The bookmark is the key of the last record of the previous page.
+func (s *testStub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	if s.levelDB {
+		return nil, nil, fmt.Errorf("ExecuteQuery not supported for leveldb")
+	}
+	return queryDocuments(s.state, query, pageSize, bookmark)
+}
+
+// GetPrivateDataQueryResult _
+func (s *testStub) GetPrivateDataQueryResult(collection, query string) (shim.StateQueryIteratorInterface, error) {
+	if len(s.writes) > 0 || len(s.privateWrites) > 0 {
+		return nil, fmt.Errorf("queries on pvt data is supported only in a read-only transaction")
+	}
+	s.privateQuery = true
+	iter, _, err := queryDocuments(s.private[collection], query, 0, "")
+	return iter, err
+}
+
+func queryDocuments(docs map[string][]byte, query string, pageSize int32, bookmark string) (*testStateIterator, *peer.QueryResponseMetadata, error) {
+	q := struct {
+		Selector map[string]interface{} `json:"selector"`
+		Sort     []map[string]string    `json:"sort"`
+		Limit    int                    `json:"limit"`
+	}{}
+	if err := json.Unmarshal([]byte(query), &q); err != nil {
+		return nil, nil, fmt.Errorf("invalid query: %s", err)
+	}
+
+	matched := []*queryresult.KV{}
+	values := map[string]map[string]interface{}{}
+	for _, key := range sortedKeys(docs) {
+		doc := map[string]interface{}{}
+		if err := json.Unmarshal(docs[key], &doc); err != nil {
+			continue // not a JSON document
+		}
+		if !matchSelector(doc, q.Selector) {
+			continue
+		}
+		matched = append(matched, &queryresult.KV{Key: key, Value: docs[key]})
+		values[key] = doc
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		for _, field := range q.Sort {
+			for name, order := range field {
+				a, _ := lookupField(values[matched[i].Key], name)
+				b, _ := lookupField(values[matched[j].Key], name)
+				c, ok := compareValues(a, b)
+				if !ok || c == 0 {
+					continue
+				}
+				return (c < 0) == (order != "desc")
+			}
+		}
+		return false
+	})
+
+	kvs := []*queryresult.KV{}
+	skip := bookmark != ""
+	for _, kv := range matched {
+		if skip {
+			skip = kv.Key != bookmark
+			continue
+		}
+		kvs = append(kvs, kv)
+		if (pageSize > 0 && len(kvs) >= int(pageSize)) || (q.Limit > 0 && len(kvs) >= q.Limit) {
+			break
+		}
+	}
+
+	meta := &peer.QueryResponseMetadata{FetchedRecordsCount: int32(len(kvs))}
+	if len(kvs) > 0 {
+		meta.Bookmark = kvs[len(kvs)-1].Key
+	}
+	return &testStateIterator{kvs: kvs}, meta, nil
+}
+
+// GetHistoryForKey returns the committed modifications of the key, oldest first.
+func (s *testStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &testHistoryIterator{kms: s.history[key]}, nil
+}
+
+func sortedKeys(docs map[string][]byte) []string {
+	keys := make([]string, 0, len(docs))
+	for key := range docs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// testStateIterator implements shim.StateQueryIteratorInterface
+type testStateIterator struct {
+	kvs []*queryresult.KV
+	pos int
+}
+
+// HasNext _
+func (iter *testStateIterator) HasNext() bool {
+	return iter.pos < len(iter.kvs)
+}
+
+// Next _
+func (iter *testStateIterator) Next() (*queryresult.KV, error) {
+	if !iter.HasNext() {
+		return nil, fmt.Errorf("no more items")
+	}
+	kv := iter.kvs[iter.pos]
+	iter.pos++
+	return kv, nil
+}
+
+// Close _
+func (iter *testStateIterator) Close() error {
+	return nil
+}
+
+// testHistoryIterator implements shim.HistoryQueryIteratorInterface
+type testHistoryIterator struct {
+	kms []*queryresult.KeyModification
+	pos int
+}
+
+// HasNext _
+func (iter *testHistoryIterator) HasNext() bool {
+	return iter.pos < len(iter.kms)
+}
+
+// Next _
+func (iter *testHistoryIterator) Next() (*queryresult.KeyModification, error) {
+	if !iter.HasNext() {
+		return nil, fmt.Errorf("no more items")
+	}
+	km := iter.kms[iter.pos]
+	iter.pos++
+	return km, nil
+}
+
+// Close _
+func (iter *testHistoryIterator) Close() error {
+	return nil
+}
+
+// selector engine
+// supports field equality, dotted field paths, $and, $or and
+// the $eq, $ne, $gt, $gte, $lt, $lte, $exists and $in operators.
+
+func matchSelector(doc map[string]interface{}, selector map[string]interface{}) bool {
+	for field, cond := range selector {
+		switch field {
+		case "$and", "$or":
+			subs, _ := cond.([]interface{})
+			matched := 0
+			for _, sub := range subs {
+				if m, ok := sub.(map[string]interface{}); ok && matchSelector(doc, m) {
+					matched++
+				}
+			}
+			if field == "$and" && matched != len(subs) {
+				return false
+			}
+			if field == "$or" && matched == 0 {
+				return false
+			}
+		default:
+			value, exists := lookupField(doc, field)
+			if !matchCondition(value, exists, cond) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func lookupField(doc map[string]interface{}, field string) (interface{}, bool) {
+	var value interface{} = doc
+	for _, name := range strings.Split(field, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[name]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func matchCondition(value interface{}, exists bool, cond interface{}) bool {
+	ops, ok := cond.(map[string]interface{})
+	if !ok {
+		return exists && equalValues(value, cond)
+	}
+	for op, operand := range ops {
+		switch op {
+		case "$exists":
+			if want, _ := operand.(bool); want != exists {
+				return false
+			}
+		case "$eq":
+			if !exists || !equalValues(value, operand) {
+				return false
+			}
+		case "$ne":
+			if exists && equalValues(value, operand) {
+				return false
+			}
+		case "$gt", "$gte", "$lt", "$lte":
+			c, ok := compareValues(value, operand)
+			if !exists || !ok {
+				return false
+			}
+			if (op == "$gt" && c <= 0) || (op == "$gte" && c < 0) || (op == "$lt" && c >= 0) || (op == "$lte" && c > 0) {
+				return false
+			}
+		case "$in":
+			list, _ := operand.([]interface{})
+			found := false
+			for _, item := range list {
+				if exists && equalValues(value, item) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		default:
+			return false // unsupported operator
+		}
+	}
+	return true
+}
+
+// compareValues compares JSON decoded values.
+// Values of different types are not comparable.
+func compareValues(a, b interface{}) (int, bool) {
+	switch av := a.(type) {
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv), true
+		}
+	case float64:
+		if bv, ok := b.(float64); ok {
+			if av < bv {
+				return -1, true
+			} else if av > bv {
+				return 1, true
+			}
+			return 0, true
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			return strings.Compare(strconv.FormatBool(av), strconv.FormatBool(bv)), true
+		}
+	}
+	return 0, false
+}
+
+func equalValues(a, b interface{}) bool {
+	c, ok := compareValues(a, b)
+	return ok && c == 0
+}
@@ -0,0 +1,49 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+)
+
+// Verification is the invoker's identity status for dependent chaincodes
+type Verification struct {
+	KID            string       `json:"kid"`
+	SN             string       `json:"sn"`
+	Revoked        bool         `json:"revoked"`
+	Expired        bool         `json:"expired"` // X.509 validity has ended
+	Locked         bool         `json:"locked"`  // locked with another certificate
+	LockExpiryTime *txtime.Time `json:"lock_expiry_time,omitempty"`
+	OldStyle       bool         `json:"old_style"`
+	CreatedTime    *txtime.Time `json:"created_time,omitempty"`
+	RevokedTime    *txtime.Time `json:"revoked_time,omitempty"`
+	KIDCreatedTime *txtime.Time `json:"kid_created_time,omitempty"`
+	KIDUpdatedTime *txtime.Time `json:"kid_updated_time,omitempty"`
+}
+
+// NewVerification _
+func NewVerification(kid *KID, cert *Certificate, ts *txtime.Time) *Verification {
+	v := &Verification{
+		KID:            kid.DOCTYPEID,
+		SN:             cert.SN,
+		Revoked:        cert.RevokedTime != nil,
+		Expired:        cert.IsExpired(ts),
+		Locked:         kid.IsLocked(ts) && kid.Lock != cert.SN,
+		OldStyle:       kid.isPriv,
+		CreatedTime:    cert.CreatedTime,
+		RevokedTime:    cert.RevokedTime,
+		KIDCreatedTime: kid.CreatedTime,
+		KIDUpdatedTime: kid.UpdatedTime,
+	}
+	if kid.IsLocked(ts) {
+		v.LockExpiryTime = kid.LockExpiryTime
+	}
+	return v
+}
+
+// MarshalPayload _
+func (v *Verification) MarshalPayload() ([]byte, error) {
+	return json.Marshal(v)
+}
@@ -0,0 +1,95 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+// Package verifier helps dependent chaincodes to verify the invoker's identity
+// by calling 'verify' of the kiesnet-id chaincode, and to check the claims by calling 'has_claim'.
+package verifier
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/key-inside/kiesnet-ccpkg/txtime"
+	"github.com/pkg/errors"
+)
+
+// ChaincodeName is the default name of the kiesnet-id chaincode
+const ChaincodeName = "kiesnet-id"
+
+// Result is the payload of 'verify'
+type Result struct {
+	KID            string       `json:"kid"`
+	SN             string       `json:"sn"`
+	Revoked        bool         `json:"revoked"`
+	Expired        bool         `json:"expired"` // X.509 validity has ended
+	Locked         bool         `json:"locked"`  // locked with another certificate
+	LockExpiryTime *txtime.Time `json:"lock_expiry_time,omitempty"`
+	OldStyle       bool         `json:"old_style"`
+	CreatedTime    *txtime.Time `json:"created_time,omitempty"`
+	RevokedTime    *txtime.Time `json:"revoked_time,omitempty"`
+	KIDCreatedTime *txtime.Time `json:"kid_created_time,omitempty"`
+	KIDUpdatedTime *txtime.Time `json:"kid_updated_time,omitempty"`
+}
+
+// Active returns true if the certificate is not revoked nor expired, and can use the KID.
+func (r *Result) Active() bool {
+	return !r.Revoked && !r.Expired && !r.Locked
+}
+
+// Verify calls 'verify' of the kiesnet-id chaincode on the same channel.
+func Verify(stub shim.ChaincodeStubInterface) (*Result, error) {
+	return VerifyWith(stub, ChaincodeName, "")
+}
+
+// VerifyWith calls 'verify' of the chaincode named 'ccName' on the 'channel'.
+// If the channel is empty, the channel of the transaction is used.
+func VerifyWith(stub shim.ChaincodeStubInterface, ccName, channel string) (*Result, error) {
+	res := stub.InvokeChaincode(ccName, [][]byte{[]byte("verify")}, channel)
+	if res.GetStatus() != shim.OK {
+		return nil, errors.New(res.GetMessage())
+	}
+	return Decode(res.GetPayload())
+}
+
+// GetActiveKID returns the invoker's KID if the certificate is active.
+func GetActiveKID(stub shim.ChaincodeStubInterface) (string, error) {
+	r, err := Verify(stub)
+	if err != nil {
+		return "", err
+	}
+	if r.Revoked {
+		return "", errors.New("revoked certificate")
+	}
+	if r.Expired {
+		return "", errors.New("expired certificate")
+	}
+	if r.Locked {
+		return "", errors.New("not locked certificate")
+	}
+	return r.KID, nil
+}
+
+// HasClaim calls 'has_claim' of the kiesnet-id chaincode on the same channel.
+// It returns whether the KID has the valid claim of the type, with the value and by the issuer if not empty.
+func HasClaim(stub shim.ChaincodeStubInterface, kid, typ, value, issuer string) (bool, error) {
+	args := [][]byte{[]byte("has_claim"), []byte(kid), []byte(typ), []byte(value), []byte(issuer)}
+	res := stub.InvokeChaincode(ChaincodeName, args, "")
+	if res.GetStatus() != shim.OK {
+		return false, errors.New(res.GetMessage())
+	}
+	cc := &struct {
+		HasClaim bool `json:"has_claim"`
+	}{}
+	if err := json.Unmarshal(res.GetPayload(), cc); err != nil {
+		return false, errors.Wrap(err, "failed to unmarshal the claim check")
+	}
+	return cc.HasClaim, nil
+}
+
+// Decode unmarshals the payload of 'verify'.
+func Decode(payload []byte) (*Result, error) {
+	r := &Result{}
+	if err := json.Unmarshal(payload, r); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the verification")
+	}
+	return r, nil
+}
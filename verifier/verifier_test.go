@@ -0,0 +1,91 @@
+// Copyright Key Inside Co., Ltd. 2018 All Rights Reserved.
+
+package verifier
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+// fakeStub answers InvokeChaincode with the fixed response
+type fakeStub struct {
+	shim.ChaincodeStubInterface
+	res     peer.Response
+	ccName  string
+	channel string
+	args    [][]byte
+}
+
+func (s *fakeStub) InvokeChaincode(ccName string, args [][]byte, channel string) peer.Response {
+	s.ccName, s.args, s.channel = ccName, args, channel
+	return s.res
+}
+
+func TestVerify(t *testing.T) {
+	stub := &fakeStub{res: shim.Success([]byte(`{"kid":"abcd","sn":"01","revoked":false,"locked":false,"old_style":true,"created_time":"2018-12-01T00:00:00.000000000Z"}`))}
+	r, err := Verify(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stub.ccName != ChaincodeName || stub.channel != "" || len(stub.args) != 1 || string(stub.args[0]) != "verify" {
+		t.Errorf("unexpected call: %s %q %s", stub.ccName, stub.args, stub.channel)
+	}
+	if r.KID != "abcd" || r.SN != "01" || !r.OldStyle || !r.Active() || r.CreatedTime == nil {
+		t.Errorf("unexpected result: %+v", r)
+	}
+
+	kid, err := GetActiveKID(stub)
+	if err != nil || kid != "abcd" {
+		t.Errorf("expected abcd, but %s, %v", kid, err)
+	}
+}
+
+func TestVerifyInactive(t *testing.T) {
+	tests := []struct {
+		payload string
+		err     string
+	}{
+		{`{"kid":"abcd","sn":"01","revoked":true}`, "revoked certificate"},
+		{`{"kid":"abcd","sn":"01","expired":true}`, "expired certificate"},
+		{`{"kid":"abcd","sn":"01","locked":true}`, "not locked certificate"},
+	}
+	for _, tt := range tests {
+		stub := &fakeStub{res: shim.Success([]byte(tt.payload))}
+		if _, err := GetActiveKID(stub); err == nil || err.Error() != tt.err {
+			t.Errorf("expected [%s], but %v", tt.err, err)
+		}
+	}
+}
+
+func TestVerifyError(t *testing.T) {
+	stub := &fakeStub{res: shim.Error("failed to get the invoker's KID|not registrated certificate")}
+	if _, err := VerifyWith(stub, "other-id", "other-channel"); err == nil || err.Error() != "failed to get the invoker's KID|not registrated certificate" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if stub.ccName != "other-id" || stub.channel != "other-channel" {
+		t.Errorf("unexpected call: %s %s", stub.ccName, stub.channel)
+	}
+
+	stub = &fakeStub{res: shim.Success([]byte("abcd"))}
+	if _, err := Verify(stub); err == nil {
+		t.Error("expected unmarshal error")
+	}
+}
+
+func TestHasClaim(t *testing.T) {
+	stub := &fakeStub{res: shim.Success([]byte(`{"kid":"abcd","type":"country","has_claim":true,"claims":[{"@claim":"abcd","type":"country","value":"KR","issuer":"kyc"}]}`))}
+	ok, err := HasClaim(stub, "abcd", "country", "KR", "")
+	if err != nil || !ok {
+		t.Errorf("expected the claim, but %v, %v", ok, err)
+	}
+	if len(stub.args) != 5 || string(stub.args[0]) != "has_claim" || string(stub.args[3]) != "KR" {
+		t.Errorf("unexpected call: %q", stub.args)
+	}
+
+	stub = &fakeStub{res: shim.Error("invalid claim type")}
+	if _, err = HasClaim(stub, "abcd", "", "", ""); err == nil || err.Error() != "invalid claim type" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}